@@ -0,0 +1,72 @@
+// Command aereumd runs an aereum node.
+//
+// Configuration is read from a JSON file given by -config, and any flag set on
+// the command line overrides the corresponding field of the file.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/lienkolabs/aereum/node"
+)
+
+func main() {
+	configPath := flag.String("config", "", "path to JSON config file")
+	genesis := flag.String("genesis", "", "path to genesis spec file")
+	dataDir := flag.String("data", "", "data directory")
+	listen := flag.String("listen", "", "p2p listen address")
+	peers := flag.String("peers", "", "comma separated p2p peer addresses")
+	publisherKey := flag.String("publisher", "", "path to hex private key of the block publisher")
+	api := flag.String("api", "", "local api listen address")
+	indexer := flag.Bool("index", false, "maintain instruction history indexes")
+	flag.Parse()
+
+	config := &node.Config{}
+	if *configPath != "" {
+		var err error
+		if config, err = node.LoadConfig(*configPath); err != nil {
+			log.Fatalf("could not read config: %v", err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "genesis":
+			config.Genesis = *genesis
+		case "data":
+			config.DataDir = *dataDir
+		case "listen":
+			config.Listen = *listen
+		case "peers":
+			config.Peers = strings.Split(*peers, ",")
+		case "publisher":
+			config.PublisherKey = *publisherKey
+		case "api":
+			config.API = *api
+		case "index":
+			config.Index = *indexer
+		}
+	})
+
+	aereum, err := node.New(config)
+	if err != nil {
+		log.Fatalf("could not open node: %v", err)
+	}
+	if err := aereum.Start(); err != nil {
+		aereum.Shutdown()
+		log.Fatalf("could not start node: %v", err)
+	}
+	log.Printf("aereum node running at epoch %v", aereum.Chain.Epoch())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	log.Print("shutting down")
+	if err := aereum.Shutdown(); err != nil {
+		log.Fatalf("unclean shutdown: %v", err)
+	}
+}
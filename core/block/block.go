@@ -1,6 +1,7 @@
 package block
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,6 +11,11 @@ import (
 	"github.com/lienkolabs/aereum/core/util"
 )
 
+var (
+	ErrCannotPay        = errors.New("insufficient balance to pay for instruction")
+	ErrFailedValidation = errors.New("instruction failed validation")
+)
+
 type Block struct {
 	epoch         uint64
 	Parent        crypto.Hash
@@ -17,7 +23,7 @@ type Block struct {
 	Publisher     crypto.Token
 	PublishedAt   time.Time
 	Instructions  [][]byte
-	Hash          crypto.Hash
+	Hash          crypto.Hash // reserved, left zero, see SerializedHash
 	FeesCollected uint64
 	Signature     crypto.Signature
 	validator     *MutatingState
@@ -37,40 +43,63 @@ func NewBlock(parent crypto.Hash, checkpoint, epoch uint64, publisher crypto.Tok
 }
 
 func (b *Block) Incorporate(instruction instructions.Instruction) bool {
+	return b.TryIncorporate(instruction) == nil
+}
+
+// TryIncorporate is like Incorporate but returns the reason the instruction was
+// not incorporated: ErrCannotPay if its payments are not covered by the
+// balances of the debited wallets, ErrFailedValidation otherwise.
+func (b *Block) TryIncorporate(instruction instructions.Instruction) error {
 	payments := instruction.Payments()
 	if !b.CanPay(payments) {
-		return false
+		return ErrCannotPay
 	}
 	if !instruction.Validate(b) {
-		return false
+		return ErrFailedValidation
 	}
 	b.TransferPayments(payments)
 	b.Instructions = append(b.Instructions, instruction.Serialize())
-	return true
+	return nil
 }
 
 func (b *Block) CanPay(payments *instructions.Payment) bool {
 	for _, debit := range payments.Debit {
 		existingBalance := b.validator.balance(debit.Account)
 		delta := b.mutations.DeltaBalance(debit.Account)
-		if int(existingBalance) < int(debit.FungibleTokens)+delta {
+		if int(existingBalance)+delta < int(debit.FungibleTokens) {
 			return false
 		}
 	}
 	return true
 }
 
+// CanWithdraw checks if the bonded deposit of the hash, taking into account
+// deposits and withdrawals already incorporated in the block, covers value.
 func (b *Block) CanWithdraw(hash crypto.Hash, value uint64) bool {
-	existingBalance := b.validator.balance(hash)
-	return value < existingBalance
+	existingDeposit := b.validator.deposit(hash)
+	delta := b.mutations.DeltaDeposit(hash)
+	return int(existingDeposit)+delta >= int(value)
 }
 
+// Deposit bonds value to the deposit of the hash. Funds must have been debited
+// from the wallet by the payments of the instruction.
 func (b *Block) Deposit(hash crypto.Hash, value uint64) {
-	if old, ok := b.validator.Mutations.DeltaDeposits[hash]; ok {
-		b.validator.Mutations.DeltaDeposits[hash] = old + int(value)
+	if old, ok := b.mutations.DeltaDeposits[hash]; ok {
+		b.mutations.DeltaDeposits[hash] = old + int(value)
 		return
 	}
-	b.validator.Mutations.DeltaDeposits[hash] = int(value)
+	b.mutations.DeltaDeposits[hash] = int(value)
+}
+
+// Withdraw unbonds value from the deposit of the hash. The value is credited
+// back to the wallet only after the unbonding period of the state.
+func (b *Block) Withdraw(hash crypto.Hash, value uint64) {
+	if old, ok := b.mutations.DeltaDeposits[hash]; ok {
+		b.mutations.DeltaDeposits[hash] = old - int(value)
+	} else {
+		b.mutations.DeltaDeposits[hash] = -int(value)
+	}
+	b.mutations.Withdrawals[hash] += value
 }
 
 func (b *Block) TransferPayments(payments *instructions.Payment) {
@@ -151,6 +180,10 @@ func (b *Block) SetNewAudience(hash crypto.Hash, stage instructions.StageKeys) b
 	return true
 }
 
+func (b *Block) SetNewContent(hash crypto.Hash) bool {
+	return setNewHash(hash, b.mutations.NewContents)
+}
+
 func (b *Block) UpdateAudience(hash crypto.Hash, stage instructions.StageKeys) bool {
 	if _, ok := b.mutations.StageUpdate[hash]; ok {
 		return false
@@ -175,6 +208,15 @@ func (b *Block) HasCaption(hash crypto.Hash) bool {
 	return b.validator.hasCaption(hash)
 }
 
+// HasContent checks if the content was published on a previous block or
+// earlier on this block.
+func (b *Block) HasContent(hash crypto.Hash) bool {
+	if b.mutations.HasContent(hash) {
+		return true
+	}
+	return b.validator.hasContent(hash)
+}
+
 func (b *Block) HasGrantedSponser(hash crypto.Hash) (bool, crypto.Hash) {
 	return b.validator.hasGrantedSponser(hash)
 }
@@ -191,6 +233,16 @@ func (b *Block) Balance(hash crypto.Hash) uint64 {
 	return b.validator.balance(hash)
 }
 
+// Staked returns the bonded deposit of the hash prior to the block.
+func (b *Block) Staked(hash crypto.Hash) uint64 {
+	return b.validator.deposit(hash)
+}
+
+// Mutations returns the state mutations incorporated by the block so far.
+func (b *Block) Mutations() *state.Mutation {
+	return b.mutations
+}
+
 func (b *Block) AddFeeCollected(value uint64) {
 	b.FeesCollected += value
 }
@@ -214,7 +266,7 @@ func (b *Block) serializeWithoutSignature() []byte {
 	util.PutUint64(b.epoch, &bytes)
 	util.PutByteArray(b.Parent[:], &bytes)
 	util.PutUint64(b.CheckPoint, &bytes)
-	util.PutByteArray(b.Publisher[:], &bytes)
+	util.PutToken(b.Publisher, &bytes)
 	util.PutTime(b.PublishedAt, &bytes)
 	util.PutUint16(uint16(len(b.Instructions)), &bytes)
 	for _, instruction := range b.Instructions {
@@ -236,6 +288,9 @@ func ParseBlock(data []byte) *Block {
 	block.Instructions, position = util.ParseByteArrayArray(data, position)
 	block.Hash, position = util.ParseHash(data, position)
 	block.FeesCollected, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	block.Signature, _ = util.ParseSignature(data, position)
 	if !block.Publisher.Verify(msg, block.Signature) {
@@ -258,7 +313,14 @@ func GetBlockEpoch(data []byte) uint64 {
 	return epoch
 }
 
+// SerializedHash returns the hash of the signed serialization of the block,
+// by which the block is known on the chain.
+func (b *Block) SerializedHash() crypto.Hash {
+	return crypto.Hasher(b.Serialize())
+}
+
 func (b *Block) JSONSimple() string {
+	hash := b.SerializedHash()
 	bulk := &util.JSONBuilder{}
 	bulk.PutUint64("epoch", b.epoch)
 	bulk.PutHex("parent", b.Parent[:])
@@ -266,7 +328,7 @@ func (b *Block) JSONSimple() string {
 	bulk.PutHex("publisher", b.Publisher[:])
 	bulk.PutTime("publishedAt", b.PublishedAt)
 	bulk.PutUint64("instructionsCount", uint64(len(b.Instructions)))
-	bulk.PutHex("hash", b.Parent[:])
+	bulk.PutHex("hash", hash[:])
 	bulk.PutUint64("feesCollectes", b.FeesCollected)
 	bulk.PutBase64("signature", b.Signature[:])
 	return bulk.ToString()
@@ -0,0 +1,88 @@
+package block
+
+import (
+	"math/bits"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+// BasisPoints is the denominator of the shares of a FeePolicy.
+const BasisPoints = 10000
+
+// FeePolicy defines how the fees collected by a block are distributed when the
+// block is committed. StakersShare and BurnShare are expressed in basis points
+// of the collected fees. Whatever is left, including rounding remainders, is
+// credited to the wallet of the block publisher.
+type FeePolicy struct {
+	StakersShare uint64
+	BurnShare    uint64
+}
+
+// DefaultFeePolicy credits every collected fee to the block publisher.
+var DefaultFeePolicy = FeePolicy{}
+
+// Valid checks that the shares of the policy do not exceed the collected fees.
+func (p FeePolicy) Valid() bool {
+	return p.StakersShare <= BasisPoints && p.BurnShare <= BasisPoints &&
+		p.StakersShare+p.BurnShare <= BasisPoints
+}
+
+// Distribute splits fees among publisher and stakers according to policy.
+// Stakers are credited in proportion to their deposits and must be provided in
+// a deterministic order. It returns the credits and the burned amount. Credits
+// plus burned always sum up to fees. An invalid policy credits everything to
+// the publisher.
+func (p FeePolicy) Distribute(fees uint64, publisher crypto.Hash, stakers []instructions.Wallet) ([]instructions.Wallet, uint64) {
+	if !p.Valid() {
+		p = DefaultFeePolicy
+	}
+	burned := share(fees, p.BurnShare, BasisPoints)
+	stakersPool := share(fees, p.StakersShare, BasisPoints)
+	totalStake := uint64(0)
+	for _, staker := range stakers {
+		totalStake += staker.FungibleTokens
+	}
+	credits := make([]instructions.Wallet, 0, len(stakers)+1)
+	distributed := uint64(0)
+	if totalStake > 0 {
+		for _, staker := range stakers {
+			value := share(stakersPool, staker.FungibleTokens, totalStake)
+			if value > 0 {
+				credits = append(credits, instructions.Wallet{Account: staker.Account, FungibleTokens: value})
+				distributed += value
+			}
+		}
+	}
+	if remainder := fees - burned - distributed; remainder > 0 {
+		credits = append(credits, instructions.Wallet{Account: publisher, FungibleTokens: remainder})
+	}
+	return credits, burned
+}
+
+// share returns value * numerator / denominator without overflow. numerator
+// must not exceed denominator.
+func share(value, numerator, denominator uint64) uint64 {
+	hi, lo := bits.Mul64(value, numerator)
+	quo, _ := bits.Div64(hi, lo, denominator)
+	return quo
+}
+
+// distributeFees credits the fees collected by the block according to policy
+// into the block mutations. Stakes are taken from the state prior to the block.
+func (b *Block) distributeFees(policy FeePolicy) {
+	stakers := make([]instructions.Wallet, 0)
+	for _, hash := range b.validator.State.Stakers() {
+		stakers = append(stakers, instructions.Wallet{Account: hash, FungibleTokens: b.validator.State.StakedHash(hash)})
+	}
+	credits, burned := policy.Distribute(b.FeesCollected, crypto.HashToken(b.Publisher), stakers)
+	b.TransferPayments(&instructions.Payment{Debit: []instructions.Wallet{}, Credit: credits})
+	b.mutations.BurnedFees += burned
+}
+
+// Commit distributes the fees collected by the block according to policy and
+// incorporates the block mutations into the state of its validator.
+func (b *Block) Commit(policy FeePolicy) {
+	b.distributeFees(policy)
+	b.validator.State.IncorporateMutations(b.epoch, b.mutations)
+}
@@ -0,0 +1,73 @@
+package block
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/state"
+)
+
+func TestFeePolicyDistribute(t *testing.T) {
+	publisher := crypto.Hasher([]byte("publisher"))
+	a, b, c := crypto.Hasher([]byte("a")), crypto.Hasher([]byte("b")), crypto.Hasher([]byte("c"))
+	stakers := func(stakes ...uint64) []instructions.Wallet {
+		wallets := make([]instructions.Wallet, 0)
+		for n, stake := range stakes {
+			wallets = append(wallets, instructions.Wallet{Account: []crypto.Hash{a, b, c}[n], FungibleTokens: stake})
+		}
+		return wallets
+	}
+	credit := func(account crypto.Hash, value uint64) instructions.Wallet {
+		return instructions.Wallet{Account: account, FungibleTokens: value}
+	}
+	tests := []struct {
+		name    string
+		policy  FeePolicy
+		fees    uint64
+		stakers []instructions.Wallet
+		credits []instructions.Wallet
+		burned  uint64
+	}{
+		{"zero fee", FeePolicy{StakersShare: 3000, BurnShare: 1000}, 0, stakers(1, 1), []instructions.Wallet{}, 0},
+		{"shares sum to basis points", FeePolicy{StakersShare: 6000, BurnShare: 4000}, 1000, stakers(1, 3),
+			[]instructions.Wallet{credit(a, 150), credit(b, 450)}, 400},
+		{"uneven fee remainder to publisher", FeePolicy{StakersShare: 3000, BurnShare: 1000}, 1001, stakers(1, 1, 1),
+			[]instructions.Wallet{credit(a, 100), credit(b, 100), credit(c, 100), credit(publisher, 601)}, 100},
+		{"maximum fee", FeePolicy{StakersShare: 5000, BurnShare: 2500}, math.MaxUint64, stakers(1, 1),
+			[]instructions.Wallet{credit(a, 4611686018427387903), credit(b, 4611686018427387903), credit(publisher, 4611686018427387906)}, 4611686018427387903},
+		{"no stakers", FeePolicy{StakersShare: 3000, BurnShare: 1000}, 1000, nil,
+			[]instructions.Wallet{credit(publisher, 900)}, 100},
+		{"invalid policy", FeePolicy{StakersShare: 8000, BurnShare: 4000}, 1000, stakers(1),
+			[]instructions.Wallet{credit(publisher, 1000)}, 0},
+	}
+	for _, test := range tests {
+		credits, burned := test.policy.Distribute(test.fees, publisher, test.stakers)
+		if burned != test.burned || !reflect.DeepEqual(credits, test.credits) {
+			t.Errorf("%v: got %v burned %v", test.name, credits, burned)
+		}
+		total := burned
+		for _, credit := range credits {
+			total += credit.FungibleTokens
+		}
+		if total != test.fees {
+			t.Errorf("%v: distributed %v of %v", test.name, total, test.fees)
+		}
+	}
+}
+
+func TestDistributeFeesWithoutStakers(t *testing.T) {
+	publisher, _ := crypto.RandomAsymetricKey()
+	produced := NewBlock(crypto.Hash{}, 0, 1, publisher, &MutatingState{State: state.NewMemoryState(0)})
+	produced.AddFeeCollected(1000)
+	produced.distributeFees(FeePolicy{StakersShare: 3000, BurnShare: 1000})
+	mutations := produced.Mutations()
+	if delta := mutations.DeltaWallets[crypto.HashToken(publisher)]; delta != 900 {
+		t.Errorf("publisher credited %v", delta)
+	}
+	if len(mutations.DeltaWallets) != 1 || mutations.BurnedFees != 100 {
+		t.Errorf("wrong mutations: %v credits, %v burned", len(mutations.DeltaWallets), mutations.BurnedFees)
+	}
+}
@@ -27,6 +27,22 @@ func (c *MutatingState) balance(hash crypto.Hash) uint64 {
 	return balance
 }
 
+// Deposit returns the bonded deposit associated to the hash. It returns zero
+// if the hash is not found.
+func (c *MutatingState) deposit(hash crypto.Hash) uint64 {
+	_, deposit := c.State.Deposits.BalanceHash(hash)
+	if c.Mutations == nil {
+		return deposit
+	}
+	delta := c.Mutations.DeltaDeposit(hash)
+	if delta < 0 {
+		deposit = deposit - uint64(-delta)
+	} else {
+		deposit = deposit + uint64(delta)
+	}
+	return deposit
+}
+
 // PowerOfAttorney checks if an attorney can sign on behalf of an author.
 func (c *MutatingState) powerOfAttorney(hash crypto.Hash) bool {
 	if c.Mutations != nil {
@@ -83,6 +99,14 @@ func (c *MutatingState) hasCaption(hash crypto.Hash) bool {
 	return c.State.Captions.ExistsHash(hash)
 }
 
+// HasContent returns the existence of a content instruction with the hash.
+func (c *MutatingState) hasContent(hash crypto.Hash) bool {
+	if c.Mutations != nil && c.Mutations.HasContent(hash) {
+		return true
+	}
+	return c.State.Contents.ExistsHash(hash)
+}
+
 // GetAudienceKeys returns the audience keys
 func (c *MutatingState) getAudienceKeys(hash crypto.Hash) *instructions.StageKeys {
 	if c.Mutations != nil {
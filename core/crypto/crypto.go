@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 )
 
 // defines temporary crypto primitives
@@ -20,6 +21,11 @@ const (
 	SignatureSize  = 64
 )
 
+// CipherVersion prefixes messages sealed by Cipher with a random nonce.
+const CipherVersion = 1
+
+var ErrCipherVersion = errors.New("sealed message has unknown cipher version")
+
 type Cipher struct {
 	cipher cipher.AEAD
 }
@@ -69,9 +75,15 @@ func CipherFromKey(key []byte) Cipher {
 	return Cipher{cipher: gcm}
 }
 
+// Seal encrypts msg under a random nonce. The sealed message is the
+// CipherVersion byte followed by the nonce and the encrypted msg.
 func (c Cipher) Seal(msg []byte) []byte {
-	nonce := make([]byte, NonceSize)
-	return c.cipher.Seal(nil, nonce, msg, nil)
+	sealed := make([]byte, 1+NonceSize, 1+NonceSize+len(msg)+c.cipher.Overhead())
+	sealed[0] = CipherVersion
+	if n, err := rand.Read(sealed[1 : 1+NonceSize]); n != NonceSize {
+		panic(err)
+	}
+	return c.cipher.Seal(sealed, sealed[1:1+NonceSize], msg, nil)
 }
 
 func (c CipherNonce) Seal(msg []byte) []byte {
@@ -90,11 +102,31 @@ func (c CipherNonce) SealWithNewNonce(msg []byte) ([]byte, []byte) {
 	return sealed, c.nonce
 }
 
+// Open decrypts a message sealed by Seal.
 func (c Cipher) Open(msg []byte) ([]byte, error) {
+	if len(msg) < 1+NonceSize || msg[0] != CipherVersion {
+		return nil, ErrCipherVersion
+	}
+	return c.cipher.Open(nil, msg[1:1+NonceSize], msg[1+NonceSize:], nil)
+}
+
+// OpenZeroNonce decrypts a message sealed, before CipherVersion, under an all
+// zero nonce. It must only be used to read existing data and migrate it to
+// messages sealed by Seal.
+func (c Cipher) OpenZeroNonce(msg []byte) ([]byte, error) {
 	nonce := make([]byte, NonceSize)
 	return c.cipher.Open(nil, nonce, msg, nil)
 }
 
+// OpenAny decrypts a message sealed by Seal or, failing that, a message
+// sealed under an all zero nonce. Authentication is checked either way.
+func (c Cipher) OpenAny(msg []byte) ([]byte, error) {
+	if opened, err := c.Open(msg); err == nil {
+		return opened, nil
+	}
+	return c.OpenZeroNonce(msg)
+}
+
 func (c CipherNonce) Open(msg []byte) ([]byte, error) {
 	return c.cipher.Open(nil, c.nonce, msg, nil)
 }
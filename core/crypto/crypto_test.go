@@ -19,6 +19,32 @@ func TestCipher(t *testing.T) {
 	}
 }
 
+func TestCipherUniqueNonce(t *testing.T) {
+	key := NewCipherKey()
+	cipher := CipherFromKey(key)
+	data := []byte("same message")
+	first, second := cipher.Seal(data), cipher.Seal(data)
+	if first[0] != CipherVersion || bytes.Equal(first[1:1+NonceSize], second[1:1+NonceSize]) {
+		t.Error("message not sealed under a fresh nonce")
+	}
+	legacy := cipher.cipher.Seal(nil, make([]byte, NonceSize), data, nil)
+	if _, err := cipher.Open(legacy); err == nil {
+		t.Error("zero nonce message opened as versioned")
+	}
+	for _, open := range []func([]byte) ([]byte, error){cipher.OpenZeroNonce, cipher.OpenAny} {
+		if opened, err := open(legacy); err != nil || !bytes.Equal(opened, data) {
+			t.Error("zero nonce message does not open")
+		}
+	}
+	if opened, err := cipher.OpenAny(first); err != nil || !bytes.Equal(opened, data) {
+		t.Error("versioned message does not open")
+	}
+	first[len(first)-1] ^= 1
+	if _, err := cipher.OpenAny(first); err == nil {
+		t.Error("tampered message opened")
+	}
+}
+
 func TestCipherNonce(t *testing.T) {
 	key := NewCipherKey()
 	cipher := CipherNonceFromKey(key)
@@ -30,8 +30,8 @@ package dh
 // the SHA256 hash on the agreed key is used as a key for an AES 256 Cipher.
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
 
 	"github.com/lienkolabs/aereum/core/crypto"
 	"github.com/lienkolabs/aereum/core/crypto/dh/curve25519"
@@ -44,9 +44,17 @@ type Party struct {
 }
 
 func NewEphemeralKey() (crypto.PrivateKey, crypto.Token) {
+	var seed [32]byte
+	rand.Read(seed[:])
+	return KeyFromSeed(seed)
+}
+
+// KeyFromSeed returns the key with X25519 scalar seed. As for the keys of
+// NewEphemeralKey, the public key follows the scalar on the private key.
+func KeyFromSeed(seed [32]byte) (crypto.PrivateKey, crypto.Token) {
 	var pubToken crypto.Token
 	var prvToken crypto.PrivateKey
-	rand.Read(prvToken[0:32])
+	copy(prvToken[0:32], seed[:])
 	pub, err := curve25519.X25519(prvToken[0:32], curve25519.Basepoint)
 	if err == nil {
 		copy(prvToken[32:], pub)
@@ -0,0 +1,84 @@
+package hd
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+// Hardened is added to an index to derive a hardened child. SLIP-0010 only
+// defines hardened derivation for ed25519.
+const Hardened uint32 = 1 << 31
+
+// CoinType is the BIP-0044 coin type of aereum keys. It is not registered on
+// SLIP-0044.
+const CoinType uint32 = 0xae
+
+// Purposes of the keys derived from a master seed. Every purpose has its own
+// sequence of indexes.
+const (
+	PurposeAuthor    uint32 = 0 // identity of the user
+	PurposeAttorney  uint32 = 1 // keys the user grants power of attorney to
+	PurposeStage     uint32 = 2 // owner, submission and moderation keys of stages
+	PurposeEphemeral uint32 = 3 // Diffie-Hellman keys of join requests
+	PurposeWallet    uint32 = 4 // wallets paying fees
+	PurposeRead      uint32 = 5 // read keys of private stages
+)
+
+// ExtendedKey is a node of the derivation tree: the private key material and
+// the chain code its children are derived with.
+type ExtendedKey struct {
+	Key       [32]byte
+	ChainCode [32]byte
+}
+
+func split(sum []byte) ExtendedKey {
+	var extended ExtendedKey
+	copy(extended.Key[:], sum[:32])
+	copy(extended.ChainCode[:], sum[32:])
+	return extended
+}
+
+// MasterKey returns the root of the derivation tree of a seed.
+func MasterKey(seed []byte) ExtendedKey {
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(seed)
+	return split(mac.Sum(nil))
+}
+
+// Child returns the hardened child of the key at index. The hardened bit is
+// set whether or not index carries it.
+func (k ExtendedKey) Child(index uint32) ExtendedKey {
+	data := make([]byte, 1+32+4)
+	copy(data[1:], k.Key[:])
+	binary.BigEndian.PutUint32(data[33:], index|Hardened)
+	mac := hmac.New(sha512.New, k.ChainCode[:])
+	mac.Write(data)
+	return split(mac.Sum(nil))
+}
+
+// Derive returns the key at the path below the master key of seed.
+func Derive(seed []byte, path ...uint32) ExtendedKey {
+	key := MasterKey(seed)
+	for _, index := range path {
+		key = key.Child(index)
+	}
+	return key
+}
+
+// Path returns the path m/44'/CoinType'/purpose'/index' of a key.
+func Path(purpose, index uint32) []uint32 {
+	return []uint32{44, CoinType, purpose, index}
+}
+
+// PrivateKey returns the ed25519 key of the node.
+func (k ExtendedKey) PrivateKey() crypto.PrivateKey {
+	return crypto.PrivateKeyFromSeed(k.Key)
+}
+
+// PurposeKey returns the ed25519 key of seed at index of the purpose.
+func PurposeKey(seed []byte, purpose, index uint32) crypto.PrivateKey {
+	return Derive(seed, Path(purpose, index)...).PrivateKey()
+}
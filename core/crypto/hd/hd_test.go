@@ -0,0 +1,79 @@
+package hd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMnemonic(t *testing.T) {
+	// BIP-0039 test vectors with passphrase TREZOR
+	vectors := []struct{ entropy, phrase, seed string }{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			strings.Repeat("ff", 32),
+			strings.Repeat("zoo ", 23) + "vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+	for _, vector := range vectors {
+		entropy, _ := hex.DecodeString(vector.entropy)
+		phrase, err := NewMnemonic(entropy)
+		if err != nil || phrase != vector.phrase {
+			t.Errorf("wrong phrase: %v", phrase)
+		}
+		if decoded, err := MnemonicEntropy(phrase); err != nil || !bytes.Equal(decoded, entropy) {
+			t.Errorf("wrong entropy of phrase: %v", err)
+		}
+		seed, err := MnemonicSeed(phrase, "TREZOR")
+		if err != nil || hex.EncodeToString(seed) != vector.seed {
+			t.Errorf("wrong seed: %x", seed)
+		}
+	}
+	if _, err := MnemonicEntropy(strings.Repeat("abandon ", 12)); err != ErrChecksum {
+		t.Error("phrase with wrong checksum accepted")
+	}
+	if _, err := MnemonicEntropy(strings.Repeat("abandon ", 11) + "aereum"); err != ErrUnknownWord {
+		t.Error("phrase with unknown word accepted")
+	}
+	entropy, _ := NewEntropy(32)
+	phrase, _ := NewMnemonic(entropy)
+	if _, err := MnemonicSeed(phrase, ""); err != nil || len(strings.Fields(phrase)) != 24 {
+		t.Error("random phrase not valid")
+	}
+}
+
+func TestDerive(t *testing.T) {
+	// SLIP-0010 ed25519 test vector 1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	vectors := []struct {
+		path       []uint32
+		key, chain string
+	}{
+		{nil, "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7", "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb"},
+		{[]uint32{0}, "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3", "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69"},
+		{[]uint32{0, 1}, "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2", "a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14"},
+	}
+	for _, vector := range vectors {
+		key := Derive(seed, vector.path...)
+		if hex.EncodeToString(key.Key[:]) != vector.key || hex.EncodeToString(key.ChainCode[:]) != vector.chain {
+			t.Errorf("wrong key at %v: %x", vector.path, key.Key)
+		}
+	}
+	if key := Derive(seed, 0|Hardened); key != Derive(seed, 0) {
+		t.Error("hardened bit not set on derivation")
+	}
+	if PurposeKey(seed, PurposeStage, 0) == PurposeKey(seed, PurposeStage, 1) || PurposeKey(seed, PurposeStage, 0) == PurposeKey(seed, PurposeAuthor, 0) {
+		t.Error("distinct paths derive the same key")
+	}
+}
@@ -0,0 +1,107 @@
+// Package hd derives every key of a user from a single master seed. The seed
+// is carried by a BIP-0039 mnemonic phrase and keys are derived by SLIP-0010
+// for ed25519 on purpose paths, so that a user holding the phrase can
+// regenerate the keys of its vault.
+package hd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"strings"
+
+	"github.com/lienkolabs/aereum/core/crypto/pbkdf2"
+)
+
+// SeedSize is the size of the master seed derived from a mnemonic phrase.
+const SeedSize = 64
+
+var (
+	ErrEntropySize  = errors.New("entropy must have 16 to 32 bytes in steps of 4 bytes")
+	ErrUnknownWord  = errors.New("mnemonic phrase has a word not on the word list")
+	ErrPhraseLength = errors.New("mnemonic phrase must have 12 to 24 words in steps of 3 words")
+	ErrChecksum     = errors.New("mnemonic phrase checksum does not match")
+)
+
+var wordIndex = func() map[string]int {
+	index := make(map[string]int, len(wordlist))
+	for n, word := range wordlist {
+		index[word] = n
+	}
+	return index
+}()
+
+// NewEntropy returns size random bytes to encode as a mnemonic phrase.
+func NewEntropy(size int) ([]byte, error) {
+	if size < 16 || size > 32 || size%4 != 0 {
+		return nil, ErrEntropySize
+	}
+	entropy := make([]byte, size)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+	return entropy, nil
+}
+
+// NewMnemonic encodes entropy as a phrase of words separated by single
+// spaces. Every word carries 11 bits of the entropy followed by the first
+// bits of its SHA-256 hash, one bit for every 4 bytes of entropy.
+func NewMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", ErrEntropySize
+	}
+	hash := sha256.Sum256(entropy)
+	bits := append(append([]byte{}, entropy...), hash[0])
+	words := make([]string, (len(entropy)*8+len(entropy)/4)/11)
+	for n := range words {
+		index := 0
+		for bit := n * 11; bit < (n+1)*11; bit++ {
+			index = index<<1 | int(bits[bit/8]>>(7-bit%8)&1)
+		}
+		words[n] = wordlist[index]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicEntropy returns the entropy encoded by a phrase and checks its
+// checksum.
+func MnemonicEntropy(phrase string) ([]byte, error) {
+	words := strings.Fields(phrase)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrPhraseLength
+	}
+	bits := make([]byte, (len(words)*11+7)/8)
+	for n, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, ErrUnknownWord
+		}
+		for bit := 0; bit < 11; bit++ {
+			if index>>(10-bit)&1 == 1 {
+				position := n*11 + bit
+				bits[position/8] |= 1 << (7 - position%8)
+			}
+		}
+	}
+	size := len(words) * 11 * 32 / 33 / 8
+	entropy := bits[:size]
+	hash := sha256.Sum256(entropy)
+	checksum := len(words) * 11 / 33
+	if bits[size]>>(8-checksum) != hash[0]>>(8-checksum) {
+		return nil, ErrChecksum
+	}
+	return entropy, nil
+}
+
+// MnemonicSeed returns the master seed of a phrase protected by an optional
+// passphrase. The phrase is checked before deriving the seed. Phrase and
+// passphrase are taken as given: they are expected to be in NFKD form, which
+// holds for the English word list and ASCII passphrases.
+func MnemonicSeed(phrase, passphrase string) ([]byte, error) {
+	if _, err := MnemonicEntropy(phrase); err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(phrase), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), 2048, SeedSize, sha512.New), nil
+}
@@ -39,7 +39,7 @@ func (accept *AcceptJoinRequest) Payments() *Payment {
 		return NewPayment(crypto.HashToken(accept.Wallet), accept.Fee)
 	}
 	if accept.Attorney != crypto.ZeroToken {
-		return NewPayment(crypto.HashToken(accept.Wallet), accept.Fee)
+		return NewPayment(crypto.HashToken(accept.Attorney), accept.Fee)
 	}
 	return NewPayment(crypto.HashToken(accept.Author), accept.Fee)
 }
@@ -51,6 +51,9 @@ func (accept *AcceptJoinRequest) Serialize() []byte {
 }
 
 func (accept *AcceptJoinRequest) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(accept, accept.Fee) {
+		return false
+	}
 	if !v.HasMember(crypto.HashToken(accept.Author)) {
 		return false
 	}
@@ -69,6 +72,27 @@ func (accept *AcceptJoinRequest) Validate(v InstructionValidator) bool {
 	return false
 }
 
+// ModerateSign signs the accept with the moderation key of the stage.
+func (accept *AcceptJoinRequest) ModerateSign(key crypto.PrivateKey) {
+	accept.ModSignature = key.Sign(accept.serialiazeModSign())
+}
+
+func (accept *AcceptJoinRequest) Sign(key crypto.PrivateKey) {
+	accept.Signature = key.Sign(accept.serialiazeSign())
+}
+
+func (accept *AcceptJoinRequest) AppendFee(wallet crypto.PrivateKey, fee uint64) {
+	token := wallet.PublicKey()
+	if token != accept.Author {
+		accept.Wallet = token
+	} else {
+		accept.Wallet = crypto.ZeroToken
+	}
+	accept.Fee = fee
+	bytes := accept.serializeWalletSign()
+	accept.WalletSignature = wallet.Sign(bytes)
+}
+
 func (create *AcceptJoinRequest) JSON() string {
 	bulk := genericJSON(IAcceptJoinRequest, create.EpochStamp, create.Fee, create.Author, create.Wallet, create.Attorney,
 		create.Signature, create.WalletSignature)
@@ -79,17 +103,17 @@ func (create *AcceptJoinRequest) JSON() string {
 		bulk.PutHex("read", create.Read[:])
 	}
 	if create.Submit != nil {
-		bulk.PutHex("submit", create.Read[:])
+		bulk.PutHex("submit", create.Submit[:])
 	}
 	if create.Moderate != nil {
-		bulk.PutHex("moderate", create.Read[:])
+		bulk.PutHex("moderate", create.Moderate[:])
 	}
 	bulk.PutHex("modSignature", create.ModSignature[:])
 	return bulk.ToString()
 }
 
 func (create *AcceptJoinRequest) serialiazeModSign() []byte {
-	bytes := []byte{0, IReact}
+	bytes := []byte{0, IAcceptJoinRequest}
 	util.PutUint64(create.EpochStamp, &bytes)
 	util.PutToken(create.Author, &bytes)
 	util.PutToken(create.Stage, &bytes)
@@ -117,7 +141,7 @@ func (create *AcceptJoinRequest) serializeWalletSign() []byte {
 
 func ParseAcceptJoinRequest(data []byte) *AcceptJoinRequest {
 	var position int
-	if data[0] != 0 || data[1] != IAcceptJoinRequest {
+	if len(data) < 2 || data[0] != 0 || data[1] != IAcceptJoinRequest {
 		return nil
 	}
 	accept := AcceptJoinRequest{}
@@ -130,6 +154,9 @@ func ParseAcceptJoinRequest(data []byte) *AcceptJoinRequest {
 	accept.Moderate, position = util.ParseByteArray(data, position)
 	accept.ModSignature, position = util.ParseSignature(data, position)
 	accept.Attorney, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	accept.Signature, position = util.ParseSignature(data, position)
 	if !checkSignature(msg, accept.Signature, accept.Attorney, accept.Author) {
@@ -137,6 +164,9 @@ func ParseAcceptJoinRequest(data []byte) *AcceptJoinRequest {
 	}
 	accept.Wallet, position = util.ParseToken(data, position)
 	accept.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg = data[0:position]
 	accept.WalletSignature, position = util.ParseSignature(data, position)
 	if !checkWalletSignature(msg, accept.WalletSignature, accept.Wallet, accept.Attorney, accept.Author) {
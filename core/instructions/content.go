@@ -10,6 +10,12 @@ import (
 // accordiing to a cipher defined by the stage. Stages can be moderated,
 // in which case only authors with submission right can publish content.
 // content lifecycle etc etc etc
+//
+// Content is included on the chain at EpochStamp but is embargoed until
+// Published: relays and indexers must not show it before that epoch. Only
+// moderated content may be published later than included, which gives the
+// moderators of the stage the time to review queued submissions and take down
+// those they do not approve. The embargo cannot exceed MaxEmbargo epochs.
 type Content struct {
 	EpochStamp      uint64
 	Published       uint64
@@ -20,6 +26,8 @@ type Content struct {
 	Hash            []byte
 	Sponsored       bool
 	Encrypted       bool
+	Reply           crypto.Hash // hash of the content replied to, zero if none
+	BlobSize        uint64      // size of the off-chain blob whose root is Hash
 	SubSignature    crypto.Signature
 	Moderator       crypto.Token
 	ModSignature    crypto.Signature
@@ -37,15 +45,67 @@ func (content *Content) Serialize() []byte {
 	return bytes
 }
 
+// ContentReplyVersion is the serialization version of content replying to
+// other content. ContentBlobVersion is the version of content whose payload is
+// an off-chain blob: Content is empty, Hash is the root hash of the blob and
+// BlobSize its size. Content without reply nor blob keeps version zero, so that
+// content serialized before those fields existed still parses.
+const (
+	ContentReplyVersion = 1
+	ContentBlobVersion  = 2
+)
+
+// MaxEmbargo is the maximum number of epochs content may be embargoed after
+// its EpochStamp, roughly a week of one second epochs.
+const MaxEmbargo = 7 * 24 * 60 * 60
+
+// IsReply checks if the content replies to other content.
+func (content *Content) IsReply() bool {
+	return content.Reply != crypto.Hash{}
+}
+
+// IsBlob checks if the payload of the content is an off-chain blob.
+func (content *Content) IsBlob() bool {
+	return content.BlobSize > 0
+}
+
+func (content *Content) version() byte {
+	if content.IsBlob() {
+		return ContentBlobVersion
+	}
+	if content.IsReply() {
+		return ContentReplyVersion
+	}
+	return 0
+}
+
+// StageContentHash is the hash under which the validator keeps content
+// published on a stage, so that replies can be checked to be on the same
+// stage as their parent.
+func StageContentHash(stage crypto.Token, hash crypto.Hash) crypto.Hash {
+	return crypto.Hasher(append(stage[:], hash[:]...))
+}
+
 func (content *Content) Kind() byte {
 	return IContent
 }
 
+// validEmbargo checks that the content is published neither before it is
+// stamped nor more than MaxEmbargo epochs after.
+func (content *Content) validEmbargo() bool {
+	return content.Published >= content.EpochStamp && content.Published-content.EpochStamp <= MaxEmbargo
+}
+
+// Embargoed checks if the content is not yet visible at epoch.
+func (content *Content) Embargoed(epoch uint64) bool {
+	return epoch < content.Published
+}
+
 func (a *Content) Payments() *Payment {
-	if len(a.Wallet) > 0 {
+	if a.Wallet != crypto.ZeroToken {
 		return NewPayment(crypto.HashToken(a.Wallet), a.Fee)
 	}
-	if len(a.Attorney) > 0 {
+	if a.Attorney != crypto.ZeroToken {
 		return NewPayment(crypto.HashToken(a.Attorney), a.Fee)
 	}
 	return NewPayment(crypto.HashToken(a.Author), a.Fee)
@@ -63,7 +123,10 @@ func (a *Content) Epoch() uint64 {
 }
 
 func (content *Content) Validate(v InstructionValidator) bool {
-	if content.EpochStamp > v.Epoch() {
+	if !paysMinimumFee(content, content.Fee) {
+		return false
+	}
+	if content.EpochStamp > v.Epoch() || !content.validEmbargo() {
 		return false
 	}
 	if !v.HasMember(crypto.HashToken(content.Author)) {
@@ -74,12 +137,18 @@ func (content *Content) Validate(v InstructionValidator) bool {
 	if stageKeys == nil {
 		return false
 	}
+	if content.IsBlob() && (len(content.Content) != 0 || len(content.Hash) != crypto.Size) {
+		return false
+	}
+	if content.IsReply() && !v.HasContent(StageContentHash(content.Stage, content.Reply)) {
+		return false
+	}
 	payments := content.Payments()
 	if content.Sponsored {
 		if content.Encrypted {
 			return false
 		}
-		if len(content.SubSignature) != 0 || len(content.ModSignature) != 0 {
+		if content.SubSignature != (crypto.Signature{}) || content.ModSignature != (crypto.Signature{}) {
 			return false
 		}
 		hash := crypto.Hasher(append(content.Author[:], content.Stage[:]...))
@@ -90,7 +159,7 @@ func (content *Content) Validate(v InstructionValidator) bool {
 		if !crypto.Hasher(content.Content).Equal(contentHash) {
 			return false
 		}
-		if v.SetPublishSponsor(hash) && v.CanPay(payments) {
+		if v.SetPublishSponsor(hash) && v.CanPay(payments) && content.setNewContent(v) {
 			v.AddFeeCollected(content.Fee)
 			return true
 		}
@@ -100,20 +169,27 @@ func (content *Content) Validate(v InstructionValidator) bool {
 		return false
 	}
 	if content.Moderator != crypto.ZeroToken {
-		if !stageKeys.Moderate.Verify(content.serializeModBulk(), content.ModSignature) {
+		if content.Moderator != stageKeys.Moderate || !stageKeys.Moderate.Verify(content.serializeModBulk(), content.ModSignature) {
 			return false
 		}
 	}
-	if v.CanPay(payments) {
+	if v.CanPay(payments) && content.setNewContent(v) {
 		v.AddFeeCollected(content.Fee)
 		return true
 	}
 	return false
 }
 
+// setNewContent registers the hash of the serialized instruction, by which
+// reactions and replies refer to the content, both alone and on its stage.
+func (content *Content) setNewContent(v InstructionValidator) bool {
+	hash := crypto.Hasher(content.Serialize())
+	return v.SetNewContent(hash) && v.SetNewContent(StageContentHash(content.Stage, hash))
+}
+
 func (content *Content) JSON() string {
 	bulk := &util.JSONBuilder{}
-	bulk.PutUint64("version", 0)
+	bulk.PutUint64("version", uint64(content.version()))
 	bulk.PutUint64("instructionType", uint64(IContent))
 	bulk.PutUint64("epoch", content.EpochStamp)
 	bulk.PutUint64("published", content.Published)
@@ -122,6 +198,12 @@ func (content *Content) JSON() string {
 	bulk.PutString("contentType", content.ContentType)
 	bulk.PutBase64("content", content.Content)
 	bulk.PutHex("hash", content.Hash)
+	if content.IsReply() {
+		bulk.PutHex("reply", content.Reply[:])
+	}
+	if content.IsBlob() {
+		bulk.PutUint64("blobSize", content.BlobSize)
+	}
 	if content.Wallet != crypto.ZeroToken {
 		bulk.PutHex("wallet", content.Wallet[:])
 	}
@@ -137,7 +219,7 @@ func (content *Content) JSON() string {
 func (content *Content) SubmitSign(key crypto.PrivateKey) {
 	data := content.serializeSubBulk()
 	// ignore EpochStamp on subsignature
-	content.Signature = key.Sign(data[10:])
+	content.SubSignature = key.Sign(data[10:])
 }
 
 func (content *Content) ModerateSign(key crypto.PrivateKey) {
@@ -151,16 +233,17 @@ func (content *Content) Sign(key crypto.PrivateKey, attorney crypto.Token) {
 	content.Signature = key.Sign(data)
 }
 
-func (content *Content) AppendFee(fee uint64, wallet crypto.PrivateKey) {
+func (content *Content) AppendFee(wallet crypto.PrivateKey, fee uint64) {
 	content.Wallet = wallet.PublicKey()
 	content.Fee = fee
 	data := content.serializeWalletBulk()
 	content.WalletSignature = wallet.Sign(data)
 }
 
-// partial serialization up to the Encrypted field
+// partial serialization up to the Encrypted field, or the Reply field of
+// version one, or the BlobSize field of version two
 func (content *Content) serializeSubBulk() []byte {
-	bytes := []byte{0, IContent}
+	bytes := []byte{content.version(), IContent}
 	util.PutUint64(content.EpochStamp, &bytes)
 	util.PutUint64(content.Published, &bytes)
 	util.PutToken(content.Author, &bytes)
@@ -170,6 +253,12 @@ func (content *Content) serializeSubBulk() []byte {
 	util.PutByteArray(content.Hash, &bytes)
 	util.PutBool(content.Sponsored, &bytes)
 	util.PutBool(content.Encrypted, &bytes)
+	if version := content.version(); version >= ContentReplyVersion {
+		util.PutByteArray(content.Reply[:], &bytes)
+		if version == ContentBlobVersion {
+			util.PutUint64(content.BlobSize, &bytes)
+		}
+	}
 	return bytes
 }
 
@@ -199,7 +288,7 @@ func (content *Content) serializeWalletBulk() []byte {
 }
 
 func ParseContent(data []byte) *Content {
-	if data[0] != 0 || data[1] != IContent {
+	if len(data) < 2 || data[0] > ContentBlobVersion || data[1] != IContent {
 		return nil
 	}
 	var content Content
@@ -213,18 +302,33 @@ func ParseContent(data []byte) *Content {
 	content.Hash, position = util.ParseByteArray(data, position)
 	content.Sponsored, position = util.ParseBool(data, position)
 	content.Encrypted, position = util.ParseBool(data, position)
+	if data[0] >= ContentReplyVersion {
+		content.Reply, position = util.ParseHash(data, position)
+		if data[0] == ContentReplyVersion && !content.IsReply() {
+			return nil
+		}
+	}
+	if data[0] == ContentBlobVersion {
+		content.BlobSize, position = util.ParseUint64(data, position)
+		if !content.IsBlob() {
+			return nil
+		}
+	}
 	content.SubSignature, position = util.ParseSignature(data, position)
 	content.Moderator, position = util.ParseToken(data, position)
 	content.ModSignature, position = util.ParseSignature(data, position)
-	if len(content.Moderator) == 0 && (content.EpochStamp != content.Published) {
+	if content.Moderator == crypto.ZeroToken && (content.EpochStamp != content.Published) {
 		return nil
 	}
 	content.Attorney, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	token := content.Author
-	if len(content.Attorney) > 0 {
+	if content.Attorney != crypto.ZeroToken {
 		token = content.Attorney
-	} else if len(content.Moderator) > 0 {
+	} else if content.Moderator != crypto.ZeroToken {
 		token = content.Moderator
 	}
 	content.Signature, position = util.ParseSignature(data, position)
@@ -233,13 +337,19 @@ func ParseContent(data []byte) *Content {
 	}
 	content.Wallet, position = util.ParseToken(data, position)
 	content.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg = data[0:position]
-	content.WalletSignature, _ = util.ParseSignature(data, position)
+	content.WalletSignature, position = util.ParseSignature(data, position)
 	if content.Wallet != crypto.ZeroToken {
 		token = content.Wallet
 	}
 	if !token.Verify(msg, content.WalletSignature) {
 		return nil
 	}
+	if position != len(data) {
+		return nil
+	}
 	return &content
 }
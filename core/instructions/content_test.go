@@ -0,0 +1,113 @@
+package instructions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+func newContent(author crypto.PrivateKey, reply crypto.Hash) *Content {
+	_, stage := crypto.RandomAsymetricKey()
+	content := Content{
+		EpochStamp:  12,
+		Published:   12,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		ContentType: "text",
+		Content:     []byte("aereum"),
+		Hash:        []byte{1, 2, 3},
+		Reply:       reply,
+	}
+	content.SubmitSign(stage)
+	content.Sign(author, crypto.ZeroToken)
+	content.AppendFee(author, 1000)
+	return &content
+}
+
+func TestContentParse(t *testing.T) {
+	_, author := crypto.RandomAsymetricKey()
+	content := newContent(author, crypto.Hash{})
+	bytes := content.Serialize()
+	if bytes[0] != 0 {
+		t.Error("content without reply should keep version zero")
+	}
+	parsed, ok := ParseInstruction(bytes).(*Content)
+	if !ok || !reflect.DeepEqual(*content, *parsed) {
+		t.Error("content parsing or serializing is broken")
+	}
+}
+
+func TestContentReplyParse(t *testing.T) {
+	_, author := crypto.RandomAsymetricKey()
+	parent := crypto.Hasher(newContent(author, crypto.Hash{}).Serialize())
+	reply := newContent(author, parent)
+	bytes := reply.Serialize()
+	if bytes[0] != ContentReplyVersion {
+		t.Error("reply should be serialized with reply version")
+	}
+	parsed, ok := ParseInstruction(bytes).(*Content)
+	if !ok || !reflect.DeepEqual(*reply, *parsed) || parsed.Reply != parent {
+		t.Error("reply parsing or serializing is broken")
+	}
+	bytes[0] = 0
+	if ParseContent(bytes) != nil {
+		t.Error("reply parsed with version zero")
+	}
+}
+
+func TestContentBlobParse(t *testing.T) {
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	root := crypto.Hasher([]byte("chunks"))
+	content := Content{
+		EpochStamp:  12,
+		Published:   12,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		ContentType: "video/mp4",
+		Content:     []byte{},
+		Hash:        root[:],
+		BlobSize:    1 << 30,
+	}
+	content.SubmitSign(stage)
+	content.Sign(author, crypto.ZeroToken)
+	content.AppendFee(author, 1000)
+	bytes := content.Serialize()
+	if bytes[0] != ContentBlobVersion {
+		t.Error("blob content should be serialized with blob version")
+	}
+	parsed, ok := ParseInstruction(bytes).(*Content)
+	if !ok || !reflect.DeepEqual(content, *parsed) {
+		t.Error("blob content parsing or serializing is broken")
+	}
+}
+
+func TestContentEmbargo(t *testing.T) {
+	tests := []struct {
+		published uint64
+		valid     bool
+	}{
+		{published: 11, valid: false},
+		{published: 12, valid: true},
+		{published: 12 + MaxEmbargo, valid: true},
+		{published: 13 + MaxEmbargo, valid: false},
+		{published: ^uint64(0), valid: false},
+	}
+	for _, test := range tests {
+		content := Content{EpochStamp: 12, Published: test.published}
+		if content.validEmbargo() != test.valid {
+			t.Errorf("embargo until %v: expected valid %v", test.published, test.valid)
+		}
+	}
+}
+
+func TestParseInstructionTruncated(t *testing.T) {
+	_, author := crypto.RandomAsymetricKey()
+	bytes := newContent(author, crypto.Hasher([]byte("parent"))).Serialize()
+	for n := 0; n < len(bytes); n++ {
+		if ParseInstruction(bytes[:n]) != nil {
+			t.Fatalf("content truncated to %v bytes parsed", n)
+		}
+	}
+}
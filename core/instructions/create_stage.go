@@ -37,7 +37,7 @@ func (create *CreateStage) Payments() *Payment {
 		return NewPayment(crypto.HashToken(create.Wallet), create.Fee)
 	}
 	if create.Attorney != crypto.ZeroToken {
-		return NewPayment(crypto.HashToken(create.Wallet), create.Fee)
+		return NewPayment(crypto.HashToken(create.Attorney), create.Fee)
 	}
 	return NewPayment(crypto.HashToken(create.Author), create.Fee)
 }
@@ -49,6 +49,9 @@ func (create *CreateStage) Serialize() []byte {
 }
 
 func (stage *CreateStage) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(stage, stage.Fee) {
+		return false
+	}
 	if !v.HasMember(crypto.HashToken(stage.Author)) {
 		return false
 	}
@@ -71,6 +74,22 @@ func (stage *CreateStage) Validate(v InstructionValidator) bool {
 	return false
 }
 
+func (create *CreateStage) Sign(key crypto.PrivateKey) {
+	create.Signature = key.Sign(create.serialiazeSign())
+}
+
+func (create *CreateStage) AppendFee(wallet crypto.PrivateKey, fee uint64) {
+	token := wallet.PublicKey()
+	if token != create.Author {
+		create.Wallet = token
+	} else {
+		create.Wallet = crypto.ZeroToken
+	}
+	create.Fee = fee
+	bytes := create.serializeWalletSign()
+	create.WalletSignature = wallet.Sign(bytes)
+}
+
 func (create *CreateStage) JSON() string {
 	bulk := genericJSON(ICreateStage, create.EpochStamp, create.Fee, create.Author, create.Wallet, create.Attorney,
 		create.Signature, create.WalletSignature)
@@ -83,7 +102,7 @@ func (create *CreateStage) JSON() string {
 }
 
 func (create *CreateStage) serialiazeSign() []byte {
-	bytes := []byte{0, IReact}
+	bytes := []byte{0, ICreateStage}
 	util.PutUint64(create.EpochStamp, &bytes)
 	util.PutToken(create.Author, &bytes)
 	util.PutToken(create.Stage, &bytes)
@@ -105,7 +124,7 @@ func (create *CreateStage) serializeWalletSign() []byte {
 
 func ParseCreateStage(data []byte) *CreateStage {
 	var position int
-	if data[0] != 0 || data[1] != ICreateStage {
+	if len(data) < 2 || data[0] != 0 || data[1] != ICreateStage {
 		return nil
 	}
 	join := CreateStage{}
@@ -116,6 +135,9 @@ func ParseCreateStage(data []byte) *CreateStage {
 	join.Flag, position = util.ParseByte(data, position)
 	join.Description, position = util.ParseString(data, position)
 	join.Attorney, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	join.Signature, position = util.ParseSignature(data, position)
 	if !checkSignature(msg, join.Signature, join.Attorney, join.Author) {
@@ -123,6 +145,9 @@ func ParseCreateStage(data []byte) *CreateStage {
 	}
 	join.Wallet, position = util.ParseToken(data, position)
 	join.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg = data[0:position]
 	join.WalletSignature, position = util.ParseSignature(data, position)
 	if !checkWalletSignature(msg, join.WalletSignature, join.Wallet, join.Attorney, join.Author) {
@@ -45,6 +45,9 @@ func (d *Deposit) Payments() *Payment {
 }
 
 func (d *Deposit) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(d, d.Fee) {
+		return false
+	}
 	payments := d.Payments()
 	if v.CanPay(payments) {
 		v.AddFeeCollected(d.Fee)
@@ -81,10 +84,16 @@ func ParseDeposit(data []byte) *Deposit {
 	p.Token, position = util.ParseToken(data, position)
 	p.Value, position = util.ParseUint64(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msgToVerify := data[0:position]
-	p.Signature, _ = util.ParseSignature(data, position)
+	p.Signature, position = util.ParseSignature(data, position)
 	if !p.Token.Verify(msgToVerify, p.Signature) {
 		return nil
 	}
+	if position != len(data) {
+		return nil
+	}
 	return &p
 }
@@ -20,6 +20,7 @@ const (
 	ICreateEphemeral
 	ISecureChannel
 	IReact
+	ITakedown
 	iUnkown
 )
 
@@ -43,24 +44,66 @@ type Instruction interface {
 
 // ParseInstructions tries to parse a byte slice into an valid instruction.
 // Instructions are not validated according to blockchain state at this stage,
-// but signatures are checked.
+// but signatures are checked. It returns nil, and not a nil instruction of a
+// kind, on malformed data.
 func ParseInstruction(data []byte) Instruction {
+	if len(data) < 2 {
+		return nil
+	}
+	if data[0] != 0 && data[0] <= ContentBlobVersion && data[1] == IContent {
+		if instruction := ParseContent(data); instruction != nil {
+			return instruction
+		}
+	}
+	if data[0] == UpdateStageVersion && data[1] == IUpdateStage {
+		if instruction := ParseUpdateStage(data); instruction != nil {
+			return instruction
+		}
+	}
 	if data[0] != 0 {
 		return nil
 	}
 	switch data[1] {
+	case ICreateStage:
+		if instruction := ParseCreateStage(data); instruction != nil {
+			return instruction
+		}
 	case IJoinStage:
-		return ParseJoinStage(data)
+		if instruction := ParseJoinStage(data); instruction != nil {
+			return instruction
+		}
+	case IAcceptJoinRequest:
+		if instruction := ParseAcceptJoinRequest(data); instruction != nil {
+			return instruction
+		}
+	case IUpdateStage:
+		if instruction := ParseUpdateStage(data); instruction != nil {
+			return instruction
+		}
 	case IContent:
-		return ParseContent(data)
+		if instruction := ParseContent(data); instruction != nil {
+			return instruction
+		}
 	case ITransfer:
-		return ParseTransfer(data)
+		if instruction := ParseTransfer(data); instruction != nil {
+			return instruction
+		}
 	case IDeposit:
-		return ParseDeposit(data)
+		if instruction := ParseDeposit(data); instruction != nil {
+			return instruction
+		}
 	case IWithdraw:
-		return ParseWithdraw(data)
+		if instruction := ParseWithdraw(data); instruction != nil {
+			return instruction
+		}
 	case IReact:
-		return ParseReact(data)
+		if instruction := ParseReact(data); instruction != nil {
+			return instruction
+		}
+	case ITakedown:
+		if instruction := ParseTakedown(data); instruction != nil {
+			return instruction
+		}
 	}
 	return nil
 }
@@ -35,7 +35,7 @@ func (join *JoinStage) Payments() *Payment {
 		return NewPayment(crypto.HashToken(join.Wallet), join.Fee)
 	}
 	if join.Attorney != crypto.ZeroToken {
-		return NewPayment(crypto.HashToken(join.Wallet), join.Fee)
+		return NewPayment(crypto.HashToken(join.Attorney), join.Fee)
 	}
 	return NewPayment(crypto.HashToken(join.Author), join.Fee)
 }
@@ -47,6 +47,9 @@ func (join *JoinStage) Serialize() []byte {
 }
 
 func (join *JoinStage) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(join, join.Fee) {
+		return false
+	}
 	if !v.HasMember(crypto.HashToken(join.Author)) {
 		return false
 	}
@@ -60,6 +63,22 @@ func (join *JoinStage) Validate(v InstructionValidator) bool {
 	return false
 }
 
+func (join *JoinStage) Sign(key crypto.PrivateKey) {
+	join.Signature = key.Sign(join.serialiazeSign())
+}
+
+func (join *JoinStage) AppendFee(wallet crypto.PrivateKey, fee uint64) {
+	token := wallet.PublicKey()
+	if token != join.Author {
+		join.Wallet = token
+	} else {
+		join.Wallet = crypto.ZeroToken
+	}
+	join.Fee = fee
+	bytes := join.serializeWalletSign()
+	join.WalletSignature = wallet.Sign(bytes)
+}
+
 func (join *JoinStage) JSON() string {
 	bulk := genericJSON(IJoinStage, join.EpochStamp, join.Fee, join.Author, join.Wallet, join.Attorney,
 		join.Signature, join.WalletSignature)
@@ -70,7 +89,7 @@ func (join *JoinStage) JSON() string {
 }
 
 func (join *JoinStage) serialiazeSign() []byte {
-	bytes := []byte{0, IReact}
+	bytes := []byte{0, IJoinStage}
 	util.PutUint64(join.EpochStamp, &bytes)
 	util.PutToken(join.Author, &bytes)
 	util.PutToken(join.Stage, &bytes)
@@ -90,7 +109,7 @@ func (join *JoinStage) serializeWalletSign() []byte {
 
 func ParseJoinStage(data []byte) *JoinStage {
 	var position int
-	if data[0] != 0 || data[1] != IJoinStage {
+	if len(data) < 2 || data[0] != 0 || data[1] != IJoinStage {
 		return nil
 	}
 	join := JoinStage{}
@@ -99,6 +118,9 @@ func ParseJoinStage(data []byte) *JoinStage {
 	join.DiffHellKey, position = util.ParseToken(data, position)
 	join.Presentation, position = util.ParseString(data, position)
 	join.Attorney, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	join.Signature, position = util.ParseSignature(data, position)
 	if !checkSignature(msg, join.Signature, join.Attorney, join.Author) {
@@ -106,6 +128,9 @@ func ParseJoinStage(data []byte) *JoinStage {
 	}
 	join.Wallet, position = util.ParseToken(data, position)
 	join.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg = data[0:position]
 	join.WalletSignature, position = util.ParseSignature(data, position)
 	if !checkWalletSignature(msg, join.WalletSignature, join.Wallet, join.Attorney, join.Author) {
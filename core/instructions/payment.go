@@ -2,6 +2,41 @@ package instructions
 
 import "github.com/lienkolabs/aereum/core/crypto"
 
+// MinimumFeePerByte is the protocol minimum fee per byte of serialized
+// instruction. Instructions paying less than that are rejected on validation.
+const MinimumFeePerByte = 1
+
+// MinimumFee returns the protocol minimum fee of an instruction serialized
+// into size bytes.
+func MinimumFee(size int) uint64 {
+	return uint64(size) * MinimumFeePerByte
+}
+
+func paysMinimumFee(instruction Instruction, fee uint64) bool {
+	return fee >= MinimumFee(len(instruction.Serialize()))
+}
+
+// FeePayer is implemented by instructions whose fee can be paid by a wallet
+// signature appended to the instruction.
+type FeePayer interface {
+	AppendFee(wallet crypto.PrivateKey, fee uint64)
+}
+
+// AppendWalletFee appends to the instruction a fee of feePerByte for every
+// byte of its serialization, paid and signed by wallet. It returns false if
+// the instruction cannot be paid by a wallet.
+func AppendWalletFee(instruction Instruction, wallet crypto.PrivateKey, feePerByte uint64) bool {
+	payer, ok := instruction.(FeePayer)
+	if !ok {
+		return false
+	}
+	if feePerByte < MinimumFeePerByte {
+		feePerByte = MinimumFeePerByte
+	}
+	payer.AppendFee(wallet, feePerByte*uint64(len(instruction.Serialize())))
+	return true
+}
+
 type Wallet struct {
 	Account        crypto.Hash
 	FungibleTokens uint64
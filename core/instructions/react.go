@@ -5,6 +5,10 @@ import (
 	"github.com/lienkolabs/aereum/core/util"
 )
 
+// React is the reaction of an author to a content instruction on the chain.
+// The chain keeps every reaction: an author may react to the same content more
+// than once, and keeping a single reaction per author, the latest, is only a
+// convention of indexers.
 type React struct {
 	EpochStamp      uint64
 	Author          crypto.Token
@@ -18,7 +22,7 @@ type React struct {
 }
 
 func (react *React) Kind() byte {
-	return IContent
+	return IReact
 }
 
 func (react *React) Authority() crypto.Token {
@@ -34,12 +38,19 @@ func (react *React) Payments() *Payment {
 		return NewPayment(crypto.HashToken(react.Wallet), react.Fee)
 	}
 	if react.Attorney != crypto.ZeroToken {
-		return NewPayment(crypto.HashToken(react.Wallet), react.Fee)
+		return NewPayment(crypto.HashToken(react.Attorney), react.Fee)
 	}
 	return NewPayment(crypto.HashToken(react.Author), react.Fee)
 }
 
 func (react *React) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(react, react.Fee) {
+		return false
+	}
+	// reactions must refer to the hash of a content instruction on the chain
+	if len(react.Hash) != crypto.Size || !v.HasContent(crypto.BytesToHash(react.Hash)) {
+		return false
+	}
 	if v.HasMember(crypto.HashToken(react.Author)) && v.CanPay(react.Payments()) {
 		v.AddFeeCollected(react.Fee)
 		return true
@@ -90,7 +101,7 @@ func (react *React) serializeWalletSign() []byte {
 
 func ParseReact(data []byte) *React {
 	var position int
-	if data[0] != 0 || data[1] != IReact {
+	if len(data) < 2 || data[0] != 0 || data[1] != IReact {
 		return nil
 	}
 	react := React{}
@@ -98,6 +109,9 @@ func ParseReact(data []byte) *React {
 	react.Hash, position = util.ParseByteArray(data, position)
 	react.Reaction, position = util.ParseByte(data, position)
 	react.Attorney, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	react.Signature, position = util.ParseSignature(data, position)
 	if !checkSignature(msg, react.Signature, react.Attorney, react.Author) {
@@ -106,6 +120,9 @@ func ParseReact(data []byte) *React {
 
 	react.Wallet, position = util.ParseToken(data, position)
 	react.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg = data[0:position]
 	react.WalletSignature, position = util.ParseSignature(data, position)
 	if !checkWalletSignature(msg, react.WalletSignature, react.Wallet, react.Attorney, react.Author) {
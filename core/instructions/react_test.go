@@ -44,3 +44,23 @@ func TestReactAttorney(t *testing.T) {
 		t.Error("React parsing or searializing is broken without wallet")
 	}
 }
+
+func TestReactPayments(t *testing.T) {
+	author, _ := crypto.RandomAsymetricKey()
+	attorney, _ := crypto.RandomAsymetricKey()
+	wallet, _ := crypto.RandomAsymetricKey()
+	tests := []struct {
+		react React
+		payer crypto.Token
+	}{
+		{React{Author: author, Fee: 10}, author},
+		{React{Author: author, Attorney: attorney, Fee: 10}, attorney},
+		{React{Author: author, Attorney: attorney, Wallet: wallet, Fee: 10}, wallet},
+	}
+	for _, test := range tests {
+		debit := test.react.Payments().Debit
+		if len(debit) != 1 || debit[0].Account != crypto.HashToken(test.payer) || debit[0].FungibleTokens != 10 {
+			t.Errorf("wrong payer of reaction %+v", debit)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package instructions
+
+import (
+	"strconv"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// Reason codes of a Takedown.
+const (
+	TakedownOther byte = iota
+	TakedownSpam
+	TakedownAbuse
+	TakedownIllegal
+	TakedownOffTopic
+)
+
+// Takedown is signed by the moderation key of a stage to flag, or to hide,
+// content previously published on the stage. The content stays on the chain
+// but indexers and relays honour the takedown.
+type Takedown struct {
+	EpochStamp      uint64
+	Stage           crypto.Token
+	Content         crypto.Hash // hash of the content instruction
+	Reason          byte
+	Hide            bool // hide the content rather than flag it
+	Moderator       crypto.Token
+	Signature       crypto.Signature
+	Wallet          crypto.Token
+	Fee             uint64
+	WalletSignature crypto.Signature
+}
+
+func (takedown *Takedown) Kind() byte {
+	return ITakedown
+}
+
+func (takedown *Takedown) Authority() crypto.Token {
+	return takedown.Moderator
+}
+
+func (takedown *Takedown) Epoch() uint64 {
+	return takedown.EpochStamp
+}
+
+func (takedown *Takedown) Payments() *Payment {
+	if takedown.Wallet != crypto.ZeroToken {
+		return NewPayment(crypto.HashToken(takedown.Wallet), takedown.Fee)
+	}
+	return NewPayment(crypto.HashToken(takedown.Moderator), takedown.Fee)
+}
+
+func (takedown *Takedown) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(takedown, takedown.Fee) {
+		return false
+	}
+	if takedown.EpochStamp > v.Epoch() {
+		return false
+	}
+	keys := v.GetAudienceKeys(crypto.HashToken(takedown.Stage))
+	if keys == nil || keys.Moderate == crypto.ZeroToken || keys.Moderate != takedown.Moderator {
+		return false
+	}
+	if !v.HasContent(StageContentHash(takedown.Stage, takedown.Content)) {
+		return false
+	}
+	if v.CanPay(takedown.Payments()) {
+		v.AddFeeCollected(takedown.Fee)
+		return true
+	}
+	return false
+}
+
+func (takedown *Takedown) Serialize() []byte {
+	bytes := takedown.serializeWalletSign()
+	util.PutSignature(takedown.WalletSignature, &bytes)
+	return bytes
+}
+
+// Sign signs the takedown with the moderation key of the stage.
+func (takedown *Takedown) Sign(moderator crypto.PrivateKey) {
+	takedown.Moderator = moderator.PublicKey()
+	takedown.Signature = moderator.Sign(takedown.serializeSign())
+}
+
+func (takedown *Takedown) AppendFee(wallet crypto.PrivateKey, fee uint64) {
+	token := wallet.PublicKey()
+	if token != takedown.Moderator {
+		takedown.Wallet = token
+	} else {
+		takedown.Wallet = crypto.ZeroToken
+	}
+	takedown.Fee = fee
+	takedown.WalletSignature = wallet.Sign(takedown.serializeWalletSign())
+}
+
+func (takedown *Takedown) serializeSign() []byte {
+	bytes := []byte{0, ITakedown}
+	util.PutUint64(takedown.EpochStamp, &bytes)
+	util.PutToken(takedown.Stage, &bytes)
+	util.PutByteArray(takedown.Content[:], &bytes)
+	util.PutByte(takedown.Reason, &bytes)
+	util.PutBool(takedown.Hide, &bytes)
+	util.PutToken(takedown.Moderator, &bytes)
+	return bytes
+}
+
+func (takedown *Takedown) serializeWalletSign() []byte {
+	bytes := takedown.serializeSign()
+	util.PutSignature(takedown.Signature, &bytes)
+	util.PutToken(takedown.Wallet, &bytes)
+	util.PutUint64(takedown.Fee, &bytes)
+	return bytes
+}
+
+func ParseTakedown(data []byte) *Takedown {
+	if len(data) < 2 || data[0] != 0 || data[1] != ITakedown {
+		return nil
+	}
+	takedown := Takedown{}
+	position := 2
+	takedown.EpochStamp, position = util.ParseUint64(data, position)
+	takedown.Stage, position = util.ParseToken(data, position)
+	takedown.Content, position = util.ParseHash(data, position)
+	takedown.Reason, position = util.ParseByte(data, position)
+	takedown.Hide, position = util.ParseBool(data, position)
+	takedown.Moderator, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
+	msg := data[0:position]
+	takedown.Signature, position = util.ParseSignature(data, position)
+	if !takedown.Moderator.Verify(msg, takedown.Signature) {
+		return nil
+	}
+	takedown.Wallet, position = util.ParseToken(data, position)
+	takedown.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
+	msg = data[0:position]
+	takedown.WalletSignature, position = util.ParseSignature(data, position)
+	if !checkWalletSignature(msg, takedown.WalletSignature, takedown.Wallet, crypto.ZeroToken, takedown.Moderator) {
+		return nil
+	}
+	if position != len(data) {
+		return nil
+	}
+	return &takedown
+}
+
+func (takedown *Takedown) JSON() string {
+	bulk := genericJSON(ITakedown, takedown.EpochStamp, takedown.Fee, takedown.Moderator, takedown.Wallet,
+		crypto.ZeroToken, takedown.Signature, takedown.WalletSignature)
+	bulk.PutHex("stage", takedown.Stage[:])
+	bulk.PutHex("content", takedown.Content[:])
+	bulk.PutUint64("reason", uint64(takedown.Reason))
+	bulk.PutJSON("hide", strconv.FormatBool(takedown.Hide))
+	return bulk.ToString()
+}
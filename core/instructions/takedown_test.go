@@ -0,0 +1,80 @@
+package instructions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+func TestTakedownParse(t *testing.T) {
+	_, stage := crypto.RandomAsymetricKey()
+	_, moderator := crypto.RandomAsymetricKey()
+	_, wallet := crypto.RandomAsymetricKey()
+	takedown := Takedown{
+		EpochStamp: 20,
+		Stage:      stage.PublicKey(),
+		Content:    crypto.Hasher([]byte("content")),
+		Reason:     TakedownSpam,
+		Hide:       true,
+	}
+	takedown.Sign(moderator)
+	takedown.AppendFee(wallet, 1000)
+
+	bytes := takedown.Serialize()
+	parsed, ok := ParseInstruction(bytes).(*Takedown)
+	if !ok || !reflect.DeepEqual(takedown, *parsed) {
+		t.Error("takedown parsing or serializing is broken")
+	}
+	bytes[len(bytes)-100] ^= 1
+	if ParseTakedown(bytes) != nil {
+		t.Error("takedown with invalid signature parsed")
+	}
+}
+
+// takedownValidator knows of a stage and of the contents published on it.
+// Methods not needed to validate a takedown are left to the nil interface.
+type takedownValidator struct {
+	InstructionValidator
+	stages    map[crypto.Hash]*StageKeys
+	contents  map[crypto.Hash]struct{}
+	collected uint64
+}
+
+func (v *takedownValidator) Epoch() uint64                               { return 30 }
+func (v *takedownValidator) CanPay(payments *Payment) bool               { return true }
+func (v *takedownValidator) AddFeeCollected(fee uint64)                  { v.collected += fee }
+func (v *takedownValidator) GetAudienceKeys(hash crypto.Hash) *StageKeys { return v.stages[hash] }
+
+func (v *takedownValidator) HasContent(hash crypto.Hash) bool {
+	_, ok := v.contents[hash]
+	return ok
+}
+
+func TestTakedownValidate(t *testing.T) {
+	_, stage := crypto.RandomAsymetricKey()
+	_, moderator := crypto.RandomAsymetricKey()
+	_, other := crypto.RandomAsymetricKey()
+	content := crypto.Hasher([]byte("content"))
+	validator := &takedownValidator{
+		stages: map[crypto.Hash]*StageKeys{
+			crypto.HashToken(stage.PublicKey()): {Stage: stage.PublicKey(), Moderate: moderator.PublicKey()},
+		},
+		contents: map[crypto.Hash]struct{}{StageContentHash(stage.PublicKey(), content): {}},
+	}
+	takedown := func(key crypto.PrivateKey, content crypto.Hash) *Takedown {
+		takedown := Takedown{EpochStamp: 20, Stage: stage.PublicKey(), Content: content, Reason: TakedownSpam}
+		takedown.Sign(key)
+		takedown.AppendFee(key, 1000)
+		return ParseTakedown(takedown.Serialize())
+	}
+	if !takedown(moderator, content).Validate(validator) || validator.collected != 1000 {
+		t.Error("takedown by the moderator rejected")
+	}
+	if takedown(other, content).Validate(validator) {
+		t.Error("takedown by a non moderator accepted")
+	}
+	if takedown(moderator, crypto.Hasher([]byte("unknown"))).Validate(validator) {
+		t.Error("takedown of unknown content accepted")
+	}
+}
@@ -65,6 +65,9 @@ func (t *Transfer) Payments() *Payment {
 }
 
 func (t *Transfer) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(t, t.Fee) {
+		return false
+	}
 	payments := t.Payments()
 	if v.CanPay(payments) {
 		v.AddFeeCollected(t.Fee)
@@ -108,10 +111,16 @@ func ParseTransfer(data []byte) *Transfer {
 	}
 	p.Reason, position = util.ParseString(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
-	p.Signature, _ = util.ParseSignature(data, position)
+	p.Signature, position = util.ParseSignature(data, position)
 	if !p.From.Verify(msg, p.Signature) {
 		return nil
 	}
+	if position != len(data) {
+		return nil
+	}
 	return &p
 }
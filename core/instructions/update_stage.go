@@ -25,6 +25,23 @@ type UpdateStage struct {
 	WalletSignature crypto.Signature
 }
 
+// UpdateStageVersion is the serialization version of updates signed by the key
+// of the stage, which carry DiffHellKey, the keys sealed to the members and
+// StageSignature. Updates without any of them keep version zero and its
+// layout, without those fields, so that updates serialized before they existed
+// still parse, but they no longer validate.
+const UpdateStageVersion = 1
+
+func (update *UpdateStage) version() byte {
+	if update.StageSignature != (crypto.Signature{}) || update.DiffHellKey != crypto.ZeroToken {
+		return UpdateStageVersion
+	}
+	if len(update.ReadMembers) > 0 || len(update.SubMembers) > 0 || len(update.ModMembers) > 0 {
+		return UpdateStageVersion
+	}
+	return 0
+}
+
 func (update *UpdateStage) Authority() crypto.Token {
 	return update.Author
 }
@@ -42,7 +59,7 @@ func (update *UpdateStage) Payments() *Payment {
 		return NewPayment(crypto.HashToken(update.Wallet), update.Fee)
 	}
 	if update.Attorney != crypto.ZeroToken {
-		return NewPayment(crypto.HashToken(update.Wallet), update.Fee)
+		return NewPayment(crypto.HashToken(update.Attorney), update.Fee)
 	}
 	return NewPayment(crypto.HashToken(update.Author), update.Fee)
 }
@@ -53,12 +70,25 @@ func (update *UpdateStage) Serialize() []byte {
 	return bytes
 }
 
+// Validate checks that the stage exists and that the update is signed by the
+// key of the stage. The submission and moderation keys of the stage are
+// replaced by the ones of the update, so that a rotation takes effect for
+// content validated after the block of the update.
 func (update *UpdateStage) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(update, update.Fee) {
+		return false
+	}
+	if update.EpochStamp > v.Epoch() {
+		return false
+	}
 	if !v.HasMember(crypto.HashToken(update.Author)) {
 		return false
 	}
 	audienceHash := crypto.HashToken(update.Stage)
-	if stage := v.GetAudienceKeys(audienceHash); stage != nil {
+	if stage := v.GetAudienceKeys(audienceHash); stage == nil {
+		return false
+	}
+	if !update.Stage.Verify(update.serialiazeStageSign(), update.StageSignature) {
 		return false
 	}
 	if v.CanPay(update.Payments()) {
@@ -68,7 +98,7 @@ func (update *UpdateStage) Validate(v InstructionValidator) bool {
 			Stage:    update.Stage,
 			Flag:     update.Flag,
 		}
-		if v.SetNewAudience(audienceHash, stageKeys) {
+		if v.UpdateAudience(audienceHash, stageKeys) {
 			v.AddFeeCollected(update.Fee)
 			return true
 		}
@@ -76,24 +106,62 @@ func (update *UpdateStage) Validate(v InstructionValidator) bool {
 	return false
 }
 
+// StageSign signs the update with the key of the stage.
+func (update *UpdateStage) StageSign(key crypto.PrivateKey) {
+	update.StageSignature = key.Sign(update.serialiazeStageSign())
+}
+
+func (update *UpdateStage) Sign(key crypto.PrivateKey) {
+	update.Signature = key.Sign(update.serializeSign())
+}
+
+func (update *UpdateStage) AppendFee(wallet crypto.PrivateKey, fee uint64) {
+	token := wallet.PublicKey()
+	if token != update.Author {
+		update.Wallet = token
+	} else {
+		update.Wallet = crypto.ZeroToken
+	}
+	update.Fee = fee
+	bytes := update.serializeWalletSign()
+	update.WalletSignature = wallet.Sign(bytes)
+}
+
 func (update *UpdateStage) JSON() string {
 	bulk := genericJSON(IUpdateStage, update.EpochStamp, update.Fee, update.Author, update.Wallet, update.Attorney,
 		update.Signature, update.WalletSignature)
 	bulk.PutHex("stage", update.Stage[:])
 	bulk.PutHex("submission", update.Submission[:])
 	bulk.PutHex("moderation", update.Moderation[:])
+	bulk.PutHex("diffieHellKey", update.DiffHellKey[:])
 	bulk.PutUint64("flag", uint64(update.Flag))
 	bulk.PutString("description", update.Description)
+	bulk.PutTokenCiphers("readMembers", update.ReadMembers)
+	bulk.PutTokenCiphers("subMembers", update.SubMembers)
+	bulk.PutTokenCiphers("modMembers", update.ModMembers)
+	bulk.PutHex("stageSignature", update.StageSignature[:])
 	return bulk.ToString()
 }
 
+// serialiazeStageSign is the message signed by the key of the stage, always
+// under UpdateStageVersion.
 func (update *UpdateStage) serialiazeStageSign() []byte {
-	bytes := []byte{0, IReact}
+	return update.serializeBulk(UpdateStageVersion)
+}
+
+func (update *UpdateStage) serializeBulk(version byte) []byte {
+	bytes := []byte{version, IUpdateStage}
 	util.PutUint64(update.EpochStamp, &bytes)
 	util.PutToken(update.Author, &bytes)
 	util.PutToken(update.Stage, &bytes)
 	util.PutToken(update.Submission, &bytes)
 	util.PutToken(update.Moderation, &bytes)
+	if version == 0 {
+		util.PutByte(update.Flag, &bytes)
+		util.PutString(update.Description, &bytes)
+		return bytes
+	}
+	util.PutToken(update.DiffHellKey, &bytes)
 	util.PutByte(update.Flag, &bytes)
 	util.PutString(update.Description, &bytes)
 	util.PutTokenCiphers(update.ReadMembers, &bytes)
@@ -103,8 +171,11 @@ func (update *UpdateStage) serialiazeStageSign() []byte {
 }
 
 func (update *UpdateStage) serializeSign() []byte {
-	bytes := update.serialiazeStageSign()
-	util.PutSignature(update.StageSignature, &bytes)
+	version := update.version()
+	bytes := update.serializeBulk(version)
+	if version > 0 {
+		util.PutSignature(update.StageSignature, &bytes)
+	}
 	util.PutToken(update.Attorney, &bytes)
 	return bytes
 }
@@ -119,7 +190,7 @@ func (update *UpdateStage) serializeWalletSign() []byte {
 
 func ParseUpdateStage(data []byte) *UpdateStage {
 	var position int
-	if data[0] != 0 || data[1] != IUpdateStage {
+	if len(data) < 2 || data[0] > UpdateStageVersion || data[1] != IUpdateStage {
 		return nil
 	}
 	join := UpdateStage{}
@@ -127,9 +198,25 @@ func ParseUpdateStage(data []byte) *UpdateStage {
 	join.Stage, position = util.ParseToken(data, position)
 	join.Submission, position = util.ParseToken(data, position)
 	join.Moderation, position = util.ParseToken(data, position)
-	join.Flag, position = util.ParseByte(data, position)
-	join.Description, position = util.ParseString(data, position)
+	if data[0] == 0 {
+		join.Flag, position = util.ParseByte(data, position)
+		join.Description, position = util.ParseString(data, position)
+	} else {
+		join.DiffHellKey, position = util.ParseToken(data, position)
+		join.Flag, position = util.ParseByte(data, position)
+		join.Description, position = util.ParseString(data, position)
+		join.ReadMembers, position = util.ParseTokenCiphers(data, position)
+		join.SubMembers, position = util.ParseTokenCiphers(data, position)
+		join.ModMembers, position = util.ParseTokenCiphers(data, position)
+		join.StageSignature, position = util.ParseSignature(data, position)
+		if join.version() != data[0] {
+			return nil
+		}
+	}
 	join.Attorney, position = util.ParseToken(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	join.Signature, position = util.ParseSignature(data, position)
 	if !checkSignature(msg, join.Signature, join.Attorney, join.Author) {
@@ -137,6 +224,9 @@ func ParseUpdateStage(data []byte) *UpdateStage {
 	}
 	join.Wallet, position = util.ParseToken(data, position)
 	join.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg = data[0:position]
 	join.WalletSignature, position = util.ParseSignature(data, position)
 	if !checkWalletSignature(msg, join.WalletSignature, join.Wallet, join.Attorney, join.Author) {
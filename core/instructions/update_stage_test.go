@@ -0,0 +1,86 @@
+package instructions
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+func TestUpdateStageParse(t *testing.T) {
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	update := UpdateStage{
+		EpochStamp:  12,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		Submission:  crypto.Token{1},
+		Moderation:  crypto.Token{2},
+		DiffHellKey: crypto.Token{3},
+		Flag:        1,
+		Description: "rotated",
+		ReadMembers: crypto.TokenCiphers{{Token: crypto.Token{4}, Cipher: []byte{5, 6}}},
+		SubMembers:  crypto.TokenCiphers{},
+		ModMembers:  crypto.TokenCiphers{{Token: crypto.Token{7}, Cipher: []byte{8}}},
+	}
+	update.StageSign(stage)
+	update.Sign(author)
+	update.AppendFee(author, 10)
+
+	bytes := update.Serialize()
+	if bytes[0] != UpdateStageVersion {
+		t.Errorf("update signed by the stage serialized with version %v", bytes[0])
+	}
+	parsed := ParseInstruction(bytes)
+	if parsed == nil || !reflect.DeepEqual(&update, parsed) {
+		t.Error("UpdateStage parsing or serializing is broken")
+	}
+	if !update.Stage.Verify(update.serialiazeStageSign(), parsed.(*UpdateStage).StageSignature) {
+		t.Error("wrong stage signature")
+	}
+}
+
+func TestUpdateStageLegacyParse(t *testing.T) {
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	update := UpdateStage{
+		EpochStamp:  12,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		Submission:  crypto.Token{1},
+		Moderation:  crypto.Token{2},
+		Flag:        1,
+		Description: "legacy",
+	}
+	update.Sign(author)
+	update.AppendFee(author, 10)
+
+	// layout of updates serialized before the stage signature existed
+	legacy := []byte{0, IUpdateStage}
+	util.PutUint64(update.EpochStamp, &legacy)
+	util.PutToken(update.Author, &legacy)
+	util.PutToken(update.Stage, &legacy)
+	util.PutToken(update.Submission, &legacy)
+	util.PutToken(update.Moderation, &legacy)
+	util.PutByte(update.Flag, &legacy)
+	util.PutString(update.Description, &legacy)
+	util.PutToken(update.Attorney, &legacy)
+	util.PutSignature(update.Signature, &legacy)
+	util.PutToken(update.Wallet, &legacy)
+	util.PutUint64(update.Fee, &legacy)
+	util.PutSignature(update.WalletSignature, &legacy)
+
+	bytes := update.Serialize()
+	if !reflect.DeepEqual(bytes, legacy) {
+		t.Fatal("update without stage signature not serialized with the legacy layout")
+	}
+	parsed := ParseInstruction(bytes)
+	if parsed == nil || !reflect.DeepEqual(&update, parsed) {
+		t.Error("legacy UpdateStage parsing is broken")
+	}
+	bytes[0] = UpdateStageVersion
+	if ParseUpdateStage(bytes) != nil {
+		t.Error("versioned update without stage signature parsed")
+	}
+}
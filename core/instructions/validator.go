@@ -19,12 +19,14 @@ type InstructionValidator interface {
 	SetNewEphemeralToken(hash crypto.Hash, expire uint64) bool
 	SetNewMember(tokenHash crypto.Hash, captionHashe crypto.Hash) bool
 	SetNewAudience(hash crypto.Hash, stage StageKeys) bool
+	SetNewContent(hash crypto.Hash) bool
 	UpdateAudience(hash crypto.Hash, stage StageKeys) bool
 	//Balance(hash crypto.Hash) uint64
 	PowerOfAttorney(hash crypto.Hash) bool
 	SponsorshipOffer(hash crypto.Hash) uint64
 	HasMember(hash crypto.Hash) bool
 	HasCaption(hash crypto.Hash) bool
+	HasContent(hash crypto.Hash) bool
 	HasGrantedSponser(hash crypto.Hash) (bool, crypto.Hash)
 	GetAudienceKeys(hash crypto.Hash) *StageKeys
 	GetEphemeralExpire(hash crypto.Hash) (bool, uint64)
@@ -33,4 +35,5 @@ type InstructionValidator interface {
 	CanPay(payments *Payment) bool
 	Deposit(hash crypto.Hash, value uint64)
 	CanWithdraw(hash crypto.Hash, value uint64) bool
+	Withdraw(hash crypto.Hash, value uint64)
 }
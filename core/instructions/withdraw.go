@@ -45,9 +45,14 @@ func (w *Withdraw) Payments() *Payment {
 }
 
 func (w *Withdraw) Validate(v InstructionValidator) bool {
+	if !paysMinimumFee(w, w.Fee) {
+		return false
+	}
 	payments := w.Payments()
-	if v.CanPay(payments) && v.CanWithdraw(crypto.HashToken(w.Token), w.Value) {
+	hash := crypto.HashToken(w.Token)
+	if v.CanPay(payments) && v.CanWithdraw(hash, w.Value) {
 		v.AddFeeCollected(w.Fee)
+		v.Withdraw(hash, w.Value)
 		return true
 	}
 	return false
@@ -80,10 +85,16 @@ func ParseWithdraw(data []byte) *Withdraw {
 	p.Token, position = util.ParseToken(data, position)
 	p.Value, position = util.ParseUint64(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msgToVerify := data[0:position]
-	p.Signature, _ = util.ParseSignature(data, position)
+	p.Signature, position = util.ParseSignature(data, position)
 	if !p.Token.Verify(msgToVerify, p.Signature) {
 		return nil
 	}
+	if position != len(data) {
+		return nil
+	}
 	return &p
 }
@@ -0,0 +1,260 @@
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// GenesisSpec is the specification of the initial state of an aereum network.
+// Tokens are hex encoded. The same spec always yields the same State and the
+// same genesis hash.
+type GenesisSpec struct {
+	Network    string            `json:"network"`
+	Time       time.Time         `json:"time"`
+	Members    []GenesisMember   `json:"members"`
+	Balances   []GenesisBalance  `json:"balances"`
+	Deposits   []GenesisBalance  `json:"deposits"`
+	Stages     []GenesisStage    `json:"stages"`
+	Validators []string          `json:"validators"`
+	Parameters GenesisParameters `json:"parameters"`
+}
+
+type GenesisMember struct {
+	Token   string `json:"token"`
+	Caption string `json:"caption"`
+}
+
+type GenesisBalance struct {
+	Token string `json:"token"`
+	Value uint64 `json:"value"`
+}
+
+type GenesisStage struct {
+	Stage    string `json:"stage"`
+	Submit   string `json:"submit"`
+	Moderate string `json:"moderate"`
+	Flag     byte   `json:"flag"`
+}
+
+// GenesisParameters are the chain parameters of the network. Fee shares are in
+// basis points of the fees collected by a block.
+type GenesisParameters struct {
+	UnbondingPeriod uint64 `json:"unbondingPeriod"`
+	StakersShare    uint64 `json:"stakersShare"`
+	BurnShare       uint64 `json:"burnShare"`
+	TargetBlockSize int    `json:"targetBlockSize"`
+	BlockInterval   uint64 `json:"blockInterval"` // milliseconds
+}
+
+// LoadGenesisSpec reads and parses a genesis spec file in JSON.
+func LoadGenesisSpec(path string) (*GenesisSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGenesisSpec(data)
+}
+
+// ParseGenesisSpec parses a JSON genesis spec and checks its tokens.
+func ParseGenesisSpec(data []byte) (*GenesisSpec, error) {
+	var spec GenesisSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	if err := spec.check(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func parseGenesisToken(s string) (crypto.Token, error) {
+	var token crypto.Token
+	bytes, err := hex.DecodeString(s)
+	if err != nil {
+		return token, fmt.Errorf("invalid genesis token %v: %v", s, err)
+	}
+	if len(bytes) != crypto.TokenSize {
+		return token, fmt.Errorf("invalid genesis token %v: wrong size", s)
+	}
+	copy(token[:], bytes)
+	return token, nil
+}
+
+func parseOptionalGenesisToken(s string) (crypto.Token, error) {
+	if s == "" {
+		return crypto.ZeroToken, nil
+	}
+	return parseGenesisToken(s)
+}
+
+func (spec *GenesisSpec) check() error {
+	members := make(map[crypto.Token]struct{})
+	for _, member := range spec.Members {
+		token, err := parseGenesisToken(member.Token)
+		if err != nil {
+			return err
+		}
+		if _, ok := members[token]; ok {
+			return fmt.Errorf("duplicate genesis member %v", member.Token)
+		}
+		members[token] = struct{}{}
+	}
+	for _, balances := range [][]GenesisBalance{spec.Balances, spec.Deposits} {
+		for _, balance := range balances {
+			if _, err := parseGenesisToken(balance.Token); err != nil {
+				return err
+			}
+		}
+	}
+	for _, stage := range spec.Stages {
+		if _, err := parseGenesisToken(stage.Stage); err != nil {
+			return err
+		}
+		if _, err := parseOptionalGenesisToken(stage.Submit); err != nil {
+			return err
+		}
+		if _, err := parseOptionalGenesisToken(stage.Moderate); err != nil {
+			return err
+		}
+	}
+	for _, validator := range spec.Validators {
+		if _, err := parseGenesisToken(validator); err != nil {
+			return err
+		}
+	}
+	if spec.Parameters.StakersShare+spec.Parameters.BurnShare > 10000 {
+		return fmt.Errorf("genesis fee shares exceed 10000 basis points")
+	}
+	return nil
+}
+
+// ValidatorTokens returns the tokens of the initial validator set.
+func (spec *GenesisSpec) ValidatorTokens() []crypto.Token {
+	tokens := make([]crypto.Token, 0, len(spec.Validators))
+	for _, validator := range spec.Validators {
+		token, _ := parseGenesisToken(validator)
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// State builds the genesis state described by the spec.
+func (spec *GenesisSpec) State() (*State, error) {
+	if err := spec.check(); err != nil {
+		return nil, err
+	}
+	state := NewMemoryState(0)
+	if spec.Parameters.UnbondingPeriod > 0 {
+		state.UnbondingPeriod = spec.Parameters.UnbondingPeriod
+	}
+	for _, member := range spec.Members {
+		token, _ := parseGenesisToken(member.Token)
+		state.Members.InsertToken(token)
+		if member.Caption != "" {
+			state.Captions.InsertHash(crypto.Hasher([]byte(member.Caption)))
+		}
+	}
+	for _, balance := range spec.Balances {
+		token, _ := parseGenesisToken(balance.Token)
+		state.Wallets.Credit(token, balance.Value)
+	}
+	for _, deposit := range spec.Deposits {
+		token, _ := parseGenesisToken(deposit.Token)
+		state.Deposits.Credit(token, deposit.Value)
+		state.updateStaker(crypto.HashToken(token))
+	}
+	for _, stage := range spec.Stages {
+		keys := instructions.StageKeys{Flag: stage.Flag}
+		keys.Stage, _ = parseGenesisToken(stage.Stage)
+		keys.Submit, _ = parseOptionalGenesisToken(stage.Submit)
+		keys.Moderate, _ = parseOptionalGenesisToken(stage.Moderate)
+		state.Stages.SetKeys(crypto.HashToken(keys.Stage), &keys)
+	}
+	return state, nil
+}
+
+// Hash returns the genesis hash of the network, the parent of the first block.
+// It is the hash of a canonical binary serialization of the spec. Members,
+// balances, deposits, stages and validators are serialized in order of token,
+// as the order they are declared in does not change the genesis state.
+func (spec *GenesisSpec) Hash() crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutString(spec.Network, &bytes)
+	util.PutTime(spec.Time.UTC(), &bytes)
+	members := make([]crypto.Token, 0, len(spec.Members))
+	captions := make(map[crypto.Token]string)
+	for _, member := range spec.Members {
+		token, _ := parseGenesisToken(member.Token)
+		members = append(members, token)
+		captions[token] = member.Caption
+	}
+	sortTokens(members)
+	util.PutUint16(uint16(len(members)), &bytes)
+	for _, token := range members {
+		util.PutToken(token, &bytes)
+		util.PutString(captions[token], &bytes)
+	}
+	for _, balances := range [][]GenesisBalance{spec.Balances, spec.Deposits} {
+		values := make([]crypto.TokenValue, 0, len(balances))
+		for _, balance := range balances {
+			token, _ := parseGenesisToken(balance.Token)
+			values = append(values, crypto.TokenValue{Token: token, Value: balance.Value})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Token != values[j].Token {
+				return tokenLess(values[i].Token, values[j].Token)
+			}
+			return values[i].Value < values[j].Value
+		})
+		util.PutUint16(uint16(len(values)), &bytes)
+		for _, value := range values {
+			util.PutToken(value.Token, &bytes)
+			util.PutUint64(value.Value, &bytes)
+		}
+	}
+	stages := make([][]byte, 0, len(spec.Stages))
+	for _, stage := range spec.Stages {
+		data := make([]byte, 0)
+		token, _ := parseGenesisToken(stage.Stage)
+		util.PutToken(token, &data)
+		token, _ = parseOptionalGenesisToken(stage.Submit)
+		util.PutToken(token, &data)
+		token, _ = parseOptionalGenesisToken(stage.Moderate)
+		util.PutToken(token, &data)
+		util.PutByte(stage.Flag, &data)
+		stages = append(stages, data)
+	}
+	sort.Slice(stages, func(i, j int) bool { return string(stages[i]) < string(stages[j]) })
+	util.PutUint16(uint16(len(stages)), &bytes)
+	for _, stage := range stages {
+		bytes = append(bytes, stage...)
+	}
+	validators := spec.ValidatorTokens()
+	sortTokens(validators)
+	util.PutUint16(uint16(len(validators)), &bytes)
+	for _, validator := range validators {
+		util.PutToken(validator, &bytes)
+	}
+	util.PutUint64(spec.Parameters.UnbondingPeriod, &bytes)
+	util.PutUint64(spec.Parameters.StakersShare, &bytes)
+	util.PutUint64(spec.Parameters.BurnShare, &bytes)
+	util.PutUint64(uint64(spec.Parameters.TargetBlockSize), &bytes)
+	util.PutUint64(spec.Parameters.BlockInterval, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+func tokenLess(a, b crypto.Token) bool {
+	return string(a[:]) < string(b[:])
+}
+
+func sortTokens(tokens []crypto.Token) {
+	sort.Slice(tokens, func(i, j int) bool { return tokenLess(tokens[i], tokens[j]) })
+}
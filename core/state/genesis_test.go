@@ -0,0 +1,82 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+func genesisToken(name string) string {
+	token := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(token[:])
+}
+
+func TestGenesisSpecHash(t *testing.T) {
+	alice, bob, stage, submit := genesisToken("alice"), genesisToken("bob"), genesisToken("stage"), genesisToken("submit")
+	first := fmt.Sprintf(`{
+		"network": "test",
+		"time": "2023-01-01T12:00:00Z",
+		"members": [{"token": "%[1]v", "caption": "alice"}, {"token": "%[2]v", "caption": "bob"}],
+		"balances": [{"token": "%[1]v", "value": 100}, {"token": "%[2]v", "value": 200}],
+		"deposits": [{"token": "%[1]v", "value": 10}, {"token": "%[2]v", "value": 20}],
+		"stages": [{"stage": "%[3]v", "submit": "%[4]v", "flag": 1}],
+		"validators": ["%[1]v", "%[2]v"],
+		"parameters": {"unbondingPeriod": 10, "stakersShare": 3000, "burnShare": 1000}
+	}`, alice, bob, stage, submit)
+	second := fmt.Sprintf(`{
+		"parameters": {"burnShare": 1000, "stakersShare": 3000, "unbondingPeriod": 10},
+		"validators": ["%[2]v", "%[1]v"],
+		"stages": [{"flag": 1, "submit": "%[4]v", "stage": "%[3]v"}],
+		"deposits": [{"value": 20, "token": "%[2]v"}, {"value": 10, "token": "%[1]v"}],
+		"balances": [{"value": 200, "token": "%[2]v"}, {"token": "%[1]v", "value": 100}],
+		"members": [{"caption": "bob", "token": "%[2]v"}, {"caption": "alice", "token": "%[1]v"}],
+		"time": "2023-01-01T09:00:00-03:00",
+		"network": "test"
+	}`, strings.ToUpper(alice), bob, stage, submit)
+	specs := make([]*GenesisSpec, 0)
+	for _, data := range []string{first, second} {
+		spec, err := ParseGenesisSpec([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		specs = append(specs, spec)
+	}
+	if specs[0].Hash() != specs[1].Hash() {
+		t.Error("genesis hash depends on the order of the spec")
+	}
+	specs[1].Balances[0].Value = 201
+	if specs[0].Hash() == specs[1].Hash() {
+		t.Error("genesis hash does not depend on balances")
+	}
+
+	state, err := specs[0].State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := make(map[string]crypto.Token)
+	for _, name := range []string{"alice", "bob", "stage", "submit"} {
+		tokens[name] = crypto.Token(sha256.Sum256([]byte(name)))
+	}
+	for name, want := range map[string][2]uint64{"alice": {100, 10}, "bob": {200, 20}} {
+		if _, balance := state.Wallets.Balance(tokens[name]); balance != want[0] {
+			t.Errorf("wrong balance of %v: %v", name, balance)
+		}
+		if staked := state.Staked(tokens[name]); staked != want[1] {
+			t.Errorf("wrong deposit of %v: %v", name, staked)
+		}
+		if !state.Members.ExistsToken(tokens[name]) {
+			t.Errorf("%v not a member", name)
+		}
+	}
+	if len(state.Stakers()) != 2 || state.UnbondingPeriod != 10 {
+		t.Error("wrong stakers or unbonding period")
+	}
+	keys := state.Stages.GetKeys(crypto.HashToken(tokens["stage"]))
+	if keys == nil || keys.Submit != tokens["submit"] || keys.Moderate != crypto.ZeroToken || keys.Flag != 1 {
+		t.Error("wrong genesis stage")
+	}
+}
@@ -19,22 +19,28 @@ type Mutation struct {
 	NewStages     map[crypto.Hash]instructions.StageKeys
 	StageUpdate   map[crypto.Hash]instructions.StageKeys
 	NewEphemeral  map[crypto.Hash]uint64
+	Withdrawals   map[crypto.Hash]uint64 // deposits requested back -> value to unbond
+	NewContents   map[crypto.Hash]struct{}
+	BurnedFees    uint64
 }
 
 func NewMutation() *Mutation {
 	return &Mutation{
-		DeltaWallets: make(map[crypto.Hash]int),
-		GrantPower:   make(map[crypto.Hash]struct{}),
-		RevokePower:  make(map[crypto.Hash]struct{}),
-		UseSpnOffer:  make(map[crypto.Hash]struct{}),
-		GrantSponsor: make(map[crypto.Hash]crypto.Hash),
-		PublishSpn:   make(map[crypto.Hash]struct{}),
-		NewSpnOffer:  make(map[crypto.Hash]uint64),
-		NewMembers:   make(map[crypto.Hash]struct{}),
-		NewCaption:   make(map[crypto.Hash]struct{}),
-		NewStages:    make(map[crypto.Hash]instructions.StageKeys),
-		StageUpdate:  make(map[crypto.Hash]instructions.StageKeys),
-		NewEphemeral: make(map[crypto.Hash]uint64),
+		DeltaWallets:  make(map[crypto.Hash]int),
+		DeltaDeposits: make(map[crypto.Hash]int),
+		GrantPower:    make(map[crypto.Hash]struct{}),
+		RevokePower:   make(map[crypto.Hash]struct{}),
+		UseSpnOffer:   make(map[crypto.Hash]struct{}),
+		GrantSponsor:  make(map[crypto.Hash]crypto.Hash),
+		PublishSpn:    make(map[crypto.Hash]struct{}),
+		NewSpnOffer:   make(map[crypto.Hash]uint64),
+		NewMembers:    make(map[crypto.Hash]struct{}),
+		NewCaption:    make(map[crypto.Hash]struct{}),
+		NewStages:     make(map[crypto.Hash]instructions.StageKeys),
+		StageUpdate:   make(map[crypto.Hash]instructions.StageKeys),
+		NewEphemeral:  make(map[crypto.Hash]uint64),
+		Withdrawals:   make(map[crypto.Hash]uint64),
+		NewContents:   make(map[crypto.Hash]struct{}),
 	}
 }
 
@@ -43,6 +49,11 @@ func (m *Mutation) DeltaBalance(hash crypto.Hash) int {
 	return balance
 }
 
+func (m *Mutation) DeltaDeposit(hash crypto.Hash) int {
+	deposit := m.DeltaDeposits[hash]
+	return deposit
+}
+
 func (m *Mutation) HasGrantedSponsorship(hash crypto.Hash) (bool, crypto.Hash) {
 	if _, ok := m.PublishSpn[hash]; ok {
 		return false, crypto.Hasher([]byte{})
@@ -81,12 +92,19 @@ func (m *Mutation) HasCaption(hash crypto.Hash) bool {
 	return ok
 }
 
+func (m *Mutation) HasContent(hash crypto.Hash) bool {
+	_, ok := m.NewContents[hash]
+	return ok
+}
+
 func (m *Mutation) GetStage(hash crypto.Hash) *instructions.StageKeys {
 	if audience, ok := m.StageUpdate[hash]; ok {
 		return &audience
 	}
-	audience := m.NewStages[hash]
-	return &audience
+	if audience, ok := m.NewStages[hash]; ok {
+		return &audience
+	}
+	return nil
 }
 
 func (m *Mutation) HasEphemeral(hash crypto.Hash) (bool, uint64) {
@@ -64,7 +64,7 @@ func (w *Sponsor) Exists(hash crypto.Hash) bool {
 
 func (w *Sponsor) SetContentHash(hash crypto.Hash, keys []byte) bool {
 	response := make(chan papirus.QueryResult)
-	ok, _ := w.hs.Query(papirus.Query[crypto.Hash]{Hash: hash, Param: append([]byte{1}, hash[:]...), Response: response})
+	ok, _ := w.hs.Query(papirus.Query[crypto.Hash]{Hash: hash, Param: append([]byte{1}, keys...), Response: response})
 	return ok
 }
 
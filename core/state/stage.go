@@ -18,7 +18,7 @@ func getOrSetStage(found bool, hash crypto.Hash, b *papirus.Bucket, item int64,
 				Result: papirus.QueryResult{Ok: true, Data: keys[crypto.Size:]},
 			}
 		} else {
-			updated := make([]byte, crypto.Size+3*crypto.PublicKeySize)
+			updated := make([]byte, crypto.Size+3*crypto.PublicKeySize+1)
 			copy(updated[0:crypto.Size], hash[:])
 			copy(updated[crypto.Size:], param)
 			b.WriteItem(item, updated)
@@ -29,7 +29,7 @@ func getOrSetStage(found bool, hash crypto.Hash, b *papirus.Bucket, item int64,
 		}
 	} else {
 		if !get {
-			newKeys := make([]byte, crypto.Size+3*crypto.PublicKeySize)
+			newKeys := make([]byte, crypto.Size+3*crypto.PublicKeySize+1)
 			copy(newKeys[:crypto.Size], hash[:])
 			copy(newKeys[crypto.Size:], param)
 			b.WriteItem(item, newKeys)
@@ -70,7 +70,7 @@ func (w *Stage) Exists(hash crypto.Hash) bool {
 }
 
 func (w *Stage) SetKeys(hash crypto.Hash, stage *instructions.StageKeys) bool {
-	keys := make([]byte, 2*crypto.TokenSize+1)
+	keys := make([]byte, 3*crypto.TokenSize+1)
 	copy(keys[0:crypto.TokenSize], stage.Moderate[:])
 	copy(keys[crypto.TokenSize:2*crypto.TokenSize], stage.Submit[:])
 	copy(keys[2*crypto.TokenSize:3*crypto.TokenSize], stage.Stage[:])
@@ -0,0 +1,228 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+	"github.com/lienkolabs/papirus"
+)
+
+// DefaultUnbondingPeriod is the number of epochs a withdrawn deposit remains
+// bonded before it is credited back to the wallet of the account.
+const DefaultUnbondingPeriod = 1000
+
+// Unbonding keeps withdrawn deposits waiting for release on stores like the
+// ones of the deposits. Entries are grouped by the epoch at which they are
+// credited back to the wallets: the n-th entry of a release epoch is kept under
+// unbondingKey, the number of entries of the epoch under the hash of the epoch,
+// and the total value unbonding of every account under its hash.
+type Unbonding struct {
+	entries *unbondingEntries
+	counts  *Wallet // number of entries by release epoch
+	pending *Wallet // value unbonding by account
+	next    uint64  // earliest release epoch not yet released
+	last    uint64  // latest release epoch enqueued
+}
+
+// NewMemoryUnbondingStore returns an empty unbonding queue backed by memory
+// stores, releasing entries from the epoch on.
+func NewMemoryUnbondingStore(epoch uint64, bitsForBucket int64) *Unbonding {
+	return &Unbonding{
+		entries: newMemoryUnbondingEntries(epoch, bitsForBucket),
+		counts:  NewMemoryWalletStore(epoch, bitsForBucket),
+		pending: NewMemoryWalletStore(epoch, bitsForBucket),
+		next:    epoch,
+	}
+}
+
+func epochHash(epoch uint64) crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutString("unbonding", &bytes)
+	util.PutUint64(epoch, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+func unbondingKey(release uint64, n uint64) crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutString("unbonding", &bytes)
+	util.PutUint64(release, &bytes)
+	util.PutUint64(n, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+// Enqueue schedules the release of value to account at the release epoch.
+func (u *Unbonding) Enqueue(account crypto.Hash, value uint64, release uint64) {
+	_, count := u.counts.BalanceHash(epochHash(release))
+	u.entries.set(unbondingKey(release, count), instructions.Wallet{Account: account, FungibleTokens: value})
+	u.counts.CreditHash(epochHash(release), 1)
+	u.pending.CreditHash(account, value)
+	if release > u.last {
+		u.last = release
+	}
+}
+
+// Release removes and returns every entry scheduled to be released at or
+// before epoch. Entries are returned ordered by release epoch.
+func (u *Unbonding) Release(epoch uint64) []instructions.Wallet {
+	released := make([]instructions.Wallet, 0)
+	for ; u.next <= epoch && u.next <= u.last; u.next++ {
+		_, count := u.counts.BalanceHash(epochHash(u.next))
+		for n := uint64(0); n < count; n++ {
+			key := unbondingKey(u.next, n)
+			if entry, ok := u.entries.get(key); ok {
+				u.entries.remove(key)
+				u.pending.DebitHash(entry.Account, entry.FungibleTokens)
+				released = append(released, entry)
+			}
+		}
+		u.counts.DebitHash(epochHash(u.next), count)
+	}
+	if u.next <= epoch {
+		u.next = epoch + 1
+	}
+	return released
+}
+
+// Pending returns the total value still unbonding for account.
+func (u *Unbonding) Pending(account crypto.Hash) uint64 {
+	_, value := u.pending.BalanceHash(account)
+	return value
+}
+
+// Close stops the stores backing the queue. It returns false if any of them
+// failed to stop.
+func (u *Unbonding) Close() bool {
+	ok := u.entries.Close()
+	ok = u.counts.Close() && ok
+	ok = u.pending.Close() && ok
+	return ok
+}
+
+// unbondingEntries keeps the account and the value of unbonding entries by
+// their key.
+type unbondingEntries struct {
+	hs *papirus.HashStore[crypto.Hash]
+}
+
+// getSetOrDeleteEntry reads the entry of the hash with an empty param, deletes
+// it with a param of one byte and sets it to the account and value of param
+// otherwise.
+func getSetOrDeleteEntry(found bool, hash crypto.Hash, b *papirus.Bucket, item int64, param []byte) papirus.OperationResult {
+	switch {
+	case len(param) == 0:
+		if !found {
+			return papirus.OperationResult{Result: papirus.QueryResult{Ok: false}}
+		}
+		entry := b.ReadItem(item)
+		return papirus.OperationResult{Result: papirus.QueryResult{Ok: true, Data: entry[crypto.Size:]}}
+	case len(param) == 1:
+		if !found {
+			return papirus.OperationResult{Result: papirus.QueryResult{Ok: false}}
+		}
+		return papirus.OperationResult{
+			Deleted: &papirus.Item{Bucket: b, Item: item},
+			Result:  papirus.QueryResult{Ok: true},
+		}
+	default:
+		entry := make([]byte, 2*crypto.Size+8)
+		copy(entry[0:crypto.Size], hash[:])
+		copy(entry[crypto.Size:], param)
+		b.WriteItem(item, entry)
+		if found {
+			return papirus.OperationResult{Result: papirus.QueryResult{Ok: true}}
+		}
+		return papirus.OperationResult{
+			Added:  &papirus.Item{Bucket: b, Item: item},
+			Result: papirus.QueryResult{Ok: false},
+		}
+	}
+}
+
+func (e *unbondingEntries) get(key crypto.Hash) (instructions.Wallet, bool) {
+	response := make(chan papirus.QueryResult)
+	ok, data := e.hs.Query(papirus.Query[crypto.Hash]{Hash: key, Param: []byte{}, Response: response})
+	if !ok {
+		return instructions.Wallet{}, false
+	}
+	entry := instructions.Wallet{FungibleTokens: binary.LittleEndian.Uint64(data[crypto.Size:])}
+	copy(entry.Account[:], data[0:crypto.Size])
+	return entry, true
+}
+
+func (e *unbondingEntries) set(key crypto.Hash, entry instructions.Wallet) {
+	param := make([]byte, crypto.Size+8)
+	copy(param[0:crypto.Size], entry.Account[:])
+	binary.LittleEndian.PutUint64(param[crypto.Size:], entry.FungibleTokens)
+	response := make(chan papirus.QueryResult)
+	e.hs.Query(papirus.Query[crypto.Hash]{Hash: key, Param: param, Response: response})
+}
+
+func (e *unbondingEntries) remove(key crypto.Hash) {
+	response := make(chan papirus.QueryResult)
+	e.hs.Query(papirus.Query[crypto.Hash]{Hash: key, Param: []byte{0}, Response: response})
+}
+
+func (e *unbondingEntries) Close() bool {
+	ok := make(chan bool)
+	e.hs.Stop <- ok
+	return <-ok
+}
+
+func newMemoryUnbondingEntries(epoch uint64, bitsForBucket int64) *unbondingEntries {
+	itemsize := int64(2*crypto.Size + 8)
+	nbytes := 56 + int64(1<<bitsForBucket)*(itemsize*6+8)
+	bytestore := papirus.NewMemoryStore(nbytes)
+	bucketstore := papirus.NewBucketStore(itemsize, 6, bytestore)
+	e := &unbondingEntries{
+		hs: papirus.NewHashStore("unbonding", bucketstore, int(bitsForBucket), getSetOrDeleteEntry),
+	}
+	e.hs.Start()
+	return e
+}
+
+// Stakers returns the hashes of every account with a bonded deposit sorted in
+// ascending byte order.
+func (s *State) Stakers() []crypto.Hash {
+	stakers := make([]crypto.Hash, len(s.stakers))
+	copy(stakers, s.stakers)
+	return stakers
+}
+
+// updateStaker keeps the sorted list of stakers consistent with the deposit
+// store after the deposit of hash has changed.
+func (s *State) updateStaker(hash crypto.Hash) {
+	n := sort.Search(len(s.stakers), func(i int) bool {
+		return bytes.Compare(s.stakers[i][:], hash[:]) >= 0
+	})
+	listed := n < len(s.stakers) && s.stakers[n] == hash
+	staked := s.StakedHash(hash) > 0
+	if staked && !listed {
+		s.stakers = append(s.stakers, crypto.Hash{})
+		copy(s.stakers[n+1:], s.stakers[n:])
+		s.stakers[n] = hash
+	} else if !staked && listed {
+		s.stakers = append(s.stakers[:n], s.stakers[n+1:]...)
+	}
+}
+
+// Staked returns the bonded deposit of the token. It does not include values
+// waiting in the unbonding queue.
+func (s *State) Staked(token crypto.Token) uint64 {
+	_, value := s.Deposits.Balance(token)
+	return value
+}
+
+// StakedHash is like Staked but for the hash of the token.
+func (s *State) StakedHash(hash crypto.Hash) uint64 {
+	_, value := s.Deposits.BalanceHash(hash)
+	return value
+}
+
+// UnbondingValue returns the value withdrawn by the token but not yet released.
+func (s *State) UnbondingValue(token crypto.Token) uint64 {
+	return s.Unbonding.Pending(crypto.HashToken(token))
+}
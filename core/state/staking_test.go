@@ -0,0 +1,99 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+func TestUnbondingRelease(t *testing.T) {
+	state := NewMemoryState(0)
+	state.UnbondingPeriod = 10
+	token, _ := crypto.RandomAsymetricKey()
+	account := crypto.HashToken(token)
+	withdraw := NewMutation()
+	withdraw.Withdrawals[account] = 100
+	state.IncorporateMutations(5, withdraw)
+
+	for epoch := uint64(6); epoch < 15; epoch++ {
+		state.IncorporateMutations(epoch, NewMutation())
+		if _, balance := state.Wallets.Balance(token); balance != 0 {
+			t.Fatalf("withdrawal released at epoch %v before the end of the unbonding period", epoch)
+		}
+	}
+	if pending := state.UnbondingValue(token); pending != 100 {
+		t.Errorf("wrong unbonding value %v", pending)
+	}
+	state.IncorporateMutations(15, NewMutation())
+	if _, balance := state.Wallets.Balance(token); balance != 100 {
+		t.Errorf("withdrawal not released at the end of the unbonding period: %v", balance)
+	}
+	if pending := state.UnbondingValue(token); pending != 0 {
+		t.Errorf("released withdrawal still unbonding: %v", pending)
+	}
+}
+
+func TestUnbondingSameEpoch(t *testing.T) {
+	unbonding := NewMemoryUnbondingStore(0, 8)
+	defer unbonding.Close()
+	accounts := []crypto.Hash{crypto.Hasher([]byte("a")), crypto.Hasher([]byte("b"))}
+	unbonding.Enqueue(accounts[0], 10, 20)
+	unbonding.Enqueue(accounts[1], 20, 20)
+	unbonding.Enqueue(accounts[0], 30, 20)
+	unbonding.Enqueue(accounts[1], 40, 21)
+	if pending := unbonding.Pending(accounts[0]); pending != 40 {
+		t.Errorf("wrong pending value %v", pending)
+	}
+	if released := unbonding.Release(19); len(released) != 0 {
+		t.Errorf("%v entries released early", len(released))
+	}
+	released := unbonding.Release(20)
+	if len(released) != 3 {
+		t.Fatalf("%v of 3 entries released", len(released))
+	}
+	total := uint64(0)
+	for _, entry := range released {
+		total += entry.FungibleTokens
+	}
+	if total != 60 || unbonding.Pending(accounts[0]) != 0 || unbonding.Pending(accounts[1]) != 40 {
+		t.Error("wrong entries released")
+	}
+	if released := unbonding.Release(30); len(released) != 1 || released[0].FungibleTokens != 40 {
+		t.Error("entry of later epoch not released")
+	}
+}
+
+func TestStakersSorted(t *testing.T) {
+	state := NewMemoryState(0)
+	hashes := make([]crypto.Hash, 8)
+	for n := range hashes {
+		hashes[n] = crypto.Hasher([]byte{byte(n)})
+		state.Deposits.CreditHash(hashes[n], uint64(n+1))
+		state.updateStaker(hashes[n])
+	}
+	state.updateStaker(hashes[0])
+	sorted := func() bool {
+		stakers := state.Stakers()
+		for n := 1; n < len(stakers); n++ {
+			if bytes.Compare(stakers[n-1][:], stakers[n][:]) >= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if len(state.Stakers()) != len(hashes) || !sorted() {
+		t.Fatalf("stakers not listed in order: %v", state.Stakers())
+	}
+	state.Deposits.DebitHash(hashes[3], 4)
+	state.updateStaker(hashes[3])
+	stakers := state.Stakers()
+	if len(stakers) != len(hashes)-1 || !sorted() {
+		t.Fatalf("wrong stakers after withdrawal: %v", stakers)
+	}
+	for _, staker := range stakers {
+		if staker == hashes[3] {
+			t.Error("staker without deposit still listed")
+		}
+	}
+}
@@ -8,6 +8,7 @@ type State struct {
 	Epoch           uint64
 	Members         *hashVault
 	Captions        *hashVault
+	Contents        *hashVault // hashes of published content instructions
 	Wallets         *Wallet
 	Deposits        *Wallet
 	Stages          *Stage
@@ -17,26 +18,127 @@ type State struct {
 	EphemeralTokens *HashUint64Vault
 	SponsorExpire   map[uint64]crypto.Hash
 	EphemeralExpire map[uint64]crypto.Hash
+	Unbonding       *Unbonding
+	UnbondingPeriod uint64
+	Burned          uint64 // total fees burned since genesis
+	stakers         []crypto.Hash
 }
 
-func NewGenesisState() (*State, crypto.PrivateKey) {
-	pubKey, prvKey := crypto.RandomAsymetricKey()
-	state := State{
-		Epoch:           0,
-		Members:         NewHashVault("members", 0, 8),
-		Captions:        NewHashVault("captions", 0, 8),
-		Wallets:         NewMemoryWalletStore(0, 8),
-		Deposits:        NewMemoryWalletStore(0, 8),
-		Stages:          NewMemoryAudienceStore(0, 8),
-		SponsorOffers:   NewExpireHashVault("sponsoroffer", 0, 8),
-		SponsorGranted:  NewSponsorShipOfferStore(0, 8),
-		PowerOfAttorney: NewHashVault("poa", 0, 8),
-		EphemeralTokens: NewExpireHashVault("ephemeral", 0, 8),
+// NewMemoryState returns an empty state at the given epoch backed by memory
+// stores.
+func NewMemoryState(epoch uint64) *State {
+	return &State{
+		Epoch:           epoch,
+		Members:         NewHashVault("members", epoch, 8),
+		Captions:        NewHashVault("captions", epoch, 8),
+		Contents:        NewHashVault("contents", epoch, 8),
+		Wallets:         NewMemoryWalletStore(epoch, 8),
+		Deposits:        NewMemoryWalletStore(epoch, 8),
+		Stages:          NewMemoryAudienceStore(epoch, 8),
+		SponsorOffers:   NewExpireHashVault("sponsoroffer", epoch, 8),
+		SponsorGranted:  NewSponsorShipOfferStore(epoch, 8),
+		PowerOfAttorney: NewHashVault("poa", epoch, 8),
+		EphemeralTokens: NewExpireHashVault("ephemeral", epoch, 8),
 		SponsorExpire:   make(map[uint64]crypto.Hash),
 		EphemeralExpire: make(map[uint64]crypto.Hash),
+		Unbonding:       NewMemoryUnbondingStore(epoch, 8),
+		UnbondingPeriod: DefaultUnbondingPeriod,
 	}
+}
+
+// NewGenesisState returns a state with a single random member holding the
+// entire supply. Networks with reproducible genesis should use a GenesisSpec.
+func NewGenesisState() (*State, crypto.PrivateKey) {
+	pubKey, prvKey := crypto.RandomAsymetricKey()
+	state := NewMemoryState(0)
 	state.Members.InsertToken(pubKey)
 	state.Captions.InsertHash(crypto.Hasher([]byte("Aereum Network Genesis")))
 	state.Wallets.Credit(pubKey, 1e6)
-	return &state, prvKey
+	return state, prvKey
+}
+
+// IncorporateMutations commits the mutations of a block at the given epoch
+// into the state. Withdrawals enter the unbonding queue and deposits whose
+// unbonding period has expired are credited back to their wallets.
+func (s *State) IncorporateMutations(epoch uint64, m *Mutation) {
+	for hash, delta := range m.DeltaWallets {
+		if delta > 0 {
+			s.Wallets.CreditHash(hash, uint64(delta))
+		} else if delta < 0 {
+			s.Wallets.DebitHash(hash, uint64(-delta))
+		}
+	}
+	for hash, delta := range m.DeltaDeposits {
+		if delta > 0 {
+			s.Deposits.CreditHash(hash, uint64(delta))
+		} else if delta < 0 {
+			s.Deposits.DebitHash(hash, uint64(-delta))
+		}
+		s.updateStaker(hash)
+	}
+	for hash, value := range m.Withdrawals {
+		s.Unbonding.Enqueue(hash, value, epoch+s.UnbondingPeriod)
+	}
+	for hash := range m.GrantPower {
+		s.PowerOfAttorney.InsertHash(hash)
+	}
+	for hash := range m.RevokePower {
+		s.PowerOfAttorney.RemoveHash(hash)
+	}
+	for hash, expire := range m.NewSpnOffer {
+		s.SponsorOffers.Insert(hash, expire)
+		s.SponsorExpire[expire] = hash
+	}
+	for hash := range m.UseSpnOffer {
+		s.SponsorOffers.Remove(hash)
+	}
+	for hash, contentHash := range m.GrantSponsor {
+		s.SponsorGranted.SetContentHash(hash, contentHash[:])
+	}
+	for hash := range m.PublishSpn {
+		s.SponsorGranted.RemoveContentHash(hash)
+	}
+	for hash := range m.NewMembers {
+		s.Members.InsertHash(hash)
+	}
+	for hash := range m.NewCaption {
+		s.Captions.InsertHash(hash)
+	}
+	for hash := range m.NewContents {
+		s.Contents.InsertHash(hash)
+	}
+	for hash, stage := range m.NewStages {
+		keys := stage
+		s.Stages.SetKeys(hash, &keys)
+	}
+	for hash, stage := range m.StageUpdate {
+		keys := stage
+		s.Stages.SetKeys(hash, &keys)
+	}
+	for hash, expire := range m.NewEphemeral {
+		s.EphemeralTokens.Insert(hash, expire)
+		s.EphemeralExpire[expire] = hash
+	}
+	s.Burned += m.BurnedFees
+	for _, released := range s.Unbonding.Release(epoch) {
+		s.Wallets.CreditHash(released.Account, released.FungibleTokens)
+	}
+	s.Epoch = epoch
+}
+
+// Close stops every store backing the state. It returns false if any of them
+// failed to stop.
+func (s *State) Close() bool {
+	ok := s.Members.Close()
+	ok = s.Captions.Close() && ok
+	ok = s.Contents.Close() && ok
+	ok = s.Wallets.Close() && ok
+	ok = s.Deposits.Close() && ok
+	ok = s.Unbonding.Close() && ok
+	ok = s.Stages.Close() && ok
+	ok = s.SponsorOffers.Close() && ok
+	ok = s.SponsorGranted.Close() && ok
+	ok = s.PowerOfAttorney.Close() && ok
+	ok = s.EphemeralTokens.Close() && ok
+	return ok
 }
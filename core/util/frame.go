@@ -0,0 +1,54 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MaxFrameSize is the largest payload accepted by ReadFrame.
+const MaxFrameSize = 1 << 28
+
+var ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+
+// WriteFrame writes data to w prefixed by its length as a 4-byte little endian
+// unsigned integer.
+func WriteFrame(w io.Writer, data []byte) error {
+	if len(data) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	frame := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(data)))
+	copy(frame[4:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads a frame written by WriteFrame. It returns io.EOF if r is
+// exhausted at a frame boundary and io.ErrUnexpectedEOF if the frame is
+// truncated.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	return ReadFrameLimit(r, MaxFrameSize)
+}
+
+// ReadFrameLimit is ReadFrame for frames of at most maxSize bytes. The length
+// of a frame is checked before its payload is allocated, so that a frame
+// from an untrusted reader cannot claim more memory than maxSize.
+func ReadFrameLimit(r io.Reader, maxSize int) ([]byte, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(size)
+	if uint64(length) > uint64(maxSize) || length > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
@@ -23,7 +23,7 @@ func (j *JSONBuilder) putGeneral(fieldName, value string) {
 }
 
 func (j *JSONBuilder) PutTime(fieldName string, t time.Time) {
-	j.putGeneral(fieldName, t.Format(time.RFC3339))
+	j.putGeneral(fieldName, fmt.Sprintf(`"%v"`, t.Format(time.RFC3339)))
 }
 
 func (j *JSONBuilder) PutUint64(fieldName string, value uint64) {
@@ -67,10 +67,11 @@ func (j *JSONBuilder) PutTokenValueArray(fieldName string, tokens []crypto.Token
 		if !first {
 			array.Encode.WriteRune(',')
 		}
-		fmt.Fprintf(&array.Encode, `{"token":"%v","value":%v`, base64.StdEncoding.EncodeToString(r.Token[:]), r.Value)
+		first = false
+		fmt.Fprintf(&array.Encode, `{"token":"%v","value":%v}`, base64.StdEncoding.EncodeToString(r.Token[:]), r.Value)
 	}
 	array.Encode.WriteRune(']')
-	j.PutString(fieldName, array.Encode.String())
+	j.PutJSON(fieldName, array.Encode.String())
 }
 
 func (j *JSONBuilder) PutTokenCiphers(fieldName string, tc crypto.TokenCiphers) {
@@ -84,8 +85,9 @@ func (j *JSONBuilder) PutTokenCiphers(fieldName string, tc crypto.TokenCiphers)
 		if !first {
 			array.Encode.WriteRune(',')
 		}
-		fmt.Fprintf(&array.Encode, `{"token":"%v","cipher":%v`, base64.StdEncoding.EncodeToString(r.Token[:]), base64.StdEncoding.EncodeToString(r.Cipher))
+		first = false
+		fmt.Fprintf(&array.Encode, `{"token":"%v","cipher":"%v"}`, base64.StdEncoding.EncodeToString(r.Token[:]), base64.StdEncoding.EncodeToString(r.Cipher))
 	}
 	array.Encode.WriteRune(']')
-	j.PutString(fieldName, array.Encode.String())
+	j.PutJSON(fieldName, array.Encode.String())
 }
@@ -71,7 +71,7 @@ func PutByte(b byte, data *[]byte) {
 func ParseToken(data []byte, position int) (crypto.Token, int) {
 	var token crypto.Token
 	if position+crypto.TokenSize > len(data) {
-		return token, position
+		return token, position + crypto.TokenSize
 	}
 	copy(token[:], data[position:position+crypto.TokenSize])
 	return token, position + crypto.TokenSize
@@ -89,7 +89,7 @@ func PutTokenCiphers(tcs crypto.TokenCiphers, data *[]byte) {
 	}
 	maxLen := len(tcs)
 	if len(tcs) > 1<<16-1 {
-		maxLen = 1 << 16
+		maxLen = 1<<16 - 1
 	}
 	*data = append(*data, byte(maxLen), byte(maxLen>>8))
 	for n := 0; n < maxLen; n++ {
@@ -100,7 +100,7 @@ func PutTokenCiphers(tcs crypto.TokenCiphers, data *[]byte) {
 func ParseSignature(data []byte, position int) (crypto.Signature, int) {
 	var sign crypto.Signature
 	if position+crypto.SignatureSize > len(data) {
-		return sign, position
+		return sign, position + crypto.SignatureSize
 	}
 	copy(sign[0:crypto.SignatureSize], data[position:position+crypto.SignatureSize])
 	return sign, position + crypto.SignatureSize
@@ -170,10 +170,9 @@ func ParseTime(data []byte, position int) (time.Time, int) {
 	bytes, newposition := ParseByteArray(data, position)
 	var t time.Time
 	if err := t.UnmarshalBinary(bytes); err != nil {
-		panic("cannot parse time")
+		return time.Time{}, len(data) + 1
 	}
 	return t, newposition
-
 }
 
 func ParseBool(data []byte, position int) (bool, int) {
@@ -198,7 +197,7 @@ func ParseHash(data []byte, position int) (crypto.Hash, int) {
 func ParseTokenCipher(data []byte, position int) (crypto.TokenCipher, int) {
 	tc := crypto.TokenCipher{}
 	if position+1 >= len(data) {
-		return tc, position
+		return tc, len(data) + 1
 	}
 	tc.Token, position = ParseToken(data, position)
 	tc.Cipher, position = ParseByteArray(data, position)
@@ -207,15 +206,13 @@ func ParseTokenCipher(data []byte, position int) (crypto.TokenCipher, int) {
 
 func ParseTokenCiphers(data []byte, position int) (crypto.TokenCiphers, int) {
 	if position+1 >= len(data) {
-		return crypto.TokenCiphers{}, position
+		return crypto.TokenCiphers{}, len(data) + 1
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8
 	position += 2
-	if length == 0 {
-		return crypto.TokenCiphers{}, position + 2
-	}
-	if position+length+2 > len(data) {
-		return crypto.TokenCiphers{}, position + length + 2
+	// every token cipher takes at least a token and the length of its cipher
+	if position+length*(crypto.TokenSize+2) > len(data) {
+		return crypto.TokenCiphers{}, len(data) + 1
 	}
 	tcs := make(crypto.TokenCiphers, length)
 	for n := 0; n < length; n++ {
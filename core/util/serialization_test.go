@@ -1,8 +1,12 @@
 package util
 
 import (
+	"bytes"
+	"io"
 	"reflect"
 	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
 )
 
 func TestByteArray(t *testing.T) {
@@ -42,3 +46,67 @@ func TestUint64(t *testing.T) {
 		t.Errorf("Wrong uint64 serialization")
 	}
 }
+
+func TestFrame(t *testing.T) {
+	var buffer bytes.Buffer
+	WriteFrame(&buffer, []byte{1, 2, 3})
+	WriteFrame(&buffer, []byte{})
+	first, err := ReadFrame(&buffer)
+	if err != nil || !reflect.DeepEqual(first, []byte{1, 2, 3}) {
+		t.Errorf("Wrong frame encoding")
+	}
+	if second, err := ReadFrame(&buffer); err != nil || len(second) != 0 {
+		t.Errorf("Wrong empty frame encoding")
+	}
+	if _, err := ReadFrame(&buffer); err != io.EOF {
+		t.Errorf("Expected EOF at frame boundary")
+	}
+	WriteFrame(&buffer, []byte{1, 2, 3})
+	buffer.Truncate(5)
+	if _, err := ReadFrame(&buffer); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected unexpected EOF on truncated frame")
+	}
+	buffer.Reset()
+	WriteFrame(&buffer, []byte{1, 2, 3})
+	if _, err := ReadFrameLimit(&buffer, 2); err != ErrFrameTooLarge {
+		t.Errorf("Expected frame larger than limit rejected")
+	}
+}
+
+func TestTokenCiphers(t *testing.T) {
+	bytes := make([]byte, 0)
+	PutTokenCiphers(crypto.TokenCiphers{}, &bytes)
+	PutByte(7, &bytes)
+	empty, position := ParseTokenCiphers(bytes, 0)
+	if last, _ := ParseByte(bytes, position); len(empty) != 0 || last != 7 {
+		t.Errorf("Wrong empty TokenCiphers encoding")
+	}
+	ciphers := crypto.TokenCiphers{{Token: crypto.Token{1}, Cipher: []byte{2, 3}}, {Token: crypto.Token{4}, Cipher: []byte{5}}}
+	bytes = make([]byte, 0)
+	PutTokenCiphers(ciphers, &bytes)
+	inverse, position := ParseTokenCiphers(bytes, 0)
+	if !reflect.DeepEqual(ciphers, inverse) || position != len(bytes) {
+		t.Errorf("Wrong TokenCiphers encoding")
+	}
+}
+
+func TestParseShortInput(t *testing.T) {
+	if _, position := ParseTime([]byte{2, 0, 1, 2}, 0); position <= 4 {
+		t.Errorf("malformed time parsed")
+	}
+	if _, position := ParseTokenCiphers([]byte{255, 255, 1}, 0); position <= 3 {
+		t.Errorf("TokenCiphers longer than data parsed")
+	}
+	if _, position := ParseTokenCiphers([]byte{1, 0, 1, 2}, 0); position <= 4 {
+		t.Errorf("truncated TokenCiphers parsed")
+	}
+	if _, position := ParseTokenCiphers([]byte{0}, 0); position <= 1 {
+		t.Errorf("TokenCiphers without length parsed")
+	}
+	if _, position := ParseToken([]byte{1, 2}, 0); position <= 2 {
+		t.Errorf("short token parsed")
+	}
+	if _, position := ParseSignature([]byte{1, 2}, 0); position <= 2 {
+		t.Errorf("short signature parsed")
+	}
+}
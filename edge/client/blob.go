@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/node/blob"
+)
+
+// PutBlob uploads the payload read from r to the blob store of the node as the
+// blob of the content instruction with the hash. The content must have been
+// submitted to the node beforehand, carrying the root hash and the size of the
+// blob as given by blob.Root. It returns the root hash and the size stored.
+func (g *Gateway) PutBlob(content crypto.Hash, r io.Reader) (crypto.Hash, uint64, error) {
+	url := g.endpoint + "/blob?content=" + hex.EncodeToString(content[:])
+	response, err := g.client.Post(url, "application/octet-stream", r)
+	if err != nil {
+		return crypto.Hash{}, 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		return crypto.Hash{}, 0, decodeError(response)
+	}
+	var stored struct {
+		Root string `json:"root"`
+		Size uint64 `json:"size"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&stored); err != nil {
+		return crypto.Hash{}, 0, err
+	}
+	root, err := decodeHash(stored.Root)
+	return root, stored.Size, err
+}
+
+// FetchBlob downloads the blob with the root hash from the node and writes it
+// to w. The manifest must hash to root and every chunk must match its hash in
+// the manifest, otherwise blob.ErrCorruptedBlob is returned. Data written to w
+// before an error must be discarded.
+func (g *Gateway) FetchBlob(root crypto.Hash, w io.Writer) (uint64, error) {
+	manifest, err := g.manifest(root)
+	if err != nil {
+		return 0, err
+	}
+	return blob.Assemble(manifest, g.chunk, w)
+}
+
+func (g *Gateway) manifest(root crypto.Hash) (*blob.Manifest, error) {
+	response, err := g.client.Get(g.endpoint + "/blob?root=" + hex.EncodeToString(root[:]))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, decodeError(response)
+	}
+	var encoded struct {
+		Size   uint64   `json:"size"`
+		Chunks []string `json:"chunks"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&encoded); err != nil {
+		return nil, err
+	}
+	manifest := blob.Manifest{Size: encoded.Size, Chunks: make([]crypto.Hash, len(encoded.Chunks))}
+	for n, chunk := range encoded.Chunks {
+		if manifest.Chunks[n], err = decodeHash(chunk); err != nil {
+			return nil, err
+		}
+	}
+	if !manifest.Check() || manifest.Root() != root {
+		return nil, blob.ErrCorruptedBlob
+	}
+	return &manifest, nil
+}
+
+func (g *Gateway) chunk(hash crypto.Hash) ([]byte, error) {
+	response, err := g.client.Get(g.endpoint + "/chunk?hash=" + hex.EncodeToString(hash[:]))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, decodeError(response)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, blob.ChunkSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read chunk: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/node/blob"
+)
+
+func TestGatewayBlob(t *testing.T) {
+	store, err := blob.OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/blob" && r.Method == http.MethodPost:
+			if _, err := decodeHash(r.URL.Query().Get("content")); err != nil {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			root, size, err := store.Put(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"root":"0x%v","size":%v}`, hex.EncodeToString(root[:]), size)
+		case r.URL.Path == "/blob":
+			root, _ := decodeHash(r.URL.Query().Get("root"))
+			manifest, err := store.Manifest(root)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			chunks := make([]string, 0)
+			for _, chunk := range manifest.Chunks {
+				chunks = append(chunks, `"`+hex.EncodeToString(chunk[:])+`"`)
+			}
+			fmt.Fprintf(w, `{"size":%v,"chunks":[%v]}`, manifest.Size, strings.Join(chunks, ","))
+		case r.URL.Path == "/chunk":
+			hash, _ := decodeHash(r.URL.Query().Get("hash"))
+			data, _ := store.Chunk(hash)
+			if tampered {
+				data = append([]byte{}, data...)
+				data[0] ^= 1
+			}
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	gateway := NewGateway(server.URL)
+	defer gateway.Close()
+	payload := bytes.Repeat([]byte("aereum"), blob.ChunkSize/3)
+	expected, _, err := blob.Root(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, size, err := gateway.PutBlob(crypto.Hasher([]byte("content")), bytes.NewReader(payload))
+	if err != nil || size != uint64(len(payload)) || root != expected {
+		t.Fatalf("could not put blob: %v", err)
+	}
+	var fetched bytes.Buffer
+	if _, err := gateway.FetchBlob(root, &fetched); err != nil || !bytes.Equal(fetched.Bytes(), payload) {
+		t.Fatalf("could not fetch blob: %v", err)
+	}
+	tampered = true
+	if _, err := gateway.FetchBlob(root, io.Discard); err != blob.ErrCorruptedBlob {
+		t.Errorf("tampered chunk not detected: %v", err)
+	}
+	if _, err := gateway.FetchBlob(crypto.Hasher(payload), io.Discard); err == nil {
+		t.Error("fetched unknown blob")
+	}
+}
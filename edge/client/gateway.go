@@ -0,0 +1,238 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+var (
+	ErrUnknownWallet     = errors.New("wallet key not known by gateway")
+	ErrCannotPayOnWallet = errors.New("instruction cannot be paid by a wallet")
+	ErrUnknownReceipt    = errors.New("instruction not known by node")
+)
+
+// Receipt is the inclusion status of an instruction as reported by the node:
+// pending, included, rejected or expired. Epoch, Block and Index locate an
+// included instruction on the chain. Reason explains a rejection.
+type Receipt struct {
+	Hash   crypto.Hash
+	Status string
+	Epoch  uint64
+	Block  crypto.Hash
+	Index  int
+	Reason string
+}
+
+// Resolved checks if the instruction is no longer waiting to be included.
+func (r *Receipt) Resolved() bool {
+	return r.Status != "pending"
+}
+
+type receiptJSON struct {
+	Hash     string `json:"hash"`
+	Status   string `json:"status"`
+	Epoch    uint64 `json:"epoch"`
+	Block    string `json:"block"`
+	Index    int    `json:"index"`
+	Reason   string `json:"reason"`
+	Sequence uint64 `json:"sequence"`
+}
+
+func (r *receiptJSON) receipt() (*Receipt, error) {
+	hash, err := decodeHash(r.Hash)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{Hash: hash, Status: r.Status, Epoch: r.Epoch, Index: r.Index, Reason: r.Reason}
+	if r.Block != "" {
+		if receipt.Block, err = decodeHash(r.Block); err != nil {
+			return nil, err
+		}
+	}
+	return receipt, nil
+}
+
+func decodeHash(s string) (crypto.Hash, error) {
+	bytes, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(bytes) != crypto.Size {
+		return crypto.ZeroHash, errors.New("invalid hash")
+	}
+	return crypto.BytesToHash(bytes), nil
+}
+
+// Submission is the outcome of a submission through Publish or
+// PublishOnWallet. Err is nil if the node accepted the instruction on its
+// mempool.
+type Submission struct {
+	Hash crypto.Hash
+	Err  error
+}
+
+// Gateway implements edge.Gateway by submitting instructions to the HTTP API
+// of a node. Since Publish and PublishOnWallet do not return, the outcome of
+// every submission is kept and can be checked with Status, keyed by the hash
+// of the serialized instruction as published.
+type Gateway struct {
+	endpoint    string
+	client      *http.Client
+	mu          sync.Mutex
+	wallets     map[crypto.Token]crypto.PrivateKey
+	submissions map[crypto.Hash]error
+}
+
+// NewGateway returns a gateway for the node API at endpoint, for instance
+// http://localhost:7000.
+func NewGateway(endpoint string) *Gateway {
+	return &Gateway{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		client:      &http.Client{Timeout: 30 * time.Second},
+		wallets:     make(map[crypto.Token]crypto.PrivateKey),
+		submissions: make(map[crypto.Hash]error),
+	}
+}
+
+// AddWallet makes the key available to PublishOnWallet.
+func (g *Gateway) AddWallet(key crypto.PrivateKey) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.wallets[key.PublicKey()] = key
+}
+
+// Submit sends a signed instruction to the node and returns its hash.
+func (g *Gateway) Submit(instruction instructions.Instruction) (crypto.Hash, error) {
+	data := instruction.Serialize()
+	hash := crypto.Hasher(data)
+	body := fmt.Sprintf(`{"instruction":"%v"}`, base64.StdEncoding.EncodeToString(data))
+	response, err := g.client.Post(g.endpoint+"/instruction", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		return hash, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusAccepted {
+		return hash, decodeError(response)
+	}
+	return hash, nil
+}
+
+// SubmitOnWallet appends a fee paid by the wallet at the current fee of the
+// node and submits the instruction.
+func (g *Gateway) SubmitOnWallet(instruction instructions.Instruction, wallet crypto.Token) (crypto.Hash, error) {
+	g.mu.Lock()
+	key, ok := g.wallets[wallet]
+	g.mu.Unlock()
+	if !ok {
+		return crypto.ZeroHash, ErrUnknownWallet
+	}
+	fee, err := g.Fee()
+	if err != nil {
+		return crypto.ZeroHash, err
+	}
+	if !instructions.AppendWalletFee(instruction, key, fee) {
+		return crypto.ZeroHash, ErrCannotPayOnWallet
+	}
+	return g.Submit(instruction)
+}
+
+func (g *Gateway) record(hash crypto.Hash, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.submissions[hash] = err
+}
+
+// Publish submits the instruction. The outcome is available through Status.
+func (g *Gateway) Publish(instruction instructions.Instruction) {
+	hash, err := g.Submit(instruction)
+	g.record(hash, err)
+}
+
+// PublishOnWallet submits the instruction with a fee paid by the wallet. The
+// instruction is modified in place so its hash can be computed after the call.
+func (g *Gateway) PublishOnWallet(instruction instructions.Instruction, wallet crypto.Token) {
+	hash, err := g.SubmitOnWallet(instruction, wallet)
+	g.record(hash, err)
+}
+
+// Status returns the outcome of a submission through Publish or
+// PublishOnWallet, and false if no such submission was made.
+func (g *Gateway) Status(hash crypto.Hash) (Submission, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err, ok := g.submissions[hash]
+	return Submission{Hash: hash, Err: err}, ok
+}
+
+// Receipt asks the node for the receipt of an instruction. It returns
+// ErrUnknownReceipt if the node knows nothing about the instruction.
+func (g *Gateway) Receipt(hash crypto.Hash) (*Receipt, error) {
+	response, err := g.client.Get(g.endpoint + "/receipt?hash=" + hex.EncodeToString(hash[:]))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrUnknownReceipt
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, decodeError(response)
+	}
+	var receipt receiptJSON
+	if err := json.NewDecoder(response.Body).Decode(&receipt); err != nil {
+		return nil, err
+	}
+	return receipt.receipt()
+}
+
+// Fee returns the fee per byte currently suggested by the node.
+func (g *Gateway) Fee() (uint64, error) {
+	response, err := g.client.Get(g.endpoint + "/fee")
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, decodeError(response)
+	}
+	var fee struct {
+		Fee uint64 `json:"fee"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&fee); err != nil {
+		return 0, err
+	}
+	return fee.Fee, nil
+}
+
+// CurrentFee returns the fee per byte currently suggested by the node, or the
+// protocol minimum if the node cannot be reached.
+func (g *Gateway) CurrentFee() uint64 {
+	fee, err := g.Fee()
+	if err != nil || fee < instructions.MinimumFeePerByte {
+		return instructions.MinimumFeePerByte
+	}
+	return fee
+}
+
+// Close releases idle connections to the node.
+func (g *Gateway) Close() {
+	g.client.CloseIdleConnections()
+}
+
+func decodeError(response *http.Response) error {
+	var failure struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&failure); err != nil || failure.Error == "" {
+		return fmt.Errorf("node request failed: %v", response.Status)
+	}
+	return errors.New(failure.Error)
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+func TestGatewayPublishOnWallet(t *testing.T) {
+	var submitted []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fee":
+			fmt.Fprint(w, `{"fee":3,"baseFee":1,"minimumFee":1}`)
+		case "/instruction":
+			var request struct {
+				Instruction string `json:"instruction"`
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			submitted, _ = base64.StdEncoding.DecodeString(request.Instruction)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"hash":"0x00"}`)
+		}
+	}))
+	defer server.Close()
+
+	_, author := crypto.RandomAsymetricKey()
+	wallet, walletKey := crypto.RandomAsymetricKey()
+	react := instructions.React{EpochStamp: 1, Author: author.PublicKey(), Hash: []byte{1, 2, 3}, Reaction: 1}
+	react.Sign(author)
+
+	gateway := NewGateway(server.URL)
+	defer gateway.Close()
+	gateway.AddWallet(walletKey)
+	gateway.PublishOnWallet(&react, wallet)
+
+	hash := crypto.Hasher(react.Serialize())
+	if status, ok := gateway.Status(hash); !ok || status.Err != nil {
+		t.Fatalf("submission not recorded as accepted: %v", status.Err)
+	}
+	parsed := instructions.ParseReact(submitted)
+	if parsed == nil || parsed.Wallet != wallet {
+		t.Fatal("submitted instruction is not paid by wallet")
+	}
+	if parsed.Fee != 3*uint64(len(submitted)) {
+		t.Errorf("wrong fee %v for %v bytes", parsed.Fee, len(submitted))
+	}
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+type receiptsResponse struct {
+	Next     uint64        `json:"next"`
+	Receipts []receiptJSON `json:"receipts"`
+}
+
+// Tracker streams the receipts of instructions by long-polling the /receipts
+// endpoint of a node. Every change of status of a tracked instruction is
+// delivered by Receive. An instruction is no longer tracked once it is
+// included, rejected or expired.
+type Tracker struct {
+	endpoint string
+	client   *http.Client
+	mu       sync.Mutex
+	tracked  map[crypto.Hash]string // last status delivered
+	started  bool
+	next     uint64
+	queue    chan *Receipt
+	added    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTracker returns a tracker for the node API at endpoint, for instance
+// http://localhost:7000.
+func NewTracker(endpoint string) *Tracker {
+	tracker := &Tracker{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: (PollWait + 10) * time.Second},
+		tracked:  make(map[crypto.Hash]string),
+		queue:    make(chan *Receipt, 256),
+		added:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go tracker.poll()
+	return tracker
+}
+
+// Track starts following the receipt of the instruction with the hash. The
+// current receipt known by the node is delivered first.
+func (t *Tracker) Track(hash crypto.Hash) error {
+	select {
+	case <-t.stop:
+		return ErrClosed
+	default:
+	}
+	t.mu.Lock()
+	if _, ok := t.tracked[hash]; !ok {
+		t.tracked[hash] = ""
+		t.started = false
+	}
+	t.mu.Unlock()
+	select {
+	case t.added <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Receive blocks until the next receipt update arrives. It returns nil once
+// the tracker is closed.
+func (t *Tracker) Receive() *Receipt {
+	select {
+	case receipt := <-t.queue:
+		return receipt
+	case <-t.done:
+		return nil
+	}
+}
+
+// Close stops the tracker. Pending calls to Receive return nil.
+func (t *Tracker) Close() {
+	select {
+	case <-t.stop:
+		return
+	default:
+		close(t.stop)
+	}
+	<-t.done
+}
+
+func (t *Tracker) query() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	values := url.Values{}
+	for hash := range t.tracked {
+		values.Add("hash", hex.EncodeToString(hash[:]))
+	}
+	if t.started {
+		values.Set("since", fmt.Sprintf("%v", t.next))
+	}
+	values.Set("wait", fmt.Sprintf("%v", PollWait))
+	return values.Encode()
+}
+
+// updated keeps the receipt as the last delivered status of its instruction
+// and stops tracking resolved instructions. It returns false if the status was
+// already delivered or the instruction is not tracked.
+func (t *Tracker) updated(receipt *Receipt) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok := t.tracked[receipt.Hash]
+	if !ok || last == receipt.Status {
+		return false
+	}
+	if receipt.Resolved() {
+		delete(t.tracked, receipt.Hash)
+	} else {
+		t.tracked[receipt.Hash] = receipt.Status
+	}
+	return true
+}
+
+func (t *Tracker) poll() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		t.mu.Lock()
+		idle := len(t.tracked) == 0
+		t.mu.Unlock()
+		if idle {
+			select {
+			case <-t.added:
+			case <-t.stop:
+				return
+			}
+			continue
+		}
+		response, err := t.fetch()
+		if errors.Is(err, context.Canceled) {
+			continue
+		}
+		if err != nil {
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-t.stop:
+				return
+			}
+		}
+		t.mu.Lock()
+		t.next = response.Next
+		t.started = true
+		t.mu.Unlock()
+		for _, encoded := range response.Receipts {
+			receipt, err := encoded.receipt()
+			if err != nil || !t.updated(receipt) {
+				continue
+			}
+			select {
+			case t.queue <- receipt:
+			case <-t.stop:
+				return
+			}
+		}
+	}
+}
+
+// fetch long-polls the receipts. The request is abandoned when the tracker is
+// closed or a new instruction is tracked, so that the next poll includes it.
+func (t *Tracker) fetch() (*receiptsResponse, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-t.stop:
+			cancel()
+		case <-t.added:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, t.endpoint+"/receipts?"+t.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("receipts request failed: %v", response.Status)
+	}
+	var receipts receiptsResponse
+	if err := json.NewDecoder(response.Body).Decode(&receipts); err != nil {
+		return nil, err
+	}
+	return &receipts, nil
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+func TestTrackerReceive(t *testing.T) {
+	hash := crypto.Hasher([]byte("instruction"))
+	encoded := hex.EncodeToString(hash[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hash") != encoded {
+			t.Errorf("tracked hash not on receipts query")
+		}
+		switch r.URL.Query().Get("since") {
+		case "":
+			fmt.Fprintf(w, `{"next":1,"receipts":[{"hash":"0x%v","status":"pending","sequence":1}]}`, encoded)
+		case "1":
+			fmt.Fprintf(w, `{"next":2,"receipts":[{"hash":"0x%v","status":"rejected","reason":"instruction failed validation","sequence":2}]}`, encoded)
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	tracker := NewTracker(server.URL)
+	if err := tracker.Track(hash); err != nil {
+		t.Fatal(err)
+	}
+	pending := tracker.Receive()
+	if pending == nil || pending.Hash != hash || pending.Resolved() {
+		t.Fatal("tracker did not deliver pending receipt")
+	}
+	rejected := tracker.Receive()
+	if rejected == nil || rejected.Status != "rejected" || rejected.Reason != "instruction failed validation" {
+		t.Fatal("tracker did not deliver rejection")
+	}
+	tracker.Close()
+	if tracker.Receive() != nil {
+		t.Error("closed tracker should not deliver receipts")
+	}
+}
@@ -0,0 +1,201 @@
+// Package client implements the edge interfaces against the HTTP API of an
+// aereum node.
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+// PollWait is the number of seconds the node is asked to hold a long-poll.
+const PollWait = 30
+
+var ErrClosed = errors.New("client closed")
+
+type feedResponse struct {
+	Next         uint64   `json:"next"`
+	Instructions []string `json:"instructions"`
+}
+
+// Relay implements edge.Realay by long-polling the /feed endpoint of a node.
+// Instructions touching any subscribed token are delivered by Receive in the
+// order they were committed.
+type Relay struct {
+	endpoint   string
+	client     *http.Client
+	mu         sync.Mutex
+	tokens     map[crypto.Token]struct{}
+	started    bool
+	next       uint64
+	queue      chan instructions.Instruction
+	subscribed chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewRelay returns a relay for the node API at endpoint, for instance
+// http://localhost:7000.
+func NewRelay(endpoint string) *Relay {
+	relay := &Relay{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		client:     &http.Client{Timeout: (PollWait + 10) * time.Second},
+		tokens:     make(map[crypto.Token]struct{}),
+		queue:      make(chan instructions.Instruction, 256),
+		subscribed: make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go relay.poll()
+	return relay
+}
+
+// Receive blocks until the next instruction arrives. It returns nil once the
+// relay is closed.
+func (r *Relay) Receive() instructions.Instruction {
+	select {
+	case instruction := <-r.queue:
+		return instruction
+	case <-r.done:
+		return nil
+	}
+}
+
+// Subscribe adds a token to the subscription. Instructions committed from then
+// on that are authored by the token, addressed to it as a stage or paying it
+// are delivered.
+func (r *Relay) Subscribe(token crypto.Token) error {
+	select {
+	case <-r.stop:
+		return ErrClosed
+	default:
+	}
+	r.mu.Lock()
+	r.tokens[token] = struct{}{}
+	r.mu.Unlock()
+	select {
+	case r.subscribed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close stops the relay. Pending calls to Receive return nil.
+func (r *Relay) Close() {
+	select {
+	case <-r.stop:
+		return
+	default:
+		close(r.stop)
+	}
+	<-r.done
+}
+
+func (r *Relay) query() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := url.Values{}
+	for token := range r.tokens {
+		values.Add("token", hex.EncodeToString(token[:]))
+	}
+	if r.started {
+		values.Set("since", fmt.Sprintf("%v", r.next))
+	}
+	values.Set("wait", fmt.Sprintf("%v", PollWait))
+	return values.Encode()
+}
+
+func (r *Relay) poll() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		r.mu.Lock()
+		idle := len(r.tokens) == 0
+		r.mu.Unlock()
+		if idle {
+			select {
+			case <-r.subscribed:
+			case <-r.stop:
+				return
+			}
+			continue
+		}
+		response, err := r.fetch()
+		if errors.Is(err, context.Canceled) {
+			continue
+		}
+		if err != nil {
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-r.stop:
+				return
+			}
+		}
+		r.mu.Lock()
+		r.next = response.Next
+		r.started = true
+		r.mu.Unlock()
+		for _, encoded := range response.Instructions {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(data) < 2 {
+				continue
+			}
+			if instruction := instructions.ParseInstruction(data); instruction != nil {
+				select {
+				case r.queue <- instruction:
+				case <-r.stop:
+					return
+				}
+			}
+		}
+	}
+}
+
+// fetch long-polls the feed. The request is abandoned when the relay is closed
+// or a new token is subscribed, so that the next poll includes it.
+func (r *Relay) fetch() (*feedResponse, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-r.subscribed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint+"/feed?"+r.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed request failed: %v", response.Status)
+	}
+	var feed feedResponse
+	if err := json.NewDecoder(response.Body).Decode(&feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
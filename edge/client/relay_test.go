@@ -0,0 +1,45 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+func TestRelayReceive(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	deposit := instructions.Deposit{EpochStamp: 10, Token: token, Value: 100, Fee: 1000}
+	deposit.Sign(key)
+	encoded := base64.StdEncoding.EncodeToString(deposit.Serialize())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != hex.EncodeToString(token[:]) {
+			t.Errorf("subscribed token not on feed query")
+		}
+		if r.URL.Query().Get("since") == "" {
+			fmt.Fprintf(w, `{"next":1,"instructions":["%v"]}`, encoded)
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	relay := NewRelay(server.URL)
+	if err := relay.Subscribe(token); err != nil {
+		t.Fatal(err)
+	}
+	received, ok := relay.Receive().(*instructions.Deposit)
+	if !ok || !reflect.DeepEqual(*received, deposit) {
+		t.Error("relay did not deliver subscribed instruction")
+	}
+	relay.Close()
+	if relay.Receive() != nil {
+		t.Error("closed relay should not deliver instructions")
+	}
+}
@@ -0,0 +1,214 @@
+package edge
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+var ErrInvalidContentLog = errors.New("content log holds an invalid instruction")
+
+// Unencrypted Content
+type Content struct {
+	Epoch       uint64
+	Author      crypto.Token
+	Stage       crypto.Token
+	Sponsored   bool
+	Encrypted   bool
+	ContentType string
+	Content     []byte
+}
+
+func newContent(content *instructions.Content) Content {
+	return Content{
+		Epoch:       content.EpochStamp,
+		Author:      content.Author,
+		Stage:       content.Stage,
+		Encrypted:   content.Encrypted,
+		Sponsored:   content.Sponsored,
+		ContentType: content.ContentType,
+		Content:     content.Content,
+	}
+}
+
+// contentRecord locates a content on the log.
+type contentRecord struct {
+	stage  crypto.Token
+	epoch  uint64
+	offset int64
+}
+
+// ContentStore keeps the most recent contents in a memory cache. A disk store
+// also appends every content instruction to a log of frames written by
+// util.WriteFrame, which is replayed when the store is opened. A content
+// instruction is stored once, so that replaying instructions into the store
+// does not duplicate them.
+type ContentStore struct {
+	mu        sync.Mutex
+	file      *os.File // nil for a memory store
+	size      int64    // offset of the end of the last complete frame
+	records   []contentRecord
+	known     map[crypto.Hash]struct{} // hashes of the stored instructions
+	content   []Content
+	cacheSize int
+}
+
+func NewContentMemoryStore(cache int) *ContentStore {
+	return &ContentStore{
+		records:   make([]contentRecord, 0),
+		known:     make(map[crypto.Hash]struct{}),
+		content:   make([]Content, 0),
+		cacheSize: cache,
+	}
+}
+
+// OpenContentDiskStore opens the content log at filePath and replays it into
+// the cache. A frame left truncated by a crash is cut from the log.
+func OpenContentDiskStore(cache int, filePath string) (*ContentStore, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	store := NewContentMemoryStore(cache)
+	store.file = file
+	if err := store.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewContentDiskStore creates an empty content log at filePath. It fails if
+// the file already exists.
+func NewContentDiskStore(cache int, filePath string) (*ContentStore, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	store := NewContentMemoryStore(cache)
+	store.file = file
+	return store, nil
+}
+
+func (c *ContentStore) replay() error {
+	reader := bufio.NewReader(c.file)
+	for {
+		data, err := util.ReadFrame(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return c.file.Truncate(c.size)
+		}
+		if err != nil {
+			return err
+		}
+		content := instructions.ParseContent(data)
+		if content == nil {
+			return ErrInvalidContentLog
+		}
+		c.add(content, crypto.Hasher(data), c.size)
+		c.size += int64(4 + len(data))
+	}
+}
+
+// add must be called with the lock held.
+func (c *ContentStore) add(content *instructions.Content, hash crypto.Hash, offset int64) {
+	c.known[hash] = struct{}{}
+	c.records = append(c.records, contentRecord{stage: content.Stage, epoch: content.EpochStamp, offset: offset})
+	if c.cacheSize <= 0 {
+		return
+	}
+	if len(c.content) == c.cacheSize {
+		c.content = c.content[1:]
+	}
+	c.content = append(c.content, newContent(content))
+}
+
+// AppendContent adds the content to the cache and to the end of the log.
+// Content already stored is ignored.
+func (c *ContentStore) AppendContent(content *instructions.Content) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data := content.Serialize()
+	hash := crypto.Hasher(data)
+	if _, ok := c.known[hash]; ok {
+		return nil
+	}
+	if c.file == nil {
+		c.add(content, hash, 0)
+		return nil
+	}
+	if _, err := c.file.Seek(c.size, io.SeekStart); err != nil {
+		return err
+	}
+	if err := util.WriteFrame(c.file, data); err != nil {
+		// a partial frame is overwritten by the next append and cut on replay
+		return err
+	}
+	c.add(content, hash, c.size)
+	c.size += int64(4 + len(data))
+	return nil
+}
+
+// Recent returns the cached contents, oldest first.
+func (c *ContentStore) Recent() []Content {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	recent := make([]Content, len(c.content))
+	copy(recent, c.content)
+	return recent
+}
+
+// Range calls f on the contents of the stage with epoch between from and to,
+// both included, in order of appending, until f returns false. A disk store
+// reads them from the log, while a memory store only knows its cache.
+func (c *ContentStore) Range(stage crypto.Token, from, to uint64, f func(*Content) bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		for n := range c.content {
+			content := c.content[n]
+			if content.Stage == stage && content.Epoch >= from && content.Epoch <= to {
+				if !f(&content) {
+					return nil
+				}
+			}
+		}
+		return nil
+	}
+	for _, record := range c.records {
+		if record.stage != stage || record.epoch < from || record.epoch > to {
+			continue
+		}
+		data, err := util.ReadFrame(io.NewSectionReader(c.file, record.offset, c.size-record.offset))
+		if err != nil {
+			return err
+		}
+		parsed := instructions.ParseContent(data)
+		if parsed == nil {
+			return ErrInvalidContentLog
+		}
+		content := newContent(parsed)
+		if !f(&content) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Close closes the log of a disk store.
+func (c *ContentStore) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
@@ -0,0 +1,99 @@
+package edge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+func signedContent(epoch uint64, stage crypto.PrivateKey, text string) *instructions.Content {
+	_, author := crypto.RandomAsymetricKey()
+	content := instructions.Content{
+		EpochStamp:  epoch,
+		Published:   epoch,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		ContentType: "text",
+		Content:     []byte(text),
+	}
+	content.SubmitSign(stage)
+	content.Sign(author, crypto.ZeroToken)
+	content.AppendFee(author, 10)
+	return &content
+}
+
+func TestContentDiskStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "content")
+	_, stage := crypto.RandomAsymetricKey()
+	_, other := crypto.RandomAsymetricKey()
+	store, err := NewContentDiskStore(2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		if err := store.AppendContent(signedContent(epoch, stage, "post")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.AppendContent(signedContent(2, other, "other"))
+	store.Close()
+	if _, err := NewContentDiskStore(2, path); err == nil {
+		t.Error("existing log overwritten")
+	}
+
+	// simulate a crash in the middle of a frame
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.Write([]byte{200, 0, 0, 0, 1, 2})
+	file.Close()
+
+	store, err = OpenContentDiskStore(2, path)
+	if err != nil {
+		t.Fatalf("could not replay log: %v", err)
+	}
+	if recent := store.Recent(); len(recent) != 2 || recent[0].Epoch != 3 || recent[1].Stage != other.PublicKey() {
+		t.Errorf("wrong cache after replay: %+v", recent)
+	}
+	store.AppendContent(signedContent(4, stage, "after"))
+	store.Close()
+
+	store, err = OpenContentDiskStore(2, path)
+	if err != nil {
+		t.Fatalf("could not replay log after recovery: %v", err)
+	}
+	defer store.Close()
+	epochs := make([]uint64, 0)
+	store.Range(stage.PublicKey(), 2, 4, func(content *Content) bool {
+		epochs = append(epochs, content.Epoch)
+		return true
+	})
+	if len(epochs) != 3 || epochs[0] != 2 || epochs[2] != 4 {
+		t.Errorf("wrong contents of stage: %v", epochs)
+	}
+}
+
+func TestContentDiskStoreCorrupted(t *testing.T) {
+	_, stage := crypto.RandomAsymetricKey()
+	valid := signedContent(1, stage, "post").Serialize()
+	for name, frame := range map[string][]byte{
+		"empty":     {},
+		"short":     {0},
+		"truncated": valid[:len(valid)/2],
+		"corrupted": append([]byte{valid[0], 200}, valid[2:]...),
+	} {
+		path := filepath.Join(t.TempDir(), "content")
+		var log bytes.Buffer
+		util.WriteFrame(&log, valid)
+		util.WriteFrame(&log, frame)
+		if err := os.WriteFile(path, log.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenContentDiskStore(2, path); err != ErrInvalidContentLog {
+			t.Errorf("%v frame replayed: %v", name, err)
+		}
+	}
+}
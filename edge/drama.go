@@ -0,0 +1,240 @@
+package edge
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// DefaultFeedSize is the number of contents kept on the merged feed of a
+// drama.
+const DefaultFeedSize = 1 << 12
+
+var ErrInvalidStage = errors.New("invalid stage snapshot")
+
+// Drama is the client side state of the stages followed by a user. It
+// consumes the instructions of a relay, routes them to their stages and keeps
+// a feed of the contents of every stage merged in order of epoch. Content
+// instructions are persisted on ContentIO and the other stage instructions on
+// StagesIO, as frames written by util.WriteFrame, so that the drama can be
+// rebuilt with Replay.
+type Drama struct {
+	mu        *sync.Mutex // the lock of the author, if any, guarding the stages
+	Author    *Author // nil for a user without keys, who reads public stages
+	Stages    map[crypto.Token]*Stage
+	ContentIO io.WriteCloser
+	StagesIO  io.WriteCloser
+	feed      []Content
+	feedSize  int
+}
+
+// NewDrama returns a drama persisting on the writers. The stages of the author
+// are followed, if any, under the lock of the author.
+func NewDrama(author *Author, contentIO, stagesIO io.WriteCloser) *Drama {
+	drama := &Drama{
+		mu:        &sync.Mutex{},
+		Author:    author,
+		Stages:    make(map[crypto.Token]*Stage),
+		ContentIO: contentIO,
+		StagesIO:  stagesIO,
+		feed:      make([]Content, 0),
+		feedSize:  DefaultFeedSize,
+	}
+	if author != nil {
+		drama.mu = &author.mu
+		drama.Stages = author.Stages
+	}
+	return drama
+}
+
+// Follow starts keeping the state of the stage.
+func (d *Drama) Follow(stage crypto.Token) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.Stages[stage]; !ok {
+		d.Stages[stage] = newStage(stage)
+	}
+}
+
+// Incorporate routes an instruction to the stage it is addressed to and
+// persists it. Content is appended to the feed, decrypted if the author holds
+// a read key of the stage, and returned. Instructions of stages not followed
+// are ignored. Instructions kept by their stage are persisted even if the
+// author fails to open them, so that Replay rebuilds the same stage.
+func (d *Drama) Incorporate(instruction instructions.Instruction) (*Content, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if instruction == nil {
+		return nil, nil
+	}
+	content, kept, err := d.incorporate(instruction)
+	if !kept {
+		return content, err
+	}
+	writer := d.StagesIO
+	if instruction.Kind() == instructions.IContent {
+		writer = d.ContentIO
+	}
+	if writer != nil {
+		if writeErr := util.WriteFrame(writer, instruction.Serialize()); writeErr != nil {
+			return content, writeErr
+		}
+	}
+	return content, err
+}
+
+// incorporate routes the instruction and reports if its stage kept it.
+func (d *Drama) incorporate(instruction instructions.Instruction) (*Content, bool, error) {
+	stage, ok := d.Stages[instructionStage(instruction)]
+	if !ok {
+		if accept, ok := instruction.(*instructions.AcceptJoinRequest); !ok || d.Author == nil || accept.Member != d.Author.Author {
+			return nil, false, StageNotFoundError
+		}
+	}
+	var content *Content
+	var kept bool
+	var err error
+	if d.Author != nil {
+		content, kept, err = d.Author.incorporate(instruction)
+	} else if err = stage.incorporate(instruction); err == nil {
+		kept = true
+		if v, ok := instruction.(*instructions.Content); ok {
+			published := newContent(v)
+			content = &published
+		}
+	}
+	if content != nil {
+		d.appendFeed(*content)
+	}
+	return content, kept, err
+}
+
+// appendFeed inserts the content on the feed after every content of the same
+// or an earlier epoch, and drops the oldest contents beyond the feed size.
+func (d *Drama) appendFeed(content Content) {
+	n := sort.Search(len(d.feed), func(n int) bool { return d.feed[n].Epoch > content.Epoch })
+	d.feed = append(d.feed, Content{})
+	copy(d.feed[n+1:], d.feed[n:])
+	d.feed[n] = content
+	if excess := len(d.feed) - d.feedSize; excess > 0 {
+		d.feed = d.feed[excess:]
+	}
+}
+
+// Feed returns the contents of every followed stage with epoch between from
+// and to, both included, in order of epoch.
+func (d *Drama) Feed(from, to uint64) []Content {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	start := sort.Search(len(d.feed), func(n int) bool { return d.feed[n].Epoch >= from })
+	end := sort.Search(len(d.feed), func(n int) bool { return d.feed[n].Epoch > to })
+	feed := make([]Content, 0, end-start)
+	return append(feed, d.feed[start:end]...)
+}
+
+// Listen subscribes the relay to every followed stage and incorporates the
+// instructions received until the relay is closed.
+func (d *Drama) Listen(relay Realay) error {
+	d.mu.Lock()
+	for stage := range d.Stages {
+		if err := relay.Subscribe(stage); err != nil {
+			d.mu.Unlock()
+			return err
+		}
+	}
+	d.mu.Unlock()
+	for {
+		instruction := relay.Receive()
+		if instruction == nil {
+			return nil
+		}
+		d.Incorporate(instruction)
+	}
+}
+
+// Replay incorporates the instructions persisted by a drama, the stage
+// instructions first, without persisting them again. A frame left truncated by
+// a crash ends its log, while a complete frame not holding an instruction
+// fails the replay with ErrInvalidContentLog.
+func (d *Drama) Replay(stages, contents io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, log := range []io.Reader{stages, contents} {
+		if log == nil {
+			continue
+		}
+		for {
+			data, err := util.ReadFrame(log)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			instruction := instructions.ParseInstruction(data)
+			if instruction == nil {
+				return ErrInvalidContentLog
+			}
+			d.incorporate(instruction)
+		}
+	}
+	return nil
+}
+
+// Snapshot writes the state of every followed stage, with the histories of
+// its keys and its members, as frames on w.
+func (d *Drama) Snapshot(w io.Writer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, stage := range d.Stages {
+		if err := util.WriteFrame(w, stage.Serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore follows the stages written by Snapshot. A stage already followed is
+// replaced, except for its content store.
+func (d *Drama) Restore(r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		data, err := util.ReadFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stage := ParseStage(data)
+		if stage == nil {
+			return ErrInvalidStage
+		}
+		if existing, ok := d.Stages[stage.Token]; ok {
+			stage.Content = existing.Content
+		}
+		d.Stages[stage.Token] = stage
+	}
+}
+
+// Close closes the writers of the drama.
+func (d *Drama) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var err error
+	for _, writer := range []io.WriteCloser{d.ContentIO, d.StagesIO} {
+		if writer == nil {
+			continue
+		}
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,242 @@
+package edge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error { return nil }
+
+type sliceRelay struct {
+	subscribed   map[crypto.Token]struct{}
+	instructions []instructions.Instruction
+}
+
+func (r *sliceRelay) Subscribe(stage crypto.Token) error {
+	r.subscribed[stage] = struct{}{}
+	return nil
+}
+
+func (r *sliceRelay) Receive() instructions.Instruction {
+	if len(r.instructions) == 0 {
+		return nil
+	}
+	instruction := r.instructions[0]
+	r.instructions = r.instructions[1:]
+	return instruction
+}
+
+func (r *sliceRelay) Close() {}
+
+func TestDramaFeed(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	member := newTestAuthor(t, "member")
+	first, _ := owner.CreateStage(1, "first", 0, 0)
+	second, _ := owner.CreateStage(1, "second", 0, 0)
+	join, _ := member.JoinStage(2, first.Stage, "hello")
+	request := parsed(t, join, member.Signer).(*instructions.JoinStage)
+	accept, err := owner.AcceptJoinRequest(3, request, PUBLISH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := &sliceRelay{subscribed: make(map[crypto.Token]struct{})}
+	relay.instructions = append(relay.instructions, parsed(t, first, owner.Signer), request, parsed(t, accept, owner.Signer))
+	for _, post := range []struct {
+		epoch uint64
+		stage crypto.Token
+		text  string
+	}{{6, first.Stage, "c"}, {4, second.Stage, "a"}, {5, first.Stage, "b"}} {
+		content, err := owner.Content(post.epoch, post.stage, "text", []byte(post.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		relay.instructions = append(relay.instructions, parsed(t, content, owner.Signer))
+	}
+
+	contents, stages := &bufferCloser{}, &bufferCloser{}
+	viewer := NewDrama(nil, contents, stages)
+	viewer.Follow(first.Stage)
+	viewer.Follow(second.Stage)
+	if err := viewer.Listen(relay); err != nil {
+		t.Fatal(err)
+	}
+	if len(relay.subscribed) != 2 {
+		t.Errorf("relay subscribed to %v stages", len(relay.subscribed))
+	}
+	stage := viewer.Stages[first.Stage]
+	if !stage.Live || stage.Description != "first" {
+		t.Error("stage creation not incorporated")
+	}
+	if _, ok := stage.Members.Submitors[member.Author]; !ok || len(stage.Members.Requests) != 0 {
+		t.Error("accepted member not recorded")
+	}
+	check := func(drama *Drama) {
+		feed := drama.Feed(0, 10)
+		if len(feed) != 3 {
+			t.Fatalf("feed has %v contents", len(feed))
+		}
+		for n, text := range []string{"a", "b", "c"} {
+			if string(feed[n].Content) != text {
+				t.Errorf("wrong feed order: %s at %v", feed[n].Content, n)
+			}
+		}
+		if feed := drama.Feed(5, 5); len(feed) != 1 || string(feed[0].Content) != "b" {
+			t.Error("wrong feed range")
+		}
+	}
+	check(viewer)
+
+	replayed := NewDrama(nil, nil, nil)
+	replayed.Follow(first.Stage)
+	replayed.Follow(second.Stage)
+	if err := replayed.Replay(bytes.NewReader(stages.Bytes()), bytes.NewReader(contents.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	check(replayed)
+	if _, ok := replayed.Stages[first.Stage].Members.Readers[member.Author]; !ok {
+		t.Error("members not replayed")
+	}
+}
+
+func TestDramaReplayAuthor(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	member := newTestAuthor(t, "member")
+	create, _ := owner.CreateStage(1, "stage", ENCRYPTED|CLOSED, 0)
+	join, _ := member.JoinStage(2, create.Stage, "hello")
+	accept, err := owner.AcceptJoinRequest(3, parsed(t, join, member.Signer).(*instructions.JoinStage), PUBLISH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultSize := func() int64 {
+		info, err := member.Secrets.storage.(*os.File).Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	contents, stages := &bufferCloser{}, &bufferCloser{}
+	drama := NewDrama(member, contents, stages)
+	if _, err := drama.Incorporate(parsed(t, accept, owner.Signer)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.newReadKey(owner.Stages[create.Stage], 4); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := owner.Content(5, create.Stage, "text", []byte("secret"))
+	if _, err := drama.Incorporate(parsed(t, secret, owner.Signer)); err != ErrCannotDecrypt {
+		t.Fatalf("content opened without read key: %v", err)
+	}
+	if contents.Len() == 0 {
+		t.Error("content kept by the stage not persisted")
+	}
+
+	size := vaultSize()
+	replayed := NewDrama(member, nil, nil)
+	if err := replayed.Replay(bytes.NewReader(stages.Bytes()), bytes.NewReader(contents.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if vaultSize() != size {
+		t.Error("replay stored the keys of the accept again")
+	}
+}
+
+func TestDramaReplayCorrupted(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	create, _ := owner.CreateStage(1, "stage", 0, 0)
+	content, err := owner.Content(2, create.Stage, "text", []byte("post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := parsed(t, content, owner.Signer).Serialize()
+	for name, frame := range map[string][]byte{
+		"short":     {instructions.IContent},
+		"truncated": valid[:len(valid)/2],
+	} {
+		var log bytes.Buffer
+		util.WriteFrame(&log, valid)
+		util.WriteFrame(&log, frame)
+		drama := NewDrama(nil, nil, nil)
+		drama.Follow(create.Stage)
+		if err := drama.Replay(nil, &log); err != ErrInvalidContentLog {
+			t.Errorf("%v frame replayed: %v", name, err)
+		}
+	}
+	var log bytes.Buffer
+	util.WriteFrame(&log, valid)
+	log.Write([]byte{200, 0, 0, 0, 1})
+	drama := NewDrama(nil, nil, nil)
+	drama.Follow(create.Stage)
+	if err := drama.Replay(nil, &log); err != nil || len(drama.Feed(0, 10)) != 1 {
+		t.Errorf("log with frame truncated by a crash not replayed: %v", err)
+	}
+}
+
+func TestDramaReplayPersistedContent(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	create, _ := owner.CreateStage(1, "stage", 0, 0)
+	content, err := owner.Content(2, create.Stage, "text", []byte("post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "content")
+	store, err := NewContentDiskStore(2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := &bufferCloser{}
+	drama := NewDrama(owner, contents, nil)
+	drama.Stages[create.Stage].Content = store
+	if _, err := drama.Incorporate(parsed(t, content, owner.Signer)); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 2; n++ {
+		if err := drama.Replay(nil, bytes.NewReader(contents.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+	if store, err = OpenContentDiskStore(2, path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if recent := store.Recent(); len(recent) != 1 {
+		t.Errorf("content stored %v times", len(recent))
+	}
+}
+
+func TestDramaSharesAuthorLock(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	create, _ := owner.CreateStage(1, "stage", 0, 0)
+	drama := NewDrama(owner, nil, nil)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for epoch := uint64(2); epoch < 10; epoch++ {
+			owner.CreateStage(epoch, "other", 0, 0)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 8; n++ {
+			drama.Follow(create.Stage)
+			drama.Feed(0, 10)
+		}
+	}()
+	wg.Wait()
+	if len(drama.Stages) != 9 {
+		t.Errorf("drama follows %v stages", len(drama.Stages))
+	}
+}
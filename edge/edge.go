@@ -2,11 +2,12 @@ package edge
 
 import (
 	"errors"
-	"io"
+	"sync"
 
 	"github.com/lienkolabs/aereum/core/crypto"
 	"github.com/lienkolabs/aereum/core/crypto/dh"
 	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
 )
 
 const (
@@ -17,12 +18,20 @@ const (
 	MODERATED = 1 << 2
 )
 
+// DefaultContentCache is the number of recent contents kept in memory for
+// every stage.
+const DefaultContentCache = 1 << 10
+
 var (
 	InsufficientKnowledgeError = errors.New("user does not have knowledge to perform action")
 	StageNotFoundError         = errors.New("stage not found")
+	InvalidAcceptError         = errors.New("accept join request is not addressed to user or cannot be opened")
 )
 
+// Author holds the keys of a user and the stages it knows of. Its methods are
+// safe for concurrent use, and a drama of the author shares its lock.
 type Author struct {
+	mu        sync.Mutex // guards Stages, and is the lock of the drama of the author
 	Author    crypto.Token
 	Attorney  crypto.Token
 	Signer    crypto.PrivateKey
@@ -33,65 +42,20 @@ type Author struct {
 	Gateway   Gateway
 }
 
-// Unencrypted Content
-type Content struct {
-	Author      crypto.Token
-	Stage       crypto.Token
-	Sponsored   bool
-	Encrypted   bool
-	ContentType string
-	Content     []byte
-}
-
-type NullWriterCloser struct{}
-
-func (n NullWriterCloser) Write(b []byte) (int, error) {
-	return len(b), nil
-}
-
-func (n NullWriterCloser) Close() error {
-	return nil
-}
-
-func NewContentMemoryStore(cache int) *ContentStore {
-	return &ContentStore{
-		io:        NullWriterCloser{},
-		content:   make([]Content, 0),
-		cacheSize: cache,
+// NewAuthor returns an author signing instructions with signer, either its
+// own key or the key of an attorney.
+func NewAuthor(author crypto.Token, signer crypto.PrivateKey, secrets *SecureVault) *Author {
+	a := &Author{
+		Author:    author,
+		Signer:    signer,
+		Stages:    make(map[crypto.Token]*Stage),
+		Secrets:   secrets,
+		Ephemeral: make(map[crypto.Token]crypto.Token),
 	}
-}
-
-func OpenContentDiskStore(cache int, filePath string) (*ContentStore, error) {
-	return nil, nil
-}
-
-func NewContentDiskStore(cache int, filePath string) (*ContentStore, error) {
-	return nil, nil
-}
-
-type ContentStore struct {
-	io        io.WriteCloser
-	content   []Content
-	cacheSize int
-}
-
-func (c *ContentStore) AppendContent(content *instructions.Content) error {
-	newContent := Content{
-		Encrypted:   content.Encrypted,
-		Sponsored:   content.Sponsored,
-		ContentType: content.ContentType,
-		Content:     content.Content,
-	}
-	if len(c.content) < c.cacheSize {
-		c.content = append(c.content, newContent)
-	} else {
-		c.content = append(c.content[:len(c.content)-1], newContent)
-	}
-	bytes := content.Serialize()
-	if n, err := c.io.Write(bytes); n != len(bytes) {
-		return err
+	if token := signer.PublicKey(); token != author {
+		a.Attorney = token
 	}
-	return nil
+	return a
 }
 
 // Stage keep information about stages.
@@ -101,8 +65,10 @@ func (c *ContentStore) AppendContent(content *instructions.Content) error {
 type Stage struct {
 	Token       crypto.Token
 	Flag        byte
+	Permissions byte // ENCRYPTED, CLOSED and MODERATED as set by the owner
 	Description string
 	Public      bool
+	Read        TokenHistory // identifiers of the read keys, see CipherKeyID
 	Submission  TokenHistory
 	Moderation  TokenHistory
 	Content     *ContentStore
@@ -110,10 +76,34 @@ type Stage struct {
 	Live        bool
 }
 
+func newStage(token crypto.Token) *Stage {
+	return &Stage{
+		Token:      token,
+		Public:     true,
+		Read:       make(TokenHistory, 0),
+		Submission: make(TokenHistory, 0),
+		Moderation: make(TokenHistory, 0),
+		Content:    NewContentMemoryStore(DefaultContentCache),
+		Members:    NewStageMembers(),
+	}
+}
+
+// StageMembers also keeps the Diffie Hellman keys of Requests to join the
+// stage not yet accepted.
 type StageMembers struct {
 	Readers    map[crypto.Token]crypto.Token
 	Submitors  map[crypto.Token]crypto.Token
 	Moderators map[crypto.Token]crypto.Token
+	Requests   map[crypto.Token]crypto.Token
+}
+
+func NewStageMembers() *StageMembers {
+	return &StageMembers{
+		Readers:    make(map[crypto.Token]crypto.Token),
+		Submitors:  make(map[crypto.Token]crypto.Token),
+		Moderators: make(map[crypto.Token]crypto.Token),
+		Requests:   make(map[crypto.Token]crypto.Token),
+	}
 }
 
 type DateAndSigner interface {
@@ -125,18 +115,42 @@ type DateAndSigner interface {
 // after the second token and so on.
 type TokenHistory []EpochToken
 
-func (t TokenHistory) Append(epoch uint64, token crypto.Token) {
-	for n, epochToken := range t {
-		if epochToken.Epoch < epoch {
-			return epochToken.Token, true
+// Append adds the token valid from epoch on to the history. A token already
+// on the history keeps the earliest epoch it is known to be valid from.
+func (t *TokenHistory) Append(epoch uint64, token crypto.Token) {
+	history := *t
+	for n, epochToken := range history {
+		if epochToken.Token == token {
+			if epochToken.Epoch <= epoch {
+				return
+			}
+			history = append(history[:n], history[n+1:]...)
+			break
 		}
 	}
+	n := 0
+	for n < len(history) && history[n].Epoch > epoch {
+		n++
+	}
+	history = append(history, EpochToken{})
+	copy(history[n+1:], history[n:])
+	history[n] = EpochToken{Epoch: epoch, Token: token}
+	*t = history
+}
 
+// Current returns the most recent token of the history.
+func (t TokenHistory) Current() (crypto.Token, bool) {
+	if len(t) == 0 {
+		return crypto.ZeroToken, false
+	}
+	return t[0].Token, true
 }
 
+// Token returns the token valid at epoch, that is the most recent token valid
+// from epoch or earlier on.
 func (t TokenHistory) Token(epoch uint64) (crypto.Token, bool) {
 	for _, epochToken := range t {
-		if epochToken.Epoch < epoch {
+		if epochToken.Epoch <= epoch {
 			return epochToken.Token, true
 		}
 	}
@@ -148,62 +162,89 @@ type EpochToken struct {
 	Token crypto.Token
 }
 
-type Drama struct {
-	Stages    map[crypto.Token]*Stage
-	ContentIO io.WriteCloser
-	StagesIO  io.WriteCloser
+func putTokenHistory(t TokenHistory, data *[]byte) {
+	util.PutUint16(uint16(len(t)), data)
+	for _, epochToken := range t {
+		util.PutUint64(epochToken.Epoch, data)
+		util.PutToken(epochToken.Token, data)
+	}
 }
 
-func (d Drama) AppendContent(content instructions.Content) {
-
+// parseTokenHistory parses a history put by putTokenHistory. The history is
+// appended entry by entry so that it is sorted whatever the order on data.
+func parseTokenHistory(data []byte, position int) (TokenHistory, int) {
+	var length uint16
+	length, position = util.ParseUint16(data, position)
+	history := make(TokenHistory, 0, length)
+	for n := 0; n < int(length) && position < len(data); n++ {
+		var epoch uint64
+		var token crypto.Token
+		epoch, position = util.ParseUint64(data, position)
+		token, position = util.ParseToken(data, position)
+		history.Append(epoch, token)
+	}
+	return history, position
 }
 
-func (d Drama) IncorporateContent()
+// currentKey returns the private key of the most recent token of the history
+// if it is on the vault.
+func (a *Author) currentKey(history TokenHistory) (crypto.PrivateKey, bool) {
+	token, ok := history.Current()
+	if !ok {
+		return crypto.ZeroPrivateKey, false
+	}
+	return a.Secrets.GetKey(token)
+}
 
-func (a *Author) CreateStage(description string, permissions, flag byte) (*instructions.CreateStage, error) {
+// CreateStage generates the keys of a new stage and returns the signed
+// instruction creating it. Every stage has a submission key, required to
+// publish content, and a moderation key, required to accept members. An
+// ENCRYPTED stage also gets a read key its content is encrypted with.
+func (a *Author) CreateStage(epoch uint64, description string, permissions, flag byte) (*instructions.CreateStage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	owner, err := a.Secrets.NewKey()
 	if err != nil {
 		return nil, err
 	}
-	stage := Stage{
-		Token:       owner.PublicKey(),
-		Flag:        flag,
-		Description: description,
-		Live:        false,
-	}
-	create := instructions.CreateStage{
-		Author:      a.Author,
-		Stage:       owner.PublicKey(),
-		Description: description,
-		Flag:        flag,
-		Attorney:    a.Attorney,
+	submission, err := a.Secrets.NewKey()
+	if err != nil {
+		return nil, err
 	}
-	if (permissions & ENCRYPTED) == 1 {
-		if stage.CipherKey, err = a.Secrets.NewCipherKey(); err != nil {
-			return nil, err
-		}
+	moderation, err := a.Secrets.NewKey()
+	if err != nil {
+		return nil, err
 	}
-	if (permissions & CLOSED) == 1 {
-		if prvKey, err := a.Secrets.NewKey(); err != nil {
-
+	stage := newStage(owner.PublicKey())
+	stage.Flag = flag
+	stage.Permissions = permissions
+	stage.Description = description
+	if permissions&ENCRYPTED != 0 {
+		if _, err := a.newReadKey(stage, epoch); err != nil {
 			return nil, err
-		} else {
-			stage.Submission = prvKey.PublicKey()
-			create.Submission = stage.Submission
 		}
 	}
-	if (permissions & MODERATED) == 1 {
-		if prvKey, err := a.Secrets.NewKey(); err != nil {
-			return nil, err
-		} else {
-			stage.Moderation = prvKey.PublicKey()
-			create.Moderation = stage.Moderation
-		}
+	stage.Submission.Append(epoch, submission.PublicKey())
+	stage.Moderation.Append(epoch, moderation.PublicKey())
+	a.Stages[stage.Token] = stage
+	create := instructions.CreateStage{
+		EpochStamp:  epoch,
+		Author:      a.Author,
+		Stage:       stage.Token,
+		Submission:  submission.PublicKey(),
+		Moderation:  moderation.PublicKey(),
+		Flag:        flag,
+		Description: description,
+		Attorney:    a.Attorney,
 	}
+	create.Sign(a.Signer)
 	return &create, nil
 }
 
+// StageCreated marks the stage as live once its creation is on the chain.
 func (a *Author) StageCreated(create *instructions.CreateStage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	stage, ok := a.Stages[create.Stage]
 	if !ok {
 		return StageNotFoundError
@@ -212,67 +253,218 @@ func (a *Author) StageCreated(create *instructions.CreateStage) error {
 	return nil
 }
 
-func (a *Author) JoinStage(stage crypto.Token, introduction string) (*instructions.JoinStage, crypto.PrivateKey) {
-	dhPrv, dhPub := dh.NewEphemeralKey()
+// JoinStage returns the signed request to join the stage. The ephemeral
+// Diffie-Hellman key the stage keys are to be sealed with is kept on the
+// vault.
+func (a *Author) JoinStage(epoch uint64, stage crypto.Token, introduction string) (*instructions.JoinStage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, dhPub, err := a.Secrets.NewEphemeralKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Secrets.StoreEphemeral(stage, dhPub); err != nil {
+		return nil, err
+	}
 	join := instructions.JoinStage{
+		EpochStamp:   epoch,
 		Author:       a.Author,
 		Stage:        stage,
 		DiffHellKey:  dhPub,
 		Presentation: introduction,
 		Attorney:     a.Attorney,
 	}
-	return &join, dhPrv
+	join.Sign(a.Signer)
+	return &join, nil
 }
 
-func (a *Author) AcceptJoinRequest(request *instructions.JoinStage, permissions byte) (*instructions.AcceptJoinRequest, error) {
+// AcceptJoinRequest returns the signed accept of a request to join a stage
+// moderated by the author. The read key of a private stage is sealed to the
+// requester, as well as the submission key if the stage is not CLOSED or the
+// permissions include PUBLISH, and the moderation key if they include
+// MODERATE. The requester is recorded among the members of the stage.
+func (a *Author) AcceptJoinRequest(epoch uint64, request *instructions.JoinStage, permissions byte) (*instructions.AcceptJoinRequest, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	stage, ok := a.Stages[request.Stage]
 	if !ok {
-		return nil, InsufficientKnowledgeError
+		return nil, StageNotFoundError
 	}
-	moderation, ok := a.Secrets.GetKey(stage.Moderation)
+	moderation, ok := a.currentKey(stage.Moderation)
 	if !ok {
 		return nil, InsufficientKnowledgeError
 	}
 	prv, pub := dh.NewEphemeralKey()
 	accept := instructions.AcceptJoinRequest{
+		EpochStamp:   epoch,
 		Author:       a.Author,
 		Stage:        request.Stage,
 		Member:       request.Author,
 		DiffieHelKey: pub,
+		Attorney:     a.Attorney,
 	}
 	cipher := dh.ConsensusCipher(prv, request.DiffHellKey)
 	if !stage.Public {
-		stageCipherKey, ok := a.Secrets.GetCipher(request.Stage)
+		stageCipherKey, ok := a.currentReadKey(stage)
 		if !ok {
 			return nil, InsufficientKnowledgeError
 		}
 		accept.Read = cipher.Seal(stageCipherKey)
 	}
-	if (stage.Submission != crypto.ZeroToken) && (permissions >= PUBLISH) {
-		subKey, ok := a.Secrets.GetKey(stage.Submission)
+	publish := stage.Permissions&CLOSED == 0 || permissions >= PUBLISH
+	if publish {
+		subKey, ok := a.currentKey(stage.Submission)
 		if !ok {
 			return nil, InsufficientKnowledgeError
 		}
 		accept.Submit = cipher.Seal(subKey[:])
 	}
-	if (stage.Moderation != crypto.ZeroToken) && (permissions >= MODERATE) {
-		modKey, ok := a.Secrets.GetKey(stage.Moderation)
-		if !ok {
-			return nil, InsufficientKnowledgeError
-		}
-		accept.Moderate = cipher.Seal(modKey[:])
+	if permissions >= MODERATE {
+		accept.Moderate = cipher.Seal(moderation[:])
 	}
-	return nil
+	accept.ModerateSign(moderation)
+	accept.Sign(a.Signer)
+	delete(stage.Members.Requests, request.Author)
+	stage.Members.Readers[request.Author] = request.DiffHellKey
+	if publish {
+		stage.Members.Submitors[request.Author] = request.DiffHellKey
+	}
+	if permissions >= MODERATE {
+		stage.Members.Moderators[request.Author] = request.DiffHellKey
+	}
+	return &accept, nil
 }
 
-func (a *Author) IncorporateStage(accept *instructions.AcceptJoinRequest) {
-	cipher := dh.ConsensusCipher()
+// IncorporateStage opens the keys sealed to the author by an accept of its
+// request to join a stage and keeps them on the vault. Keys sealed under the
+// zero nonce of accepts published before crypto.CipherVersion still open.
+func (a *Author) IncorporateStage(accept *instructions.AcceptJoinRequest) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.incorporateStage(accept)
 }
 
-func (a *Author) UpdateStage(description string, flag byte, updatekeys bool) *instructions.UpdateStage {
+func (a *Author) incorporateStage(accept *instructions.AcceptJoinRequest) error {
+	if accept.Member != a.Author {
+		return InvalidAcceptError
+	}
+	ephemeral, ok := a.Secrets.GetEphemeral(accept.Stage)
+	if !ok {
+		return InsufficientKnowledgeError
+	}
+	dhPrv, ok := a.Secrets.GetKey(ephemeral)
+	if !ok {
+		return InsufficientKnowledgeError
+	}
+	cipher := dh.ConsensusCipher(dhPrv, accept.DiffieHelKey)
+	stage, ok := a.Stages[accept.Stage]
+	if !ok {
+		stage = newStage(accept.Stage)
+	}
+	if len(accept.Read) > 0 {
+		key, err := cipher.OpenAny(accept.Read)
+		if err != nil {
+			return InvalidAcceptError
+		}
+		if err := a.storeReadKey(stage, accept.EpochStamp, key); err != nil {
+			return err
+		}
+	}
+	for _, sealed := range []struct {
+		cipher  []byte
+		history *TokenHistory
+	}{{accept.Submit, &stage.Submission}, {accept.Moderate, &stage.Moderation}} {
+		if len(sealed.cipher) == 0 {
+			continue
+		}
+		opened, err := cipher.OpenAny(sealed.cipher)
+		if err != nil || len(opened) != crypto.PrivateKeySize {
+			return InvalidAcceptError
+		}
+		var key crypto.PrivateKey
+		copy(key[:], opened)
+		if err := a.Secrets.Store(key); err != nil {
+			return err
+		}
+		sealed.history.Append(accept.EpochStamp, key.PublicKey())
+	}
+	stage.Live = true
+	a.Stages[accept.Stage] = stage
 	return nil
 }
 
-func (a *Author) Content(contentType string, content []byte, ciphered bool) *instructions.Content {
-	return nil
+// UpdateStage returns the signed update of the description and flag of a
+// stage owned by the author. The submission and moderation keys are kept.
+func (a *Author) UpdateStage(epoch uint64, token crypto.Token, description string, flag byte) (*instructions.UpdateStage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stage, ok := a.Stages[token]
+	if !ok {
+		return nil, StageNotFoundError
+	}
+	owner, ok := a.Secrets.GetKey(token)
+	if !ok {
+		return nil, InsufficientKnowledgeError
+	}
+	update := instructions.UpdateStage{
+		EpochStamp:  epoch,
+		Author:      a.Author,
+		Stage:       token,
+		Flag:        flag,
+		Description: description,
+		Attorney:    a.Attorney,
+	}
+	update.Submission, _ = stage.Submission.Current()
+	update.Moderation, _ = stage.Moderation.Current()
+	update.StageSign(owner)
+	update.Sign(a.Signer)
+	stage.Flag = flag
+	stage.Description = description
+	return &update, nil
+}
+
+// Content returns the signed content published by the author on the stage.
+// Content on a private stage is encrypted with its current read key. Content
+// of an author holding the moderation key of the stage is published as
+// moderated, with the moderation key as moderator, which also signs the
+// content unless the author has an attorney.
+func (a *Author) Content(epoch uint64, token crypto.Token, contentType string, data []byte) (*instructions.Content, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stage, ok := a.Stages[token]
+	if !ok {
+		return nil, StageNotFoundError
+	}
+	submission, ok := a.currentKey(stage.Submission)
+	if !ok {
+		return nil, InsufficientKnowledgeError
+	}
+	content := instructions.Content{
+		EpochStamp:  epoch,
+		Published:   epoch,
+		Author:      a.Author,
+		Stage:       token,
+		ContentType: contentType,
+		Content:     data,
+	}
+	if !stage.Public {
+		key, ok := a.currentReadKey(stage)
+		if !ok {
+			return nil, InsufficientKnowledgeError
+		}
+		content.Content = SealContent(key, data)
+		content.Encrypted = true
+	}
+	content.SubmitSign(submission)
+	moderation, moderated := a.currentKey(stage.Moderation)
+	if moderated {
+		content.Moderator = moderation.PublicKey()
+		content.ModerateSign(moderation)
+	}
+	if moderated && a.Attorney == crypto.ZeroToken {
+		content.Sign(moderation, crypto.ZeroToken)
+	} else {
+		content.Sign(a.Signer, a.Attorney)
+	}
+	return &content, nil
 }
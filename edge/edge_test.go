@@ -0,0 +1,223 @@
+package edge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+// testKDF keeps the key derivation of test vaults cheap.
+var testKDF = KDFParams{N: 1 << 10, R: 8, P: 1}
+
+func newTestAuthor(t *testing.T, name string) *Author {
+	file, err := os.Create(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := CreateSecureVault("password", testKDF, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { vault.Close() })
+	token, key := crypto.RandomAsymetricKey()
+	return NewAuthor(token, key, vault)
+}
+
+// parsed checks that the instruction is signed and parses back.
+func parsed(t *testing.T, instruction instructions.Instruction, signer crypto.PrivateKey) instructions.Instruction {
+	instructions.AppendWalletFee(instruction, signer, 10)
+	parsed := instructions.ParseInstruction(instruction.Serialize())
+	if parsed == nil || parsed.Kind() != instruction.Kind() {
+		t.Fatalf("could not parse instruction of kind %v", instruction.Kind())
+	}
+	return parsed
+}
+
+func TestAuthorStageLifecycle(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	member := newTestAuthor(t, "member")
+
+	create, err := owner.CreateStage(1, "stage", ENCRYPTED|CLOSED, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed(t, create, owner.Signer)
+	if err := owner.StageCreated(create); err != nil || !owner.Stages[create.Stage].Live {
+		t.Fatalf("stage not live: %v", err)
+	}
+
+	join, err := member.JoinStage(2, create.Stage, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := parsed(t, join, member.Signer).(*instructions.JoinStage)
+	accept, err := owner.AcceptJoinRequest(3, request, PUBLISH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := parsed(t, accept, owner.Signer).(*instructions.AcceptJoinRequest)
+	if len(accepted.Moderate) != 0 {
+		t.Error("moderation key sealed without permission")
+	}
+	if _, ok := owner.Stages[create.Stage].Members.Submitors[member.Author]; !ok {
+		t.Error("member not recorded as submitor")
+	}
+
+	if err := member.IncorporateStage(accepted); err != nil {
+		t.Fatalf("could not incorporate accept: %v", err)
+	}
+	stage := member.Stages[create.Stage]
+	if submission, _ := stage.Submission.Current(); submission != create.Submission {
+		t.Error("wrong submission key incorporated")
+	}
+	if _, ok := stage.Moderation.Current(); ok {
+		t.Error("moderation key incorporated without permission")
+	}
+	ownerCipher, _ := owner.currentReadKey(owner.Stages[create.Stage])
+	if memberCipher, ok := member.currentReadKey(stage); !ok || !bytes.Equal(ownerCipher, memberCipher) {
+		t.Error("wrong read key incorporated")
+	}
+	if err := newTestAuthor(t, "other").IncorporateStage(accepted); err != InvalidAcceptError {
+		t.Error("accept incorporated by author it is not addressed to")
+	}
+
+	content, err := member.Content(4, create.Stage, "text", []byte("post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := parsed(t, content, member.Signer).(*instructions.Content)
+	if published.Author != member.Author || published.Moderator != crypto.ZeroToken {
+		t.Error("wrong content author")
+	}
+	moderated, err := owner.Content(4, create.Stage, "text", []byte("moderated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	published = parsed(t, moderated, owner.Signer).(*instructions.Content)
+	if published.Author != owner.Author || published.Moderator != create.Moderation {
+		t.Error("moderated content not published under the moderation key")
+	}
+
+	update, err := owner.UpdateStage(5, create.Stage, "renamed", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := parsed(t, update, owner.Signer).(*instructions.UpdateStage)
+	if updated.Description != "renamed" || updated.Submission != create.Submission || updated.StageSignature != update.StageSignature {
+		t.Error("wrong stage update")
+	}
+	if _, err := member.UpdateStage(5, create.Stage, "hijack", 0); err != InsufficientKnowledgeError {
+		t.Error("stage updated without owner key")
+	}
+}
+
+func TestAuthorEncryptedContent(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	create, err := owner.CreateStage(1, "private", ENCRYPTED, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stage := owner.Stages[create.Stage]
+	before, err := owner.Content(2, create.Stage, "text", []byte("before rotation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !before.Encrypted || bytes.Contains(before.Content, []byte("before")) {
+		t.Fatal("content on private stage not encrypted")
+	}
+	if _, err := owner.newReadKey(stage, 3); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := owner.Content(4, create.Stage, "text", []byte("after rotation"))
+
+	for _, published := range []*instructions.Content{before, after} {
+		content, err := owner.Incorporate(parsed(t, published, owner.Signer))
+		if err != nil {
+			t.Fatalf("could not open content: %v", err)
+		}
+		if string(content.Content) != "before rotation" && string(content.Content) != "after rotation" {
+			t.Errorf("wrong decrypted content: %s", content.Content)
+		}
+	}
+	if recent := stage.Content.Recent(); len(recent) != 2 || !recent[0].Encrypted {
+		t.Error("encrypted content not kept on stage store")
+	}
+
+	outsider := newTestAuthor(t, "outsider")
+	outsider.Stages[create.Stage] = newStage(create.Stage)
+	if _, err := outsider.Incorporate(after); err != ErrCannotDecrypt {
+		t.Error("content opened without read key")
+	}
+}
+
+func TestAuthorRotateStage(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	kept := newTestAuthor(t, "kept")
+	evicted := newTestAuthor(t, "evicted")
+	create, err := owner.CreateStage(1, "private", ENCRYPTED|CLOSED, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []*Author{kept, evicted} {
+		join, _ := member.JoinStage(2, create.Stage, "hello")
+		request := parsed(t, join, member.Signer)
+		owner.Incorporate(request)
+		if _, ok := owner.Stages[create.Stage].Members.Requests[member.Author]; !ok {
+			t.Fatal("join request not recorded")
+		}
+		accept, err := owner.AcceptJoinRequest(3, request.(*instructions.JoinStage), PUBLISH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := member.Incorporate(parsed(t, accept, owner.Signer)); err != nil {
+			t.Fatalf("could not incorporate accept: %v", err)
+		}
+	}
+	old, _ := owner.Content(4, create.Stage, "text", []byte("old"))
+	old = parsed(t, old, owner.Signer).(*instructions.Content)
+
+	rotate, err := owner.RotateStage(5, create.Stage, evicted.Author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := parsed(t, rotate, owner.Signer).(*instructions.UpdateStage)
+	if update.Submission == create.Submission || len(update.ReadMembers) != 1 || len(update.SubMembers) != 1 {
+		t.Fatalf("wrong rotation: %v readers, %v submitors", len(update.ReadMembers), len(update.SubMembers))
+	}
+	for _, member := range []*Author{owner, kept, evicted} {
+		if _, err := member.Incorporate(update); err != nil {
+			t.Fatalf("could not incorporate rotation: %v", err)
+		}
+	}
+	if key, ok := kept.currentKey(kept.Stages[create.Stage].Submission); !ok || key.PublicKey() != update.Submission {
+		t.Error("rotated submission key not incorporated")
+	}
+	if _, ok := evicted.currentKey(evicted.Stages[create.Stage].Submission); ok {
+		t.Error("rotated submission key incorporated by evicted member")
+	}
+	if _, err := evicted.Content(6, create.Stage, "text", []byte("spam")); err != InsufficientKnowledgeError {
+		t.Error("evicted member publishes after rotation")
+	}
+	for _, member := range []*Author{owner, kept} {
+		members := member.Stages[create.Stage].Members
+		if _, ok := members.Readers[kept.Author]; !ok || len(members.Readers) != 1 {
+			t.Errorf("members not rebuilt: %v readers", len(members.Readers))
+		}
+	}
+
+	fresh, _ := kept.Content(6, create.Stage, "text", []byte("fresh"))
+	fresh = parsed(t, fresh, kept.Signer).(*instructions.Content)
+	if content, err := kept.Incorporate(old); err != nil || string(content.Content) != "old" {
+		t.Error("content sealed before rotation does not open")
+	}
+	if content, err := owner.Incorporate(fresh); err != nil || string(content.Content) != "fresh" {
+		t.Error("content sealed after rotation does not open")
+	}
+	if _, err := evicted.Incorporate(fresh); err != ErrCannotDecrypt {
+		t.Error("evicted member opens content sealed after rotation")
+	}
+}
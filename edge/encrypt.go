@@ -0,0 +1,166 @@
+package edge
+
+import (
+	"errors"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+var ErrCannotDecrypt = errors.New("no read key of the stage opens the content")
+
+// CipherKeyID identifies a read key of a stage on the vault and on the read
+// key history of the stage without disclosing the key.
+func CipherKeyID(key []byte) crypto.Token {
+	return crypto.Token(crypto.Hasher(key))
+}
+
+// SealContent encrypts data with the read key of a stage. The random nonce is
+// carried in front of the sealed data.
+func SealContent(key, data []byte) []byte {
+	cipher := crypto.CipherNonceFromKey(key)
+	sealed, nonce := cipher.SealWithNewNonce(data)
+	return append(append(make([]byte, 0, len(nonce)+len(sealed)), nonce...), sealed...)
+}
+
+// OpenContent decrypts data sealed by SealContent.
+func OpenContent(key, data []byte) ([]byte, error) {
+	if len(data) < crypto.NonceSize {
+		return nil, ErrCannotDecrypt
+	}
+	cipher := crypto.CipherNonceFromKey(key)
+	return cipher.OpenNewNonce(data[crypto.NonceSize:], data[:crypto.NonceSize])
+}
+
+// newReadKey generates a read key for the stage valid from epoch on.
+func (a *Author) newReadKey(stage *Stage, epoch uint64) ([]byte, error) {
+	key, err := a.Secrets.NewReadKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.storeReadKey(stage, epoch, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (a *Author) storeReadKey(stage *Stage, epoch uint64, key []byte) error {
+	id := CipherKeyID(key)
+	if err := a.Secrets.StoreCipherKey(id, key); err != nil {
+		return err
+	}
+	stage.Read.Append(epoch, id)
+	stage.Public = false
+	return nil
+}
+
+// currentReadKey returns the most recent read key of the stage.
+func (a *Author) currentReadKey(stage *Stage) ([]byte, bool) {
+	id, ok := stage.Read.Current()
+	if !ok {
+		return nil, false
+	}
+	return a.Secrets.GetCipher(id)
+}
+
+// openContent tries the read key valid at epoch first, then every other read
+// key of the stage, so that content sealed before a rotation, or before the
+// author joined, still opens.
+func (a *Author) openContent(stage *Stage, epoch uint64, data []byte) ([]byte, error) {
+	tried := make(map[crypto.Token]struct{})
+	candidates := make([]crypto.Token, 0, len(stage.Read)+1)
+	if id, ok := stage.Read.Token(epoch); ok {
+		candidates = append(candidates, id)
+	}
+	for _, entry := range stage.Read {
+		candidates = append(candidates, entry.Token)
+	}
+	for _, id := range candidates {
+		if _, ok := tried[id]; ok {
+			continue
+		}
+		tried[id] = struct{}{}
+		key, ok := a.Secrets.GetCipher(id)
+		if !ok {
+			continue
+		}
+		if opened, err := OpenContent(key, data); err == nil {
+			return opened, nil
+		}
+	}
+	return nil, ErrCannotDecrypt
+}
+
+// Incorporate consumes an instruction received from the relay. Instructions
+// addressed to a stage known to the author update the stage, and content is
+// returned decrypted. Accepts of join requests of the author and the keys of
+// a rotation sealed to the author are kept on the vault.
+func (a *Author) Incorporate(instruction instructions.Instruction) (*Content, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	content, _, err := a.incorporate(instruction)
+	return content, err
+}
+
+// incorporate is Incorporate, and also reports if the instruction was kept by
+// its stage, which is the case for content the author cannot decrypt.
+func (a *Author) incorporate(instruction instructions.Instruction) (*Content, bool, error) {
+	if accept, ok := instruction.(*instructions.AcceptJoinRequest); ok && accept.Member == a.Author {
+		err := a.incorporateStage(accept)
+		return nil, err == nil, err
+	}
+	stage, ok := a.Stages[instructionStage(instruction)]
+	if !ok {
+		return nil, false, StageNotFoundError
+	}
+	if err := stage.incorporate(instruction); err != nil {
+		return nil, false, err
+	}
+	switch v := instruction.(type) {
+	case *instructions.Content:
+		content := newContent(v)
+		if v.Encrypted {
+			opened, err := a.openContent(stage, v.EpochStamp, v.Content)
+			if err != nil {
+				return nil, true, err
+			}
+			content.Content = opened
+		}
+		return &content, true, nil
+	case *instructions.UpdateStage:
+		return nil, true, a.openRotation(stage, v)
+	}
+	return nil, true, nil
+}
+
+// instructionStage returns the stage an instruction is addressed to, or the
+// zero token if it is not a stage instruction.
+func instructionStage(instruction instructions.Instruction) crypto.Token {
+	switch v := instruction.(type) {
+	case *instructions.CreateStage:
+		return v.Stage
+	case *instructions.UpdateStage:
+		return v.Stage
+	case *instructions.JoinStage:
+		return v.Stage
+	case *instructions.AcceptJoinRequest:
+		return v.Stage
+	case *instructions.Content:
+		return v.Stage
+	}
+	return crypto.ZeroToken
+}
+
+// Listen incorporates the instructions received from the relay and calls f
+// on every content until the relay is closed.
+func (a *Author) Listen(f func(*Content)) {
+	for {
+		instruction := a.Realay.Receive()
+		if instruction == nil {
+			return
+		}
+		if content, err := a.Incorporate(instruction); err == nil && content != nil {
+			f(content)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package edge
+
+import (
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/crypto/dh"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+// sealToMembers seals the key to the Diffie-Hellman key of every member.
+func sealToMembers(prv crypto.PrivateKey, members map[crypto.Token]crypto.Token, key []byte) crypto.TokenCiphers {
+	sealed := make(crypto.TokenCiphers, 0, len(members))
+	for member, dhKey := range members {
+		if dhKey == crypto.ZeroToken {
+			continue
+		}
+		cipher := dh.ConsensusCipher(prv, dhKey)
+		sealed = append(sealed, crypto.TokenCipher{Token: member, Cipher: cipher.Seal(key)})
+	}
+	return sealed
+}
+
+// RotateStage evicts members from a stage owned by the author and returns the
+// signed update replacing the submission, moderation and read keys. The new
+// keys are sealed to the Diffie-Hellman key every remaining member joined
+// with, according to its permissions, so that evicted members cannot publish
+// nor read content after the update. Content sealed before the rotation still
+// opens with the previous read keys.
+func (a *Author) RotateStage(epoch uint64, token crypto.Token, evicted ...crypto.Token) (*instructions.UpdateStage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stage, ok := a.Stages[token]
+	if !ok {
+		return nil, StageNotFoundError
+	}
+	owner, ok := a.Secrets.GetKey(token)
+	if !ok {
+		return nil, InsufficientKnowledgeError
+	}
+	submission, err := a.Secrets.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	moderation, err := a.Secrets.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range evicted {
+		delete(stage.Members.Readers, member)
+		delete(stage.Members.Submitors, member)
+		delete(stage.Members.Moderators, member)
+	}
+	prv, pub := dh.NewEphemeralKey()
+	update := instructions.UpdateStage{
+		EpochStamp:  epoch,
+		Author:      a.Author,
+		Stage:       token,
+		Submission:  submission.PublicKey(),
+		Moderation:  moderation.PublicKey(),
+		DiffHellKey: pub,
+		Flag:        stage.Flag,
+		Description: stage.Description,
+		Attorney:    a.Attorney,
+	}
+	if !stage.Public {
+		read, err := a.newReadKey(stage, epoch)
+		if err != nil {
+			return nil, err
+		}
+		update.ReadMembers = sealToMembers(prv, stage.Members.Readers, read)
+	}
+	update.SubMembers = sealToMembers(prv, stage.Members.Submitors, submission[:])
+	update.ModMembers = sealToMembers(prv, stage.Members.Moderators, moderation[:])
+	stage.Submission.Append(epoch, submission.PublicKey())
+	stage.Moderation.Append(epoch, moderation.PublicKey())
+	update.StageSign(owner)
+	update.Sign(a.Signer)
+	return &update, nil
+}
+
+// incorporate updates the stage with an instruction addressed to it: its
+// creation and updates, join requests and their accepts, and its content.
+func (s *Stage) incorporate(instruction instructions.Instruction) error {
+	switch v := instruction.(type) {
+	case *instructions.CreateStage:
+		s.Flag = v.Flag
+		s.Description = v.Description
+		s.Submission.Append(v.EpochStamp, v.Submission)
+		s.Moderation.Append(v.EpochStamp, v.Moderation)
+		s.Live = true
+	case *instructions.UpdateStage:
+		s.Flag = v.Flag
+		s.Description = v.Description
+		s.Submission.Append(v.EpochStamp, v.Submission)
+		s.Moderation.Append(v.EpochStamp, v.Moderation)
+		if v.DiffHellKey != crypto.ZeroToken {
+			s.Members.rebuild(v)
+		}
+	case *instructions.JoinStage:
+		s.Members.Requests[v.Author] = v.DiffHellKey
+	case *instructions.AcceptJoinRequest:
+		s.Members.accept(v)
+	case *instructions.Content:
+		return s.Content.AppendContent(v)
+	}
+	return nil
+}
+
+// openRotation opens the keys of a rotation sealed to the author and keeps
+// them on the vault.
+func (a *Author) openRotation(stage *Stage, update *instructions.UpdateStage) error {
+	if update.DiffHellKey == crypto.ZeroToken {
+		return nil
+	}
+	ephemeral, ok := a.Secrets.GetEphemeral(update.Stage)
+	if !ok {
+		return nil
+	}
+	dhPrv, ok := a.Secrets.GetKey(ephemeral)
+	if !ok {
+		return nil
+	}
+	cipher := dh.ConsensusCipher(dhPrv, update.DiffHellKey)
+	if sealed, ok := sealedTo(update.ReadMembers, a.Author); ok {
+		key, err := cipher.OpenAny(sealed)
+		if err != nil {
+			return InvalidAcceptError
+		}
+		if err := a.storeReadKey(stage, update.EpochStamp, key); err != nil {
+			return err
+		}
+	}
+	for _, rotated := range []struct {
+		members crypto.TokenCiphers
+		token   crypto.Token
+	}{{update.SubMembers, update.Submission}, {update.ModMembers, update.Moderation}} {
+		sealed, ok := sealedTo(rotated.members, a.Author)
+		if !ok {
+			continue
+		}
+		opened, err := cipher.OpenAny(sealed)
+		if err != nil || len(opened) != crypto.PrivateKeySize {
+			return InvalidAcceptError
+		}
+		var key crypto.PrivateKey
+		copy(key[:], opened)
+		if key.PublicKey() != rotated.token {
+			return InvalidAcceptError
+		}
+		if err := a.Secrets.Store(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sealedTo(members crypto.TokenCiphers, token crypto.Token) ([]byte, bool) {
+	for _, member := range members {
+		if member.Token == token {
+			return member.Cipher, true
+		}
+	}
+	return nil, false
+}
+
+// dhKey returns the Diffie-Hellman key the member joined the stage with.
+func (s *StageMembers) dhKey(member crypto.Token) (crypto.Token, bool) {
+	for _, members := range []map[crypto.Token]crypto.Token{s.Requests, s.Readers, s.Submitors, s.Moderators} {
+		if dhKey, ok := members[member]; ok {
+			return dhKey, true
+		}
+	}
+	return crypto.ZeroToken, false
+}
+
+// accept records the member accepted by an accept of its join request, with
+// the permissions sealed to it.
+func (s *StageMembers) accept(accept *instructions.AcceptJoinRequest) {
+	dhKey, ok := s.dhKey(accept.Member)
+	if !ok {
+		return
+	}
+	delete(s.Requests, accept.Member)
+	s.Readers[accept.Member] = dhKey
+	if len(accept.Submit) > 0 {
+		s.Submitors[accept.Member] = dhKey
+	}
+	if len(accept.Moderate) > 0 {
+		s.Moderators[accept.Member] = dhKey
+	}
+}
+
+// rebuild replaces the members by the members the keys of a rotation are
+// sealed to. The read key of a public stage is not sealed, so its readers are
+// the members receiving any of the other keys.
+func (s *StageMembers) rebuild(update *instructions.UpdateStage) {
+	rebuilt := NewStageMembers()
+	rebuilt.Requests = s.Requests
+	add := func(members map[crypto.Token]crypto.Token, sealed crypto.TokenCiphers) {
+		for _, member := range sealed {
+			dhKey, _ := s.dhKey(member.Token)
+			members[member.Token] = dhKey
+			if len(update.ReadMembers) == 0 {
+				rebuilt.Readers[member.Token] = dhKey
+			}
+		}
+	}
+	add(rebuilt.Readers, update.ReadMembers)
+	add(rebuilt.Submitors, update.SubMembers)
+	add(rebuilt.Moderators, update.ModMembers)
+	*s = *rebuilt
+}
@@ -1,61 +1,101 @@
 package edge
 
 import (
+	"bytes"
+	"crypto/rand"
 	"errors"
-	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 
 	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/crypto/hd"
 	"github.com/lienkolabs/aereum/core/crypto/scrypt"
+	"github.com/lienkolabs/aereum/core/util"
 )
 
 const (
 	privateKey   = 0
 	ephemeralKey = 1
 	cipherKey    = 2
+	seedKey      = 3 // master seed of a vault recovered from a mnemonic phrase
+	indexKey     = 4 // next index derived for a purpose
 )
 
+// MaxCipherKeySize is the maximum length of a cipher key kept on the vault.
+const MaxCipherKeySize = 254
+
+var (
+	ErrCorruptedVault = errors.New("secure vault is corrupted or password is wrong")
+	ErrLegacyVault    = errors.New("secure vault has no header or is sealed under zero nonces and must be migrated")
+	ErrWrongPassword  = errors.New("wrong secure vault password")
+	ErrNotFileVault   = errors.New("secure vault is not kept on a file")
+	ErrInvalidKDF     = errors.New("invalid secure vault KDF parameters")
+	ErrWeakKDF        = errors.New("secure vault KDF parameters cannot be lowered")
+)
+
+// SecureVault keeps the secrets of a user: private keys by their public
+// token, cipher keys by an identifier, and the token of the ephemeral key a
+// user joined a stage with by the stage token. Every secret is kept on
+// storage as a record framed by util.WriteFrame, consisting of the record
+// kind followed by the sealed kind and secret. The kind is sealed as well so
+// that records of the same size cannot be passed for one another. Records
+// follow a header with the salt and KDF parameters of the vault key.
 type SecureVault struct {
 	storage   io.WriteCloser
+	header    vaultHeader
 	cipher    crypto.Cipher
 	keys      map[crypto.Token]crypto.PrivateKey
 	ciphers   map[crypto.Token][]byte
 	ephemeral map[crypto.Token]crypto.Token
+	seed      []byte
+	next      map[uint32]uint32
+}
+
+func (s *SecureVault) write(kind byte, secret []byte) error {
+	sealed := s.cipher.Seal(append([]byte{kind}, secret...))
+	return util.WriteFrame(s.storage, append([]byte{kind}, sealed...))
 }
 
+// Store keeps the key on the vault. A key already kept is not written again,
+// and neither are cipher keys and ephemeral tokens already kept, so that
+// instructions incorporated again do not grow the vault.
 func (s *SecureVault) Store(key crypto.PrivateKey) error {
-	encrypted := s.cipher.Seal(key[:])
-	bytes := append([]byte{byte(len(encrypted)), privateKey}, encrypted...)
-	_, err := s.storage.Write(bytes)
-	if err != nil {
-		s.keys[key.PublicKey()] = key
+	if _, ok := s.keys[key.PublicKey()]; ok {
+		return nil
 	}
-	return err
+	if err := s.write(privateKey, key[:]); err != nil {
+		return err
+	}
+	s.keys[key.PublicKey()] = key
+	return nil
 }
 
 func (s *SecureVault) StoreCipherKey(token crypto.Token, key []byte) error {
-	if len(key) > 254 {
+	if len(key) > MaxCipherKeySize {
 		return errors.New("key length cannot exceed 254 bytes")
 	}
-	joint := append(token[:], key...)
-	encrypted := s.cipher.Seal(joint[:])
-	bytes := append([]byte{byte(len(encrypted)), cipherKey}, joint...)
-	_, err := s.storage.Write(bytes)
-	if err != nil {
-		s.ciphers[token] = key
+	if existing, ok := s.ciphers[token]; ok && bytes.Equal(existing, key) {
+		return nil
 	}
-	return err
+	joint := append(append(make([]byte, 0, crypto.TokenSize+len(key)), token[:]...), key...)
+	if err := s.write(cipherKey, joint); err != nil {
+		return err
+	}
+	s.ciphers[token] = append([]byte{}, key...)
+	return nil
 }
 
 func (s *SecureVault) StoreEphemeral(token, ephemeral crypto.Token) error {
-	joint := append(token[:], ephemeral[:]...)
-	encrypted := s.cipher.Seal(joint[:])
-	bytes := append([]byte{byte(len(encrypted)), ephemeralKey}, joint...)
-	_, err := s.storage.Write(bytes)
-	if err != nil {
-		s.ephemeral[token] = ephemeral
+	if existing, ok := s.ephemeral[token]; ok && existing == ephemeral {
+		return nil
 	}
-	return err
+	joint := append(append(make([]byte, 0, 2*crypto.TokenSize), token[:]...), ephemeral[:]...)
+	if err := s.write(ephemeralKey, joint); err != nil {
+		return err
+	}
+	s.ephemeral[token] = ephemeral
+	return nil
 }
 
 func (s *SecureVault) NewCipherKey(token crypto.Token) ([]byte, error) {
@@ -67,7 +107,13 @@ func (s *SecureVault) NewCipherKey(token crypto.Token) ([]byte, error) {
 	return key, nil
 }
 
+// NewKey stores and returns a new key for a stage: its owner, submission or
+// moderation key. Keys of a vault with a master seed are derived on
+// hd.PurposeStage; keys of other purposes are returned by NewPurposeKey.
 func (s *SecureVault) NewKey() (crypto.PrivateKey, error) {
+	if s.seed != nil {
+		return s.NewPurposeKey(hd.PurposeStage)
+	}
 	_, key := crypto.RandomAsymetricKey()
 	err := s.Store(key)
 	if err != nil {
@@ -95,41 +141,396 @@ func (s *SecureVault) Close() error {
 	return s.storage.Close()
 }
 
-func OpenSecureVault(password string, salt []byte, storage io.ReadWriteCloser) (*SecureVault, error) {
-	key, err := scrypt.Key([]byte(password), salt, 1<<15, 8, 1, 32)
+// KDFParams are the scrypt parameters the key of a vault is derived from its
+// password with. The cost of a vault can be raised over time by changing its
+// password, to the same password if need be, with higher parameters.
+type KDFParams struct {
+	N int
+	R int
+	P int
+}
+
+// DefaultKDFParams are the parameters of new vaults.
+var DefaultKDFParams = KDFParams{N: 1 << 17, R: 8, P: 1}
+
+// LegacyKDFParams are the parameters of vaults without header.
+var LegacyKDFParams = KDFParams{N: 1 << 15, R: 8, P: 1}
+
+// Less tells if the parameters are cheaper than other on any account.
+func (k KDFParams) Less(other KDFParams) bool {
+	return k.N < other.N || k.R < other.R || k.P < other.P
+}
+
+// Valid checks that N is a power of two greater than one and that R and P
+// are positive and within the bounds of scrypt.
+func (k KDFParams) Valid() bool {
+	return k.N > 1 && k.N&(k.N-1) == 0 && k.R > 0 && k.P > 0 && uint64(k.R)*uint64(k.P) < 1<<30
+}
+
+// vaultHeader is the first record of a vault, holding the salt and the KDF
+// parameters its key is derived with. The header is followed by the header
+// fields sealed with the key, so that the header is authenticated and a wrong
+// password is detected before any record is read.
+type vaultHeader struct {
+	params KDFParams
+	salt   []byte
+	check  []byte // header fields sealed with the key
+}
+
+const (
+	headerKind   = 0xff
+	vaultVersion = 1
+	saltSize     = 32
+)
+
+func (h vaultHeader) fields() []byte {
+	data := []byte{headerKind, vaultVersion}
+	util.PutUint64(uint64(h.params.N), &data)
+	util.PutUint64(uint64(h.params.R), &data)
+	util.PutUint64(uint64(h.params.P), &data)
+	util.PutByteArray(h.salt, &data)
+	return data
+}
+
+func parseVaultHeader(data []byte) (vaultHeader, bool) {
+	var header vaultHeader
+	if len(data) < 2 || data[0] != headerKind || data[1] != vaultVersion {
+		return header, false
+	}
+	var n, r, p uint64
+	position := 2
+	n, position = util.ParseUint64(data, position)
+	r, position = util.ParseUint64(data, position)
+	p, position = util.ParseUint64(data, position)
+	header.salt, position = util.ParseByteArray(data, position)
+	if position > len(data) || n > 1<<40 || r > 1<<30 || p > 1<<30 {
+		return header, false
+	}
+	header.params = KDFParams{N: int(n), R: int(r), P: int(p)}
+	header.check = data[position:]
+	return header, true
+}
+
+func newSecureVault(password string, header vaultHeader, storage io.WriteCloser) (*SecureVault, error) {
+	key, err := scrypt.Key([]byte(password), header.salt, header.params.N, header.params.R, header.params.P, 32)
 	if err != nil {
 		return nil, err
 	}
-	secure := SecureVault{
-		storage: storage,
-		cipher:  crypto.CipherFromKey(key),
-		keys:    make(map[crypto.Token]crypto.PrivateKey),
+	return &SecureVault{
+		storage:   storage,
+		header:    header,
+		cipher:    crypto.CipherFromKey(key),
+		keys:      make(map[crypto.Token]crypto.PrivateKey),
+		ciphers:   make(map[crypto.Token][]byte),
+		ephemeral: make(map[crypto.Token]crypto.Token),
+		next:      make(map[uint32]uint32),
+	}, nil
+}
+
+func newVaultHeader(params KDFParams) vaultHeader {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
 	}
-	for {
-		encrypted := readSlice(storage)
-		if encrypted == nil {
-			break
+	return vaultHeader{params: params, salt: salt}
+}
+
+// writeHeader writes the header of the vault on its storage.
+func (s *SecureVault) writeHeader() error {
+	fields := s.header.fields()
+	s.header.check = s.cipher.Seal(fields)
+	return util.WriteFrame(s.storage, append(fields, s.header.check...))
+}
+
+// CreateSecureVault starts an empty vault on storage, with a random salt and
+// the KDF parameters.
+func CreateSecureVault(password string, params KDFParams, storage io.WriteCloser) (*SecureVault, error) {
+	if !params.Valid() {
+		return nil, ErrInvalidKDF
+	}
+	secure, err := newSecureVault(password, newVaultHeader(params), storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := secure.writeHeader(); err != nil {
+		return nil, err
+	}
+	return secure, nil
+}
+
+// OpenSecureVault reads every record on storage and keeps appending new
+// records to it. A partial last record, left by an interrupted write, is
+// truncated from storage if it is a file. It returns ErrCorruptedVault if a record cannot be opened
+// with the password, and ErrLegacyVault if the vault has no header or records
+// were sealed under the zero nonce of earlier versions, in which case the
+// vault must be migrated by MigrateSecureVault.
+func OpenSecureVault(password string, storage io.ReadWriteCloser) (*SecureVault, error) {
+	data, err := util.ReadFrame(storage)
+	if err != nil {
+		return nil, ErrCorruptedVault
+	}
+	header, ok := parseVaultHeader(data)
+	if !ok {
+		if len(data) > 0 && data[0] != headerKind {
+			return nil, ErrLegacyVault
 		}
-		if opened, err := secure.cipher.Open(encrypted); err == nil || len(opened) != 64 {
-			return nil, fmt.Errorf("secure vault is corrupted")
-		} else {
-			var pk crypto.PrivateKey
-			copy(pk[:], opened)
-			secure.keys[pk.PublicKey()] = pk
+		return nil, ErrCorruptedVault
+	}
+	secure, err := newSecureVault(password, header, storage)
+	if err != nil {
+		return nil, err
+	}
+	if fields, err := secure.cipher.Open(header.check); err != nil || !bytes.Equal(fields, header.fields()) {
+		return nil, ErrCorruptedVault
+	}
+	size, err := secure.read(storage, func(record []byte) ([]byte, error) {
+		opened, err := secure.cipher.Open(record)
+		if err != nil {
+			if _, legacyErr := secure.cipher.OpenZeroNonce(record); legacyErr == nil {
+				return nil, ErrLegacyVault
+			}
+			return nil, ErrCorruptedVault
 		}
+		return opened, nil
+	})
+	if err == io.ErrUnexpectedEOF {
+		file, ok := storage.(truncatable)
+		if !ok {
+			return nil, ErrCorruptedVault
+		}
+		size += int64(4 + len(data))
+		if err := file.Truncate(size); err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(size, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if err != io.EOF {
+		return nil, err
 	}
-	return &secure, nil
+	return secure, nil
+}
 
+// MigrateSecureVault reads the records of a vault without header, sealed
+// under the salt and LegacyKDFParams, and writes them on storage, which should
+// be empty, as a vault with a fresh salt and the KDF parameters. Records sealed
+// under the zero nonce of earlier versions are sealed again under random
+// nonces, and a partial last record is dropped. The migrated vault keeps appending new records to storage.
+func MigrateSecureVault(password string, salt []byte, legacy io.Reader, params KDFParams, storage io.WriteCloser) (*SecureVault, error) {
+	if !params.Valid() {
+		return nil, ErrInvalidKDF
+	}
+	old, err := newSecureVault(password, vaultHeader{params: LegacyKDFParams, salt: salt}, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = old.read(legacy, func(record []byte) ([]byte, error) {
+		opened, err := old.cipher.OpenAny(record)
+		if err != nil {
+			return nil, ErrCorruptedVault
+		}
+		return opened, nil
+	})
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	secure, err := newSecureVault(password, newVaultHeader(params), storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := secure.writeAll(old); err != nil {
+		return nil, err
+	}
+	return secure, nil
 }
 
-func readSlice(storage io.Reader) []byte {
-	size := make([]byte, 1)
-	if n, _ := storage.Read(size); n != 1 {
-		return nil
+// writeAll writes the header of the vault followed by every secret of source
+// on the storage of the vault.
+func (s *SecureVault) writeAll(source *SecureVault) error {
+	if err := s.writeHeader(); err != nil {
+		return err
 	}
-	slice := make([]byte, size[0])
-	if n, _ := storage.Read(slice); n != int(size[0]) {
-		return nil
+	for _, key := range source.keys {
+		if err := s.Store(key); err != nil {
+			return err
+		}
+	}
+	for token, key := range source.ciphers {
+		if err := s.StoreCipherKey(token, key); err != nil {
+			return err
+		}
+	}
+	for token, ephemeral := range source.ephemeral {
+		if err := s.StoreEphemeral(token, ephemeral); err != nil {
+			return err
+		}
+	}
+	if source.seed != nil {
+		if err := s.storeSeed(source.seed); err != nil {
+			return err
+		}
+	}
+	for purpose, next := range source.next {
+		if err := s.storeNext(purpose, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KDF returns the parameters the key of the vault is derived with.
+func (s *SecureVault) KDF() KDFParams {
+	return s.header.params
+}
+
+// ChangePassword seals every secret of a vault kept on a file again under a
+// key derived from password, with a fresh salt and the KDF parameters. The
+// records are written to a temporary file on the same directory that replaces
+// the vault file only once complete, so that the vault is either entirely
+// under the current password or entirely under the new one. The KDF
+// parameters cannot be cheaper than the ones of the vault on any account.
+func (s *SecureVault) ChangePassword(current, password string, params KDFParams) error {
+	file, ok := s.storage.(*os.File)
+	if !ok {
+		return ErrNotFileVault
+	}
+	if !params.Valid() {
+		return ErrInvalidKDF
+	}
+	if params.Less(s.header.params) {
+		return ErrWeakKDF
+	}
+	key, err := scrypt.Key([]byte(current), s.header.salt, s.header.params.N, s.header.params.R, s.header.params.P, 32)
+	if err != nil {
+		return err
+	}
+	if _, err := crypto.CipherFromKey(key).Open(s.header.check); err != nil {
+		return ErrWrongPassword
+	}
+	path := file.Name()
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	changed, err := newSecureVault(password, newVaultHeader(params), temp)
+	if err == nil {
+		err = changed.writeAll(s)
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// the new records are opened for appending before they replace the vault
+	// file, so that the vault never keeps writing to the unlinked file.
+	storage, err := os.OpenFile(temp.Name(), os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		storage.Close()
+		return err
+	}
+	file.Close()
+	s.storage = storage
+	s.header = changed.header
+	s.cipher = changed.cipher
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes the entries of the directory, so that a rename on it is
+// durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// read incorporates every record on r opened by open, and returns the size of
+// the records read. A partial record at the end of r, left by a write that was
+// interrupted, is not incorporated and read returns io.ErrUnexpectedEOF.
+func (s *SecureVault) read(r io.Reader, open func([]byte) ([]byte, error)) (int64, error) {
+	var size int64
+	for {
+		record, err := util.ReadFrame(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, err
+		}
+		if err != nil || len(record) == 0 {
+			return size, ErrCorruptedVault
+		}
+		opened, err := open(record[1:])
+		if err != nil {
+			return size, err
+		}
+		if len(opened) == 0 || opened[0] != record[0] {
+			return size, ErrCorruptedVault
+		}
+		if err := s.incorporate(opened[0], opened[1:]); err != nil {
+			return size, err
+		}
+		size += int64(4 + len(record))
+	}
+}
+
+// truncatable is a storage whose partial last record can be dropped.
+type truncatable interface {
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// incorporate keeps an opened secret of the kind on the maps of the vault.
+func (s *SecureVault) incorporate(kind byte, secret []byte) error {
+	switch kind {
+	case privateKey:
+		if len(secret) != crypto.PrivateKeySize {
+			return ErrCorruptedVault
+		}
+		var key crypto.PrivateKey
+		copy(key[:], secret)
+		s.keys[key.PublicKey()] = key
+	case cipherKey:
+		if len(secret) < crypto.TokenSize || len(secret) > crypto.TokenSize+MaxCipherKeySize {
+			return ErrCorruptedVault
+		}
+		var token crypto.Token
+		copy(token[:], secret)
+		s.ciphers[token] = secret[crypto.TokenSize:]
+	case ephemeralKey:
+		if len(secret) != 2*crypto.TokenSize {
+			return ErrCorruptedVault
+		}
+		var token, ephemeral crypto.Token
+		copy(token[:], secret)
+		copy(ephemeral[:], secret[crypto.TokenSize:])
+		s.ephemeral[token] = ephemeral
+	case seedKey:
+		if len(secret) != hd.SeedSize {
+			return ErrCorruptedVault
+		}
+		s.seed = append([]byte{}, secret...)
+	case indexKey:
+		if len(secret) != 16 {
+			return ErrCorruptedVault
+		}
+		purpose, _ := util.ParseUint64(secret, 0)
+		next, _ := util.ParseUint64(secret, 8)
+		if uint32(next) > s.next[uint32(purpose)] {
+			s.next[uint32(purpose)] = uint32(next)
+		}
+	default:
+		return ErrCorruptedVault
 	}
-	return slice
+	return nil
 }
@@ -0,0 +1,224 @@
+package edge
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/crypto/scrypt"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+func TestSecureVaultReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	open := func(password string) (*SecureVault, error) {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vault, err := OpenSecureVault(password, file)
+		if err != nil {
+			file.Close()
+		}
+		return vault, err
+	}
+	file, _ := os.Create(path)
+	vault, err := CreateSecureVault("password", testKDF, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := vault.NewKey()
+	stage, _ := crypto.RandomAsymetricKey()
+	ephemeral, _ := crypto.RandomAsymetricKey()
+	read, _ := vault.NewCipherKey(stage)
+	if err := vault.StoreEphemeral(stage, ephemeral); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, read) || bytes.Contains(data, ephemeral[:]) || bytes.Contains(data, key[:32]) {
+		t.Fatal("secret kept on storage in plain text")
+	}
+	if _, err := open("wrong"); err != ErrCorruptedVault {
+		t.Error("vault opened with wrong password")
+	}
+	vault, err = open("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := vault.GetKey(key.PublicKey()); !ok || got != key {
+		t.Error("private key not reloaded")
+	}
+	if got, ok := vault.GetCipher(stage); !ok || !bytes.Equal(got, read) {
+		t.Error("cipher key not reloaded")
+	}
+	if got, ok := vault.GetEphemeral(stage); !ok || got != ephemeral {
+		t.Error("ephemeral key not reloaded")
+	}
+	vault.Close()
+
+	// a record passed for another kind does not open
+	header := 4 + int(binary.LittleEndian.Uint32(data))
+	data[header+4] = cipherKey
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open("password"); err != ErrCorruptedVault {
+		t.Error("record with tampered kind opened")
+	}
+}
+
+func TestSecureVaultPartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	open := func() *SecureVault {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vault, err := OpenSecureVault("password", file)
+		if err != nil {
+			t.Fatalf("could not open vault: %v", err)
+		}
+		return vault
+	}
+	file, _ := os.Create(path)
+	vault, err := CreateSecureVault("password", testKDF, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := vault.NewKey()
+	vault.Close()
+	complete, _ := os.ReadFile(path)
+
+	vault = open()
+	lost, _ := vault.NewKey()
+	vault.Close()
+	data, _ := os.ReadFile(path)
+	half := len(complete) + (len(data)-len(complete))/2
+	if err := os.WriteFile(path, data[:half], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault = open()
+	if _, ok := vault.GetKey(kept.PublicKey()); !ok {
+		t.Error("key before partial record not reloaded")
+	}
+	if _, ok := vault.GetKey(lost.PublicKey()); ok {
+		t.Error("key of partial record reloaded")
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, complete) {
+		t.Fatal("partial record not truncated")
+	}
+	key, _ := vault.NewKey()
+	vault.Close()
+	vault = open()
+	defer vault.Close()
+	if _, ok := vault.GetKey(key.PublicKey()); !ok {
+		t.Error("key stored after truncation not reloaded")
+	}
+}
+
+func TestSecureVaultMigrate(t *testing.T) {
+	key, err := scrypt.Key([]byte("password"), []byte("salt"), 1<<15, 8, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	_, prv := crypto.RandomAsymetricKey()
+	var legacy bytes.Buffer
+	record := append([]byte{privateKey}, prv[:]...)
+	util.WriteFrame(&legacy, append([]byte{privateKey}, gcm.Seal(nil, make([]byte, crypto.NonceSize), record, nil)...))
+
+	path := filepath.Join(t.TempDir(), "vault")
+	file, _ := os.Create(path)
+	if _, err := OpenSecureVault("password", &bufferCloser{Buffer: legacy}); err != ErrLegacyVault {
+		t.Errorf("legacy vault opened: %v", err)
+	}
+	vault, err := MigrateSecureVault("password", []byte("salt"), bytes.NewReader(legacy.Bytes()), testKDF, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	file, _ = os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+	vault, err = OpenSecureVault("password", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	if got, ok := vault.GetKey(prv.PublicKey()); !ok || got != prv {
+		t.Error("legacy key not migrated")
+	}
+}
+
+func TestSecureVaultChangePassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault")
+	file, _ := os.Create(path)
+	vault, err := CreateSecureVault("password", testKDF, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := vault.NewKey()
+	raised := KDFParams{N: 2 * testKDF.N, R: testKDF.R, P: testKDF.P}
+	for _, params := range []KDFParams{{N: 0, R: 8, P: 1}, {N: 3 * testKDF.N, R: 8, P: 1}, {N: testKDF.N, R: 0, P: 1}} {
+		if err := vault.ChangePassword("password", "changed", params); err != ErrInvalidKDF {
+			t.Errorf("password changed with invalid KDF %+v: %v", params, err)
+		}
+	}
+	if err := vault.ChangePassword("password", "changed", KDFParams{N: 4 * testKDF.N, R: 1, P: 1}); err != ErrWeakKDF {
+		t.Errorf("password changed with cheaper KDF: %v", err)
+	}
+	if err := vault.ChangePassword("wrong", "changed", raised); err != ErrWrongPassword {
+		t.Errorf("password changed without current password: %v", err)
+	}
+	if err := vault.ChangePassword("password", "changed", raised); err != nil {
+		t.Fatal(err)
+	}
+	if !testKDF.Less(vault.KDF()) || vault.KDF().Less(raised) {
+		t.Error("KDF cost not raised")
+	}
+	info, _ := os.Stat(path)
+	if storage, _ := vault.storage.(*os.File).Stat(); !os.SameFile(info, storage) {
+		t.Error("vault does not write to the vault file")
+	}
+	other, _ := vault.NewKey()
+	vault.Close()
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+
+	for _, password := range []string{"password", "changed"} {
+		file, _ := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+		vault, err := OpenSecureVault(password, file)
+		if password == "password" {
+			if err != ErrCorruptedVault {
+				t.Error("vault opened with previous password")
+			}
+			file.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []crypto.PrivateKey{key, other} {
+			if got, ok := vault.GetKey(want.PublicKey()); !ok || got != want {
+				t.Error("key lost on password change")
+			}
+		}
+		if vault.KDF() != raised {
+			t.Error("KDF parameters not kept on header")
+		}
+		vault.Close()
+	}
+
+	memory, _ := CreateSecureVault("password", testKDF, &bufferCloser{})
+	if err := memory.ChangePassword("password", "changed", testKDF); err != ErrNotFileVault {
+		t.Error("password changed on vault not kept on file")
+	}
+}
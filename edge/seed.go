@@ -0,0 +1,142 @@
+package edge
+
+import (
+	"errors"
+	"io"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/crypto/dh"
+	"github.com/lienkolabs/aereum/core/crypto/hd"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+var ErrNoSeed = errors.New("secure vault has no master seed")
+
+// RecoverSecureVault starts a vault on storage whose keys are derived from the
+// master seed of a mnemonic phrase, see hd.NewMnemonic. A vault recovered
+// from the phrase of a lost vault derives the same keys in the same order;
+// Regenerate stores the keys the lost vault had already derived.
+func RecoverSecureVault(password string, params KDFParams, phrase, passphrase string, storage io.WriteCloser) (*SecureVault, error) {
+	seed, err := hd.MnemonicSeed(phrase, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	secure, err := CreateSecureVault(password, params, storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := secure.storeSeed(seed); err != nil {
+		return nil, err
+	}
+	return secure, nil
+}
+
+func (s *SecureVault) storeSeed(seed []byte) error {
+	if err := s.write(seedKey, seed); err != nil {
+		return err
+	}
+	s.seed = append([]byte{}, seed...)
+	return nil
+}
+
+func (s *SecureVault) storeNext(purpose, next uint32) error {
+	data := make([]byte, 0, 16)
+	util.PutUint64(uint64(purpose), &data)
+	util.PutUint64(uint64(next), &data)
+	if err := s.write(indexKey, data); err != nil {
+		return err
+	}
+	s.next[purpose] = next
+	return nil
+}
+
+// derive returns the node of the next index of the purpose. The index is
+// persisted before the node is returned, so that no index is derived twice.
+func (s *SecureVault) derive(purpose uint32) (hd.ExtendedKey, error) {
+	index := s.next[purpose]
+	if err := s.storeNext(purpose, index+1); err != nil {
+		return hd.ExtendedKey{}, err
+	}
+	return hd.Derive(s.seed, hd.Path(purpose, index)...), nil
+}
+
+// NewPurposeKey stores and returns the next ed25519 key of the purpose, one of
+// hd.PurposeAuthor, hd.PurposeAttorney, hd.PurposeStage or hd.PurposeWallet.
+func (s *SecureVault) NewPurposeKey(purpose uint32) (crypto.PrivateKey, error) {
+	if s.seed == nil {
+		return crypto.ZeroPrivateKey, ErrNoSeed
+	}
+	node, err := s.derive(purpose)
+	if err != nil {
+		return crypto.ZeroPrivateKey, err
+	}
+	key := node.PrivateKey()
+	if err := s.Store(key); err != nil {
+		return crypto.ZeroPrivateKey, err
+	}
+	return key, nil
+}
+
+// NewEphemeralKey stores and returns a new Diffie-Hellman key, derived on
+// hd.PurposeEphemeral if the vault has a master seed.
+func (s *SecureVault) NewEphemeralKey() (crypto.PrivateKey, crypto.Token, error) {
+	var prv crypto.PrivateKey
+	var pub crypto.Token
+	if s.seed != nil {
+		node, err := s.derive(hd.PurposeEphemeral)
+		if err != nil {
+			return crypto.ZeroPrivateKey, crypto.ZeroToken, err
+		}
+		prv, pub = dh.KeyFromSeed(node.Key)
+	} else {
+		prv, pub = dh.NewEphemeralKey()
+	}
+	if err := s.Store(prv); err != nil {
+		return crypto.ZeroPrivateKey, crypto.ZeroToken, err
+	}
+	return prv, pub, nil
+}
+
+// NewReadKey returns a new read key for a private stage, derived on
+// hd.PurposeRead if the vault has a master seed. The key is not stored, see
+// StoreCipherKey.
+func (s *SecureVault) NewReadKey() ([]byte, error) {
+	if s.seed == nil {
+		return crypto.NewCipherKey(), nil
+	}
+	node, err := s.derive(hd.PurposeRead)
+	if err != nil {
+		return nil, err
+	}
+	return node.Key[:], nil
+}
+
+// Regenerate stores the first count keys of the purpose derived from the
+// master seed. Read keys are stored by their CipherKeyID. The stages
+// ephemeral keys were used to join are not known to the seed and must be
+// restored with StoreEphemeral from the join requests on chain.
+func (s *SecureVault) Regenerate(purpose, count uint32) error {
+	if s.seed == nil {
+		return ErrNoSeed
+	}
+	for index := uint32(0); index < count; index++ {
+		node := hd.Derive(s.seed, hd.Path(purpose, index)...)
+		var err error
+		switch purpose {
+		case hd.PurposeEphemeral:
+			prv, _ := dh.KeyFromSeed(node.Key)
+			err = s.Store(prv)
+		case hd.PurposeRead:
+			err = s.StoreCipherKey(CipherKeyID(node.Key[:]), node.Key[:])
+		default:
+			err = s.Store(node.PrivateKey())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if count > s.next[purpose] {
+		return s.storeNext(purpose, count)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package edge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/crypto/dh"
+	"github.com/lienkolabs/aereum/core/crypto/hd"
+)
+
+func TestSecureVaultRecover(t *testing.T) {
+	entropy, _ := hd.NewEntropy(32)
+	phrase, _ := hd.NewMnemonic(entropy)
+	path := filepath.Join(t.TempDir(), "vault")
+	file, _ := os.Create(path)
+	vault, err := RecoverSecureVault("password", testKDF, phrase, "", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := NewAuthor(crypto.ZeroToken, crypto.ZeroPrivateKey, vault)
+	identity, _ := vault.NewPurposeKey(hd.PurposeAuthor)
+	author.Author, author.Signer = identity.PublicKey(), identity
+	create, err := author.CreateStage(1, "private", ENCRYPTED, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	join, err := author.JoinStage(2, create.Stage, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, _ := author.currentReadKey(author.Stages[create.Stage])
+
+	// the derivation resumes after reopening and changing the password
+	if err := vault.ChangePassword("password", "changed", testKDF); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	file, _ = os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+	vault, err = OpenSecureVault("changed", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	if next, _ := vault.NewKey(); next.PublicKey() == create.Stage || next.PublicKey() == create.Submission {
+		t.Error("stage key derived twice")
+	}
+
+	file, _ = os.Create(filepath.Join(t.TempDir(), "recovered"))
+	recovered, err := RecoverSecureVault("other", testKDF, phrase, "", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	for purpose, count := range map[uint32]uint32{hd.PurposeAuthor: 1, hd.PurposeStage: 3, hd.PurposeEphemeral: 1, hd.PurposeRead: 1} {
+		if err := recovered.Regenerate(purpose, count); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, token := range []crypto.Token{identity.PublicKey(), create.Stage, create.Submission, create.Moderation, join.DiffHellKey} {
+		if _, ok := recovered.GetKey(token); !ok {
+			t.Errorf("key not regenerated from phrase")
+		}
+	}
+	if key, ok := recovered.GetCipher(CipherKeyID(read)); !ok || !bytes.Equal(key, read) {
+		t.Error("read key not regenerated from phrase")
+	}
+	if next, _ := recovered.NewKey(); next.PublicKey() == create.Moderation {
+		t.Error("regenerated index derived again")
+	}
+
+	file, _ = os.Create(filepath.Join(t.TempDir(), "other"))
+	protected, err := RecoverSecureVault("password", testKDF, phrase, "passphrase", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := protected.NewPurposeKey(hd.PurposeAuthor); key == identity {
+		t.Error("passphrase does not change derived keys")
+	}
+	if _, err := RecoverSecureVault("password", testKDF, "abandon abandon", "", file); err != hd.ErrPhraseLength {
+		t.Error("invalid phrase accepted")
+	}
+}
+
+func TestSecureVaultDerivationPurposes(t *testing.T) {
+	entropy, _ := hd.NewEntropy(32)
+	phrase, _ := hd.NewMnemonic(entropy)
+	seed, _ := hd.MnemonicSeed(phrase, "")
+	vault, err := RecoverSecureVault("password", testKDF, phrase, "", &bufferCloser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index := uint32(0); index < 3; index++ {
+		key, _ := vault.NewKey()
+		if key != hd.Derive(seed, hd.Path(hd.PurposeStage, index)...).PrivateKey() {
+			t.Errorf("stage key %v not derived on stage purpose", index)
+		}
+	}
+	prv, pub, _ := vault.NewEphemeralKey()
+	if want, token := dh.KeyFromSeed(hd.Derive(seed, hd.Path(hd.PurposeEphemeral, 0)...).Key); prv != want || pub != token {
+		t.Error("ephemeral key not derived on ephemeral purpose")
+	}
+	if key, _ := vault.NewPurposeKey(hd.PurposeWallet); key != hd.Derive(seed, hd.Path(hd.PurposeWallet, 0)...).PrivateKey() {
+		t.Error("wallet key not derived on wallet purpose")
+	}
+}
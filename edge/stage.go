@@ -0,0 +1,74 @@
+package edge
+
+import (
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// Serialize returns the state of the stage with the histories of its keys and
+// its members. Content is not included, it is persisted by the content store
+// of the stage.
+func (s *Stage) Serialize() []byte {
+	data := make([]byte, 0)
+	util.PutToken(s.Token, &data)
+	util.PutByte(s.Flag, &data)
+	util.PutByte(s.Permissions, &data)
+	util.PutString(s.Description, &data)
+	util.PutBool(s.Public, &data)
+	util.PutBool(s.Live, &data)
+	putTokenHistory(s.Read, &data)
+	putTokenHistory(s.Submission, &data)
+	putTokenHistory(s.Moderation, &data)
+	for _, members := range s.Members.all() {
+		putMembers(members, &data)
+	}
+	return data
+}
+
+// ParseStage parses a stage serialized by Serialize. The content store of the
+// parsed stage is an empty memory store. It returns nil if data is malformed.
+func ParseStage(data []byte) *Stage {
+	stage := newStage(crypto.ZeroToken)
+	position := 0
+	stage.Token, position = util.ParseToken(data, position)
+	stage.Flag, position = util.ParseByte(data, position)
+	stage.Permissions, position = util.ParseByte(data, position)
+	stage.Description, position = util.ParseString(data, position)
+	stage.Public, position = util.ParseBool(data, position)
+	stage.Live, position = util.ParseBool(data, position)
+	stage.Read, position = parseTokenHistory(data, position)
+	stage.Submission, position = parseTokenHistory(data, position)
+	stage.Moderation, position = parseTokenHistory(data, position)
+	for _, members := range stage.Members.all() {
+		position = parseMembers(data, position, members)
+	}
+	if position != len(data) {
+		return nil
+	}
+	return stage
+}
+
+// all returns the member maps in the order they are serialized.
+func (s *StageMembers) all() []map[crypto.Token]crypto.Token {
+	return []map[crypto.Token]crypto.Token{s.Readers, s.Submitors, s.Moderators, s.Requests}
+}
+
+func putMembers(members map[crypto.Token]crypto.Token, data *[]byte) {
+	util.PutUint16(uint16(len(members)), data)
+	for member, dhKey := range members {
+		util.PutToken(member, data)
+		util.PutToken(dhKey, data)
+	}
+}
+
+func parseMembers(data []byte, position int, members map[crypto.Token]crypto.Token) int {
+	var length uint16
+	length, position = util.ParseUint16(data, position)
+	for n := 0; n < int(length) && position < len(data); n++ {
+		var member, dhKey crypto.Token
+		member, position = util.ParseToken(data, position)
+		dhKey, position = util.ParseToken(data, position)
+		members[member] = dhKey
+	}
+	return position
+}
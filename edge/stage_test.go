@@ -0,0 +1,79 @@
+package edge
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+func TestTokenHistory(t *testing.T) {
+	tokens := make([]crypto.Token, 3)
+	for n := range tokens {
+		tokens[n], _ = crypto.RandomAsymetricKey()
+	}
+	history := make(TokenHistory, 0)
+	history.Append(10, tokens[1])
+	history.Append(20, tokens[2])
+	history.Append(5, tokens[0])
+	history.Append(15, tokens[1])
+	if current, _ := history.Current(); current != tokens[2] || len(history) != 3 {
+		t.Fatalf("wrong history: %v", history)
+	}
+	for _, valid := range []struct {
+		epoch uint64
+		token crypto.Token
+	}{{5, tokens[0]}, {9, tokens[0]}, {10, tokens[1]}, {19, tokens[1]}, {20, tokens[2]}, {100, tokens[2]}} {
+		if token, ok := history.Token(valid.epoch); !ok || token != valid.token {
+			t.Errorf("wrong token valid at epoch %v", valid.epoch)
+		}
+	}
+	if _, ok := history.Token(4); ok {
+		t.Error("token valid before its epoch")
+	}
+}
+
+func TestStageSerialize(t *testing.T) {
+	owner := newTestAuthor(t, "owner")
+	member := newTestAuthor(t, "member")
+	create, err := owner.CreateStage(1, "stage", ENCRYPTED|CLOSED, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	join, _ := member.JoinStage(2, create.Stage, "hello")
+	if _, err := owner.AcceptJoinRequest(3, join, MODERATE); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.RotateStage(4, create.Stage); err != nil {
+		t.Fatal(err)
+	}
+	stage := owner.Stages[create.Stage]
+	stage.Members.Requests[owner.Author] = crypto.ZeroToken
+
+	var snapshot bytes.Buffer
+	if err := NewDrama(owner, nil, nil).Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	drama := NewDrama(nil, nil, nil)
+	if err := drama.Restore(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	parsed := drama.Stages[create.Stage]
+	if parsed == nil || parsed.Description != "stage" || parsed.Flag != 3 || parsed.Permissions != ENCRYPTED|CLOSED || parsed.Public {
+		t.Fatal("stage not restored")
+	}
+	for _, history := range [][2]TokenHistory{{stage.Read, parsed.Read}, {stage.Submission, parsed.Submission}, {stage.Moderation, parsed.Moderation}} {
+		if len(history[0]) != 2 || len(history[1]) != 2 || history[0][0] != history[1][0] || history[0][1] != history[1][1] {
+			t.Errorf("history not restored: %v", history[1])
+		}
+		if token, _ := history[1].Token(3); token != history[0][1].Token {
+			t.Error("wrong token valid before rotation")
+		}
+	}
+	if parsed.Members.Moderators[member.Author] != join.DiffHellKey || len(parsed.Members.Requests) != 1 {
+		t.Error("members not restored")
+	}
+	if ParseStage(stage.Serialize()[:40]) != nil {
+		t.Error("truncated stage parsed")
+	}
+}
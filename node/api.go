@@ -0,0 +1,836 @@
+package node
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/block"
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/util"
+	"github.com/lienkolabs/aereum/node/blob"
+	"github.com/lienkolabs/aereum/node/index"
+)
+
+// SubmitRequest is the body of a POST to /instruction.
+type SubmitRequest struct {
+	Instruction string `json:"instruction"` // base64 serialized instruction
+}
+
+// API returns the HTTP JSON interface of the node. Tokens and hashes are hex
+// encoded, with or without 0x prefix.
+//
+//	POST /instruction             submit a base64 serialized instruction
+//	GET  /instruction?hash=       instruction with the hash
+//	GET  /block?epoch= | ?hash=   block by epoch or by hash
+//	GET  /balance?token=          wallet, staked and unbonding balances
+//	GET  /member?token=           membership of the token
+//	GET  /stage?token=            keys of the stage
+//	GET  /fee                     current fee per byte of instruction
+//	GET  /feed?token=&since=&wait= long-poll of instructions touching tokens
+//	GET  /receipt?hash=           inclusion status of the instruction
+//	GET  /receipts?hash=&since=&wait= long-poll of receipt updates
+//	GET  /history?author= | ?stage= | ?wallet= | ?kind= &offset=&limit=
+//	                              indexed instructions, newest first
+//	GET  /thread?content=&offset=&limit= contents of the thread of the content
+//	GET  /replies?content=&offset=&limit= direct replies to the content
+//	GET  /queue?stage=&epoch=&signature=&offset=&limit=
+//	                              embargoed contents of the stage, for its
+//	                              moderators, see QueueMessage
+//	POST /blob?content=           store the raw body as the blob of the content
+//	GET  /blob?root=              manifest of the blob with the root hash
+//	GET  /chunk?hash=             raw chunk of a blob
+//	GET  /reactions?content=&author= tally of reactions to the content and
+//	                              the reaction of the author
+func (n *Node) API() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/instruction", n.handleInstruction)
+	mux.HandleFunc("/block", n.handleBlock)
+	mux.HandleFunc("/balance", n.handleBalance)
+	mux.HandleFunc("/member", n.handleMember)
+	mux.HandleFunc("/stage", n.handleStage)
+	mux.HandleFunc("/fee", n.handleFee)
+	mux.HandleFunc("/feed", n.handleFeed)
+	mux.HandleFunc("/receipt", n.handleReceipt)
+	mux.HandleFunc("/receipts", n.handleReceipts)
+	mux.HandleFunc("/history", n.handleHistory)
+	mux.HandleFunc("/reactions", n.handleReactions)
+	mux.HandleFunc("/thread", n.handleThread)
+	mux.HandleFunc("/blob", n.handleBlob)
+	mux.HandleFunc("/chunk", n.handleChunk)
+	mux.HandleFunc("/replies", n.handleReplies)
+	mux.HandleFunc("/queue", n.handleQueue)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("error", err.Error())
+	writeJSON(w, status, bulk.ToString())
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func parseToken(value string) (crypto.Token, error) {
+	var token crypto.Token
+	bytes, err := decodeHex(value)
+	if err != nil || len(bytes) != crypto.TokenSize {
+		return token, errors.New("invalid token")
+	}
+	copy(token[:], bytes)
+	return token, nil
+}
+
+func parseHash(value string) (crypto.Hash, error) {
+	bytes, err := decodeHex(value)
+	if err != nil || len(bytes) != crypto.Size {
+		return crypto.Hash{}, errors.New("invalid hash")
+	}
+	return crypto.BytesToHash(bytes), nil
+}
+
+func queryToken(r *http.Request) (crypto.Token, error) {
+	return parseToken(r.URL.Query().Get("token"))
+}
+
+func queryHash(r *http.Request) (crypto.Hash, error) {
+	return parseHash(r.URL.Query().Get("hash"))
+}
+
+func (n *Node) handleInstruction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var request SubmitRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		data, err := base64.StdEncoding.DecodeString(request.Instruction)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		hash, err := n.Submit(data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		bulk := &util.JSONBuilder{}
+		bulk.PutHex("hash", hash[:])
+		writeJSON(w, http.StatusAccepted, bulk.ToString())
+	case http.MethodGet:
+		hash, err := queryHash(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		data, location, err := n.Chain.Instruction(hash)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		instruction := instructions.ParseInstruction(data)
+		if instruction == nil {
+			writeError(w, http.StatusInternalServerError, ErrUnknownInstruction)
+			return
+		}
+		if content, ok := instruction.(*instructions.Content); ok {
+			if content.Embargoed(n.Chain.Epoch()) {
+				writeError(w, http.StatusNotFound, ErrEmbargoed)
+				return
+			}
+			if n.Index != nil {
+				if entry, ok := n.Index.Content(hash); ok && entry.Hidden {
+					writeError(w, http.StatusGone, ErrTakenDown)
+					return
+				}
+			}
+		}
+		bulk := &util.JSONBuilder{}
+		bulk.PutHex("hash", hash[:])
+		bulk.PutUint64("epoch", location.Epoch)
+		bulk.PutHex("block", location.BlockHash[:])
+		bulk.PutUint64("index", uint64(location.Index))
+		bulk.PutJSON("instruction", instruction.JSON())
+		writeJSON(w, http.StatusOK, bulk.ToString())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (n *Node) handleBlock(w http.ResponseWriter, r *http.Request) {
+	var data []byte
+	var err error
+	if epoch := r.URL.Query().Get("epoch"); epoch != "" {
+		value, parseErr := strconv.ParseUint(epoch, 10, 64)
+		if parseErr != nil {
+			writeError(w, http.StatusBadRequest, parseErr)
+			return
+		}
+		data, err = n.Chain.Block(value)
+	} else {
+		hash, hashErr := queryHash(r)
+		if hashErr != nil {
+			writeError(w, http.StatusBadRequest, hashErr)
+			return
+		}
+		data, err = n.Chain.BlockByHash(hash)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	parsed := block.ParseBlock(data)
+	if parsed == nil {
+		writeError(w, http.StatusInternalServerError, ErrInvalidBlock)
+		return
+	}
+	writeJSON(w, http.StatusOK, parsed.JSONSimple())
+}
+
+func (n *Node) handleBalance(w http.ResponseWriter, r *http.Request) {
+	token, err := queryToken(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	balance, staked, unbonding := n.Chain.Balance(token)
+	bulk := &util.JSONBuilder{}
+	bulk.PutHex("token", token[:])
+	bulk.PutUint64("balance", balance)
+	bulk.PutUint64("staked", staked)
+	bulk.PutUint64("unbonding", unbonding)
+	writeJSON(w, http.StatusOK, bulk.ToString())
+}
+
+func (n *Node) handleMember(w http.ResponseWriter, r *http.Request) {
+	token, err := queryToken(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	bulk := &util.JSONBuilder{}
+	bulk.PutHex("token", token[:])
+	bulk.PutJSON("member", strconv.FormatBool(n.Chain.HasMember(token)))
+	writeJSON(w, http.StatusOK, bulk.ToString())
+}
+
+func (n *Node) handleStage(w http.ResponseWriter, r *http.Request) {
+	token, err := queryToken(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	keys := n.Chain.StageKeys(token)
+	if keys == nil {
+		writeError(w, http.StatusNotFound, errors.New("unknown stage"))
+		return
+	}
+	bulk := &util.JSONBuilder{}
+	bulk.PutHex("stage", keys.Stage[:])
+	if keys.Submit != crypto.ZeroToken {
+		bulk.PutHex("submit", keys.Submit[:])
+	}
+	if keys.Moderate != crypto.ZeroToken {
+		bulk.PutHex("moderate", keys.Moderate[:])
+	}
+	bulk.PutUint64("flag", uint64(keys.Flag))
+	writeJSON(w, http.StatusOK, bulk.ToString())
+}
+
+func (n *Node) handleFee(w http.ResponseWriter, r *http.Request) {
+	bulk := &util.JSONBuilder{}
+	bulk.PutUint64("fee", n.Fees.CurrentFee())
+	bulk.PutUint64("baseFee", n.Fees.BaseFee())
+	bulk.PutUint64("minimumFee", instructions.MinimumFeePerByte)
+	writeJSON(w, http.StatusOK, bulk.ToString())
+}
+
+// MaxFeedWait bounds the time a long-poll on /feed is held open.
+const MaxFeedWait = 60 * time.Second
+
+// handleFeed answers with the instructions after sequence number since that
+// touch any of the token parameters. If there is none, the request is held
+// until one arrives or wait seconds elapse. Without since, the feed starts at
+// its head. The response carries the sequence number to ask next.
+func (n *Node) handleFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tokens := make(map[crypto.Token]struct{})
+	for _, value := range query["token"] {
+		token, err := parseToken(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tokens[token] = struct{}{}
+	}
+	since, wait, err := queryPoll(r, n.Feed.Head())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for {
+		found, next, notify := n.Feed.Since(since, tokens)
+		if len(found) > 0 || wait == 0 {
+			writeJSON(w, http.StatusOK, feedJSON(next, found))
+			return
+		}
+		select {
+		case <-notify:
+			since = next
+		case <-timeout.C:
+			writeJSON(w, http.StatusOK, feedJSON(next, found))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// queryPoll parses the since and wait parameters of a long-poll. Without
+// since, the poll starts at head.
+func queryPoll(r *http.Request, head uint64) (uint64, time.Duration, error) {
+	query := r.URL.Query()
+	since := head
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	wait := time.Duration(0)
+	if value := query.Get("wait"); value != "" {
+		seconds, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > MaxFeedWait {
+			wait = MaxFeedWait
+		}
+	}
+	return since, wait, nil
+}
+
+// FeedResponse is the body of a response of /feed.
+type FeedResponse struct {
+	Next         uint64   `json:"next"`
+	Instructions []string `json:"instructions"` // base64 serialized instructions
+}
+
+func feedJSON(next uint64, found [][]byte) string {
+	array := &strings.Builder{}
+	array.WriteRune('[')
+	for n, data := range found {
+		if n > 0 {
+			array.WriteRune(',')
+		}
+		fmt.Fprintf(array, `"%v"`, base64.StdEncoding.EncodeToString(data))
+	}
+	array.WriteRune(']')
+	bulk := &util.JSONBuilder{}
+	bulk.PutUint64("next", next)
+	bulk.PutJSON("instructions", array.String())
+	return bulk.ToString()
+}
+
+func (n *Node) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	hash, err := queryHash(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	receipt, ok := n.Receipt(hash)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrUnknownInstruction)
+		return
+	}
+	writeJSON(w, http.StatusOK, receipt.JSON())
+}
+
+// handleReceipts answers with the receipts of the hash parameters updated
+// after sequence number since. If there is none, the request is held until
+// one is updated or wait seconds elapse. Without since, every known receipt
+// of the hashes is returned.
+func (n *Node) handleReceipts(w http.ResponseWriter, r *http.Request) {
+	hashes := make([]crypto.Hash, 0)
+	for _, value := range r.URL.Query()["hash"] {
+		hash, err := parseHash(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		hashes = append(hashes, hash)
+	}
+	since, wait, err := queryPoll(r, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for {
+		found, next, notify := n.Receipts.Since(since, hashes)
+		if since == 0 {
+			found = n.includedReceipts(found, hashes)
+		}
+		if len(found) > 0 || wait == 0 {
+			writeJSON(w, http.StatusOK, receiptsJSON(next, found))
+			return
+		}
+		select {
+		case <-notify:
+			since = next
+		case <-timeout.C:
+			writeJSON(w, http.StatusOK, receiptsJSON(next, found))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// includedReceipts completes found with the receipts of hashes already
+// forgotten by the receipts store but included on the chain.
+func (n *Node) includedReceipts(found []Receipt, hashes []crypto.Hash) []Receipt {
+	known := make(map[crypto.Hash]struct{})
+	for _, receipt := range found {
+		known[receipt.Hash] = struct{}{}
+	}
+	for _, hash := range hashes {
+		if _, ok := known[hash]; ok {
+			continue
+		}
+		if receipt, ok := n.Receipt(hash); ok && receipt.Status == ReceiptIncluded {
+			found = append(found, receipt)
+		}
+	}
+	return found
+}
+
+// ReceiptsResponse is the body of a response of /receipts.
+type ReceiptsResponse struct {
+	Next     uint64            `json:"next"`
+	Receipts []json.RawMessage `json:"receipts"`
+}
+
+func receiptsJSON(next uint64, found []Receipt) string {
+	array := &strings.Builder{}
+	array.WriteRune('[')
+	for n, receipt := range found {
+		if n > 0 {
+			array.WriteRune(',')
+		}
+		array.WriteString(receipt.JSON())
+	}
+	array.WriteRune(']')
+	bulk := &util.JSONBuilder{}
+	bulk.PutUint64("next", next)
+	bulk.PutJSON("receipts", array.String())
+	return bulk.ToString()
+}
+
+// ErrNoIndexer is returned by the history queries of a node without indexer.
+var ErrNoIndexer = errors.New("indexer not enabled on node")
+
+// handleHistory lists the indexed instructions of an author, a stage, a wallet
+// or a kind. Pages are selected by offset and limit, counted from the newest
+// instruction.
+func (n *Node) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if n.Index == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoIndexer)
+		return
+	}
+	query := r.URL.Query()
+	offset, limit, err := queryPage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var page index.Page
+	switch {
+	case query.Get("author") != "":
+		token, err := parseToken(query.Get("author"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		page = n.Index.ByAuthor(token, offset, limit)
+	case query.Get("stage") != "":
+		token, err := parseToken(query.Get("stage"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		page = n.Index.ByStage(token, offset, limit)
+	case query.Get("wallet") != "":
+		token, err := parseToken(query.Get("wallet"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		page = n.Index.ByWallet(token, offset, limit)
+	case query.Get("kind") != "":
+		kind, err := strconv.ParseUint(query.Get("kind"), 10, 8)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid kind"))
+			return
+		}
+		page = n.Index.ByKind(byte(kind), offset, limit)
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("one of author, stage, wallet or kind is required"))
+		return
+	}
+	writeJSON(w, http.StatusOK, n.pageJSON(page))
+}
+
+// queryPage parses the offset and limit parameters of a paginated query.
+func queryPage(r *http.Request) (int, int, error) {
+	query := r.URL.Query()
+	offset, limit := 0, index.DefaultPageSize
+	for name, value := range map[string]*int{"offset": &offset, "limit": &limit} {
+		if param := query.Get(name); param != "" {
+			parsed, err := strconv.Atoi(param)
+			if err != nil || parsed < 0 {
+				return 0, 0, fmt.Errorf("invalid %v", name)
+			}
+			*value = parsed
+		}
+	}
+	return offset, limit, nil
+}
+
+func (n *Node) pageJSON(page index.Page) string {
+	array := &strings.Builder{}
+	array.WriteRune('[')
+	for count, entry := range page.Entries {
+		if count > 0 {
+			array.WriteRune(',')
+		}
+		bulk := &util.JSONBuilder{}
+		bulk.PutHex("hash", entry.Hash[:])
+		bulk.PutUint64("kind", uint64(entry.Kind))
+		bulk.PutUint64("epoch", entry.Epoch)
+		if entry.Published != entry.Epoch {
+			bulk.PutUint64("published", entry.Published)
+		}
+		bulk.PutUint64("index", uint64(entry.Index))
+		if entry.Flagged {
+			bulk.PutUint64("flagged", uint64(entry.Reason))
+		}
+		if data, _, err := n.Chain.Instruction(entry.Hash); err == nil {
+			if instruction := instructions.ParseInstruction(data); instruction != nil {
+				bulk.PutJSON("instruction", instruction.JSON())
+			}
+		}
+		array.WriteString(bulk.ToString())
+	}
+	array.WriteRune(']')
+	bulk := &util.JSONBuilder{}
+	bulk.PutUint64("total", uint64(page.Total))
+	bulk.PutJSON("instructions", array.String())
+	return bulk.ToString()
+}
+
+var (
+	// ErrTakenDown is returned by queries on content hidden by a moderator.
+	ErrTakenDown = errors.New("content taken down by moderator")
+	// ErrEmbargoed is returned by queries on content not yet published. It
+	// answers as unknown content does, so that the query does not disclose
+	// the content.
+	ErrEmbargoed = errors.New("unknown content")
+)
+
+// visibleContent answers with an error and returns false unless the content
+// is indexed, published and not hidden.
+func (n *Node) visibleContent(w http.ResponseWriter, content crypto.Hash) bool {
+	entry, ok := n.Index.Content(content)
+	if !ok || entry.Embargoed(n.Index.Epoch()) {
+		writeError(w, http.StatusNotFound, ErrEmbargoed)
+		return false
+	}
+	if entry.Hidden {
+		writeError(w, http.StatusGone, ErrTakenDown)
+		return false
+	}
+	return true
+}
+
+func (n *Node) handleReactions(w http.ResponseWriter, r *http.Request) {
+	if n.Index == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoIndexer)
+		return
+	}
+	content, err := parseHash(r.URL.Query().Get("content"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !n.visibleContent(w, content) {
+		return
+	}
+	tally := n.Index.Reactions(content)
+	reactions := make([]int, 0, len(tally))
+	for reaction := range tally {
+		reactions = append(reactions, int(reaction))
+	}
+	sort.Ints(reactions)
+	total := 0
+	counts := &util.JSONBuilder{}
+	for _, reaction := range reactions {
+		counts.PutUint64(strconv.Itoa(reaction), uint64(tally[byte(reaction)]))
+		total += tally[byte(reaction)]
+	}
+	bulk := &util.JSONBuilder{}
+	bulk.PutHex("content", content[:])
+	bulk.PutUint64("total", uint64(total))
+	bulk.PutJSON("reactions", counts.ToString())
+	if value := r.URL.Query().Get("author"); value != "" {
+		author, err := parseToken(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if reaction, ok := n.Index.Reaction(author, content); ok {
+			bulk.PutUint64("reaction", uint64(reaction))
+		}
+	}
+	writeJSON(w, http.StatusOK, bulk.ToString())
+}
+
+// handleThread lists the contents of the thread of a content, oldest first,
+// starting with the content that opened the thread.
+func (n *Node) handleThread(w http.ResponseWriter, r *http.Request) {
+	if n.Index == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoIndexer)
+		return
+	}
+	content, err := parseHash(r.URL.Query().Get("content"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, limit, err := queryPage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !n.visibleContent(w, content) {
+		return
+	}
+	root, page := n.Index.Thread(content, offset, limit)
+	bulk := &util.JSONBuilder{}
+	bulk.PutHex("root", root[:])
+	bulk.PutJSON("thread", n.pageJSON(page))
+	writeJSON(w, http.StatusOK, bulk.ToString())
+}
+
+// handleReplies lists the direct replies to a content, newest first.
+func (n *Node) handleReplies(w http.ResponseWriter, r *http.Request) {
+	if n.Index == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoIndexer)
+		return
+	}
+	content, err := parseHash(r.URL.Query().Get("content"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, limit, err := queryPage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, n.pageJSON(n.Index.Replies(content, offset, limit)))
+}
+
+// QueueRequestEpochs is the number of epochs a signed request of the queue
+// of a stage is accepted for.
+const QueueRequestEpochs = 60
+
+// ErrNotModerator is returned by queries reserved to the moderators of a
+// stage that are not signed by its moderation key.
+var ErrNotModerator = errors.New("request not signed by the moderation key of the stage")
+
+// ErrUnreferencedBlob is returned for uploads of blobs not referenced by the
+// content instruction of the request.
+var ErrUnreferencedBlob = errors.New("blob not referenced by a content instruction")
+
+// QueueMessage is the message signed by the moderation key of a stage to list
+// the queue of the stage at epoch.
+func QueueMessage(stage crypto.Token, epoch uint64) []byte {
+	message := []byte("aereum queue")
+	util.PutToken(stage, &message)
+	util.PutUint64(epoch, &message)
+	return message
+}
+
+// moderatorRequest checks that the request is signed by the moderation key of
+// the stage within QueueRequestEpochs epochs.
+func (n *Node) moderatorRequest(r *http.Request, stage crypto.Token) bool {
+	query := r.URL.Query()
+	epoch, err := strconv.ParseUint(query.Get("epoch"), 10, 64)
+	if err != nil || epoch > n.Chain.Epoch() || n.Chain.Epoch()-epoch > QueueRequestEpochs {
+		return false
+	}
+	bytes, err := decodeHex(query.Get("signature"))
+	if err != nil || len(bytes) != crypto.SignatureSize {
+		return false
+	}
+	var signature crypto.Signature
+	copy(signature[:], bytes)
+	keys := n.Chain.StageKeys(stage)
+	if keys == nil || keys.Moderate == crypto.ZeroToken {
+		return false
+	}
+	return keys.Moderate.Verify(QueueMessage(stage, epoch), signature)
+}
+
+// handleQueue lists the embargoed contents of a stage, oldest first, so that
+// its moderators can take down those they do not approve before they are
+// published. The request must be signed by the moderation key of the stage,
+// see QueueMessage.
+func (n *Node) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if n.Index == nil {
+		writeError(w, http.StatusNotImplemented, ErrNoIndexer)
+		return
+	}
+	stage, err := parseToken(r.URL.Query().Get("stage"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, limit, err := queryPage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !n.moderatorRequest(r, stage) {
+		writeError(w, http.StatusForbidden, ErrNotModerator)
+		return
+	}
+	writeJSON(w, http.StatusOK, n.pageJSON(n.Index.Queue(stage, offset, limit)))
+}
+
+// blobContent returns the content instruction with the hash, waiting on the
+// mempool or included on the chain, if it references a blob.
+func (n *Node) blobContent(hash crypto.Hash) *instructions.Content {
+	data, ok := n.Mempool.Get(hash)
+	if !ok {
+		var err error
+		if data, _, err = n.Chain.Instruction(hash); err != nil {
+			return nil
+		}
+	}
+	if content, ok := instructions.ParseInstruction(data).(*instructions.Content); ok && content.IsBlob() {
+		return content
+	}
+	return nil
+}
+
+// handleBlob stores and serves blobs. A blob is only accepted for a signed
+// content instruction referencing it, submitted to the node beforehand, and
+// must match the root hash and the size carried by the content.
+func (n *Node) handleBlob(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		hash, err := parseHash(r.URL.Query().Get("content"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		content := n.blobContent(hash)
+		if content == nil {
+			writeError(w, http.StatusForbidden, ErrUnreferencedBlob)
+			return
+		}
+		if content.BlobSize > blob.MaxBlobSize {
+			writeError(w, http.StatusBadRequest, blob.ErrBlobTooLarge)
+			return
+		}
+		// A mismatching blob is stored until collected, as it is unreferenced.
+		root, size, err := n.Blobs.Put(http.MaxBytesReader(w, r.Body, int64(content.BlobSize)))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if root != crypto.BytesToHash(content.Hash) || size != content.BlobSize {
+			writeError(w, http.StatusBadRequest, ErrUnreferencedBlob)
+			return
+		}
+		bulk := &util.JSONBuilder{}
+		bulk.PutHex("root", root[:])
+		bulk.PutUint64("size", size)
+		writeJSON(w, http.StatusCreated, bulk.ToString())
+	case http.MethodGet:
+		root, err := parseHash(r.URL.Query().Get("root"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		manifest, err := n.Blobs.Manifest(root)
+		if err == blob.ErrUnknownBlob {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		chunks := &strings.Builder{}
+		chunks.WriteRune('[')
+		for count, chunk := range manifest.Chunks {
+			if count > 0 {
+				chunks.WriteRune(',')
+			}
+			fmt.Fprintf(chunks, `"0x%v"`, hex.EncodeToString(chunk[:]))
+		}
+		chunks.WriteRune(']')
+		bulk := &util.JSONBuilder{}
+		bulk.PutHex("root", root[:])
+		bulk.PutUint64("size", manifest.Size)
+		bulk.PutJSON("chunks", chunks.String())
+		writeJSON(w, http.StatusOK, bulk.ToString())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleChunk serves a chunk of a blob. Chunks failing their integrity check
+// are not served.
+func (n *Node) handleChunk(w http.ResponseWriter, r *http.Request) {
+	hash, err := queryHash(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	data, err := n.Blobs.Chunk(hash)
+	if err == blob.ErrUnknownChunk {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
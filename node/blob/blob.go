@@ -0,0 +1,344 @@
+// Package blob implements a content-addressed store for payloads too large to
+// fit a content instruction. A blob is split into chunks stored by their hash.
+// The blob is identified by its root hash, the hash of the concatenated hashes
+// of its chunks, which is what a content instruction carries on the chain.
+package blob
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// ChunkSize is the size of every chunk of a blob but the last one.
+const ChunkSize = 1 << 18
+
+// MaxBlobSize bounds the size of a blob accepted by the store.
+const MaxBlobSize = 1 << 28
+
+var (
+	ErrUnknownBlob   = errors.New("unknown blob")
+	ErrUnknownChunk  = errors.New("unknown chunk")
+	ErrCorruptedBlob = errors.New("blob does not match its hash")
+	ErrBlobTooLarge  = errors.New("blob exceeds maximum size")
+)
+
+// Manifest lists the chunks of a blob in order.
+type Manifest struct {
+	Size   uint64
+	Chunks []crypto.Hash
+}
+
+// Root returns the hash identifying the blob.
+func (m *Manifest) Root() crypto.Hash {
+	concatenated := make([]byte, 0, len(m.Chunks)*crypto.Size)
+	for _, chunk := range m.Chunks {
+		concatenated = append(concatenated, chunk[:]...)
+	}
+	return crypto.Hasher(concatenated)
+}
+
+// Check verifies that the chunk sizes add up to the size of the blob given the
+// chunk size used to split it.
+func (m *Manifest) Check() bool {
+	if m.Size == 0 || m.Size > MaxBlobSize {
+		return false
+	}
+	return uint64(len(m.Chunks)) == (m.Size+ChunkSize-1)/ChunkSize
+}
+
+// ChunkLength returns the expected length of the chunk at position n.
+func (m *Manifest) ChunkLength(n int) int {
+	if n < len(m.Chunks)-1 {
+		return ChunkSize
+	}
+	return int(m.Size - uint64(len(m.Chunks)-1)*ChunkSize)
+}
+
+func (m *Manifest) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(m.Size, &bytes)
+	util.PutUint64(uint64(len(m.Chunks)), &bytes)
+	for _, chunk := range m.Chunks {
+		util.PutByteArray(chunk[:], &bytes)
+	}
+	return bytes
+}
+
+func ParseManifest(data []byte) *Manifest {
+	manifest := Manifest{}
+	position := 0
+	var count uint64
+	manifest.Size, position = util.ParseUint64(data, position)
+	count, position = util.ParseUint64(data, position)
+	if count > MaxBlobSize/ChunkSize+1 {
+		return nil
+	}
+	manifest.Chunks = make([]crypto.Hash, count)
+	for n := range manifest.Chunks {
+		manifest.Chunks[n], position = util.ParseHash(data, position)
+	}
+	if position != len(data) || !manifest.Check() {
+		return nil
+	}
+	return &manifest
+}
+
+// Store keeps chunks and manifests as files named by their hash on a
+// directory. Blobs are kept while referenced, see Reference and Collect.
+type Store struct {
+	dir        string
+	mu         sync.Mutex
+	referenced map[crypto.Hash]struct{}
+}
+
+// OpenStore returns a store on dir, creating the directory if needed.
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, referenced: make(map[crypto.Hash]struct{})}, nil
+}
+
+// Reference marks the blob with the root hash as referenced, typically by a
+// content instruction on the chain, so that it is not collected.
+func (s *Store) Reference(root crypto.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.referenced[root] = struct{}{}
+}
+
+func (s *Store) path(hash crypto.Hash, extension string) string {
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:])+extension)
+}
+
+// temporaryExtension marks files still being written.
+const temporaryExtension = ".tmp"
+
+// write stores data atomically under the hash. Data is written to a temporary
+// file of its own, so that concurrent writes of the same hash do not race.
+func (s *Store) write(hash crypto.Hash, extension string, data []byte) error {
+	path := s.path(hash, extension)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	temporary, err := os.CreateTemp(s.dir, filepath.Base(path)+".*"+temporaryExtension)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	_, err = temporary.Write(data)
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
+
+// split reads the payload from r in chunks and calls f on each of them. It
+// returns the manifest of the blob.
+func split(r io.Reader, f func(hash crypto.Hash, chunk []byte) error) (*Manifest, error) {
+	manifest := Manifest{Chunks: make([]crypto.Hash, 0)}
+	chunk := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			manifest.Size += uint64(n)
+			if manifest.Size > MaxBlobSize {
+				return nil, ErrBlobTooLarge
+			}
+			hash := crypto.Hasher(chunk[:n])
+			if err := f(hash, chunk[:n]); err != nil {
+				return nil, err
+			}
+			manifest.Chunks = append(manifest.Chunks, hash)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if manifest.Size == 0 {
+		return nil, errors.New("empty blob")
+	}
+	return &manifest, nil
+}
+
+// Root returns the root hash and the size of the blob of the payload read
+// from r without storing it, for a content instruction to reference the blob
+// before it is uploaded.
+func Root(r io.Reader) (crypto.Hash, uint64, error) {
+	manifest, err := split(r, func(crypto.Hash, []byte) error { return nil })
+	if err != nil {
+		return crypto.Hash{}, 0, err
+	}
+	return manifest.Root(), manifest.Size, nil
+}
+
+// Put splits the payload read from r into chunks and stores them with the
+// manifest of the blob. It returns the root hash and the size of the blob.
+func (s *Store) Put(r io.Reader) (crypto.Hash, uint64, error) {
+	manifest, err := split(r, func(hash crypto.Hash, chunk []byte) error {
+		return s.write(hash, ".chunk", chunk)
+	})
+	if err != nil {
+		return crypto.Hash{}, 0, err
+	}
+	root := manifest.Root()
+	if err := s.write(root, ".blob", manifest.Serialize()); err != nil {
+		return crypto.Hash{}, 0, err
+	}
+	return root, manifest.Size, nil
+}
+
+// Collect removes the blobs not referenced, and the chunks and temporary
+// files no longer needed by any blob kept, last modified before the time.
+// Recent files are kept, so that blobs uploaded ahead of the content
+// referencing them are not collected. It returns the number of files removed.
+func (s *Store) Collect(before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	stale := func(entry os.DirEntry) bool {
+		info, err := entry.Info()
+		return err == nil && info.ModTime().Before(before)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	kept := make(map[crypto.Hash]struct{})
+	chunks := make([]os.DirEntry, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".blob"):
+			bytes, err := hex.DecodeString(strings.TrimSuffix(name, ".blob"))
+			if err != nil {
+				continue
+			}
+			root := crypto.BytesToHash(bytes)
+			if _, ok := s.referenced[root]; !ok && stale(entry) {
+				if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+					return removed, err
+				}
+				removed += 1
+				continue
+			}
+			if manifest, err := s.Manifest(root); err == nil {
+				for _, chunk := range manifest.Chunks {
+					kept[chunk] = struct{}{}
+				}
+			}
+		case strings.HasSuffix(name, ".chunk"):
+			chunks = append(chunks, entry)
+		case strings.HasSuffix(name, temporaryExtension):
+			if stale(entry) && os.Remove(filepath.Join(s.dir, name)) == nil {
+				removed += 1
+			}
+		}
+	}
+	for _, entry := range chunks {
+		bytes, err := hex.DecodeString(strings.TrimSuffix(entry.Name(), ".chunk"))
+		if err != nil {
+			continue
+		}
+		if _, ok := kept[crypto.BytesToHash(bytes)]; ok || !stale(entry) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed += 1
+	}
+	return removed, nil
+}
+
+// Manifest returns the manifest of the blob with the root hash.
+func (s *Store) Manifest(root crypto.Hash) (*Manifest, error) {
+	data, err := os.ReadFile(s.path(root, ".blob"))
+	if os.IsNotExist(err) {
+		return nil, ErrUnknownBlob
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := ParseManifest(data)
+	if manifest == nil || manifest.Root() != root {
+		return nil, ErrCorruptedBlob
+	}
+	return manifest, nil
+}
+
+// Chunk returns the chunk with the hash after checking its integrity.
+func (s *Store) Chunk(hash crypto.Hash) ([]byte, error) {
+	data, err := os.ReadFile(s.path(hash, ".chunk"))
+	if os.IsNotExist(err) {
+		return nil, ErrUnknownChunk
+	}
+	if err != nil {
+		return nil, err
+	}
+	if crypto.Hasher(data) != hash {
+		return nil, ErrCorruptedBlob
+	}
+	return data, nil
+}
+
+// Has checks if the blob and every one of its chunks are on the store.
+func (s *Store) Has(root crypto.Hash) bool {
+	manifest, err := s.Manifest(root)
+	if err != nil {
+		return false
+	}
+	for _, chunk := range manifest.Chunks {
+		if _, err := os.Stat(s.path(chunk, ".chunk")); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy writes the blob with the root hash to w, checking the integrity of
+// every chunk. It returns the number of bytes written.
+func (s *Store) Copy(root crypto.Hash, w io.Writer) (uint64, error) {
+	manifest, err := s.Manifest(root)
+	if err != nil {
+		return 0, err
+	}
+	return Assemble(manifest, s.Chunk, w)
+}
+
+// Assemble writes to w the chunks of the manifest obtained from fetch,
+// checking the hash and the length of every one of them.
+func Assemble(manifest *Manifest, fetch func(crypto.Hash) ([]byte, error), w io.Writer) (uint64, error) {
+	written := uint64(0)
+	for n, hash := range manifest.Chunks {
+		data, err := fetch(hash)
+		if err != nil {
+			return written, err
+		}
+		if len(data) != manifest.ChunkLength(n) || crypto.Hasher(data) != hash {
+			return written, ErrCorruptedBlob
+		}
+		count, err := io.Copy(w, bytes.NewReader(data))
+		written += uint64(count)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
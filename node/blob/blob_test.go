@@ -0,0 +1,102 @@
+package blob
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, 2*ChunkSize+100)
+	rand.Read(payload)
+	root, size, err := store.Put(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(payload)) || !store.Has(root) {
+		t.Fatalf("blob of size %v not stored", size)
+	}
+	manifest, err := store.Manifest(root)
+	if err != nil || len(manifest.Chunks) != 3 || manifest.ChunkLength(2) != 100 {
+		t.Fatalf("wrong manifest: %v", err)
+	}
+	var copied bytes.Buffer
+	if _, err := store.Copy(root, &copied); err != nil || !bytes.Equal(copied.Bytes(), payload) {
+		t.Fatalf("blob not copied back: %v", err)
+	}
+
+	if err := os.WriteFile(store.path(manifest.Chunks[1], ".chunk"), payload[:ChunkSize], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Copy(root, &bytes.Buffer{}); err != ErrCorruptedBlob {
+		t.Errorf("corrupted chunk not detected: %v", err)
+	}
+}
+
+func TestStoreConcurrentPut(t *testing.T) {
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, ChunkSize+100)
+	rand.Read(payload)
+	expected, _, err := Root(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if root, _, err := store.Put(bytes.NewReader(payload)); err != nil || root != expected {
+				t.Errorf("concurrent put failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := store.Copy(expected, &bytes.Buffer{}); err != nil {
+		t.Errorf("blob corrupted by concurrent puts: %v", err)
+	}
+	if temporary, _ := filepath.Glob(filepath.Join(store.dir, "*"+temporaryExtension)); len(temporary) > 0 {
+		t.Errorf("temporary files left: %v", temporary)
+	}
+}
+
+func TestStoreCollect(t *testing.T) {
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := make([]byte, ChunkSize)
+	rand.Read(shared)
+	kept, _, err := store.Put(bytes.NewReader(append(append([]byte{}, shared...), 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped, _, err := store.Put(bytes.NewReader(append(append([]byte{}, shared...), 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Reference(kept)
+	if removed, err := store.Collect(time.Now().Add(-time.Hour)); err != nil || removed != 0 {
+		t.Fatalf("recent files collected: %v, %v", removed, err)
+	}
+	if removed, err := store.Collect(time.Now().Add(time.Hour)); err != nil || removed != 2 {
+		t.Fatalf("expected manifest and last chunk of unreferenced blob collected: %v, %v", removed, err)
+	}
+	if store.Has(dropped) {
+		t.Error("unreferenced blob kept")
+	}
+	if _, err := store.Copy(kept, &bytes.Buffer{}); err != nil {
+		t.Errorf("referenced blob collected: %v", err)
+	}
+}
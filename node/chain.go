@@ -0,0 +1,348 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/block"
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/state"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+const blocksFileName = "blocks.dat"
+
+var (
+	ErrInvalidBlock       = errors.New("invalid block")
+	ErrOutOfSequence      = errors.New("block out of sequence")
+	ErrNotAValidator      = errors.New("block publisher is not a validator")
+	ErrUnknownBlock       = errors.New("unknown block")
+	ErrUnknownInstruction = errors.New("unknown instruction")
+	ErrWrongFeeBalance    = errors.New("block fees do not match its instructions")
+)
+
+// InstructionLocation is the position of an instruction on the chain.
+type InstructionLocation struct {
+	Epoch     uint64
+	BlockHash crypto.Hash
+	Index     int
+}
+
+// Rejection is a pending instruction left out of a produced block together
+// with the reason it was not incorporated. Retry is set for instructions still
+// valid on the state after the block, typically left out because an earlier
+// instruction of the block had not yet funded them, which may be incorporated
+// into a later block.
+type Rejection struct {
+	instructions.HashInstruction
+	Err   error
+	Retry bool
+}
+
+// Chain keeps the sequence of committed blocks on top of the genesis state.
+// Blocks are persisted as frames of an append-only file on the data
+// directory and replayed over the genesis state when the chain is reopened.
+type Chain struct {
+	mu         sync.Mutex
+	Genesis    *state.GenesisSpec
+	State      *state.State
+	Policy     block.FeePolicy
+	validators map[crypto.Token]struct{}
+	blocks     [][]byte // serialized blocks, blocks[n] is of epoch n+1
+	hashes     map[crypto.Hash]uint64
+	locations  map[crypto.Hash]InstructionLocation
+	lastHash   crypto.Hash
+	store      *os.File
+}
+
+// OpenChain builds the genesis state of the spec and replays the blocks found
+// on dataDir. A truncated tail left by a crash is discarded. With an empty
+// dataDir the chain is kept in memory only.
+func OpenChain(genesis *state.GenesisSpec, dataDir string) (*Chain, error) {
+	genesisState, err := genesis.State()
+	if err != nil {
+		return nil, err
+	}
+	chain := &Chain{
+		Genesis: genesis,
+		State:   genesisState,
+		Policy: block.FeePolicy{
+			StakersShare: genesis.Parameters.StakersShare,
+			BurnShare:    genesis.Parameters.BurnShare,
+		},
+		validators: make(map[crypto.Token]struct{}),
+		blocks:     make([][]byte, 0),
+		hashes:     make(map[crypto.Hash]uint64),
+		locations:  make(map[crypto.Hash]InstructionLocation),
+		lastHash:   genesis.Hash(),
+	}
+	for _, validator := range genesis.ValidatorTokens() {
+		chain.validators[validator] = struct{}{}
+	}
+	if dataDir == "" {
+		return chain, nil
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		genesisState.Close()
+		return nil, err
+	}
+	chain.store, err = os.OpenFile(filepath.Join(dataDir, blocksFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		genesisState.Close()
+		return nil, err
+	}
+	if err := chain.replay(); err != nil {
+		chain.Close()
+		return nil, err
+	}
+	return chain, nil
+}
+
+// replay incorporates every block of the store and truncates the store after
+// the last valid block.
+func (c *Chain) replay() error {
+	valid := int64(0)
+	for {
+		data, err := util.ReadFrame(c.store)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		validated, err := c.validate(data)
+		if err != nil {
+			return fmt.Errorf("corrupted block store at epoch %v: %v", c.epoch()+1, err)
+		}
+		c.commit(validated, data)
+		valid += int64(4 + len(data))
+	}
+	if err := c.store.Truncate(valid); err != nil {
+		return err
+	}
+	_, err := c.store.Seek(valid, io.SeekStart)
+	return err
+}
+
+func (c *Chain) epoch() uint64 {
+	return uint64(len(c.blocks))
+}
+
+// Epoch returns the epoch of the last committed block.
+func (c *Chain) Epoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch()
+}
+
+// LastHash returns the hash of the last committed block, or the genesis hash
+// if no block was committed.
+func (c *Chain) LastHash() crypto.Hash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastHash
+}
+
+// IsValidator checks if token can publish blocks. Any token can if the genesis
+// spec defines no validator set.
+func (c *Chain) IsValidator(token crypto.Token) bool {
+	if len(c.validators) == 0 {
+		return true
+	}
+	_, ok := c.validators[token]
+	return ok
+}
+
+// Produce builds, signs, persists and commits the next block with as many of
+// the pending instructions as are valid. It returns the serialized block and
+// the instructions that were rejected, checked again on the state after the
+// block to tell those worth a retry.
+func (c *Chain) Produce(key crypto.PrivateKey, pending []instructions.HashInstruction, publishedAt time.Time) ([]byte, []Rejection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.IsValidator(key.PublicKey()) {
+		return nil, nil, ErrNotAValidator
+	}
+	validator := &block.MutatingState{State: c.State}
+	epoch := c.epoch() + 1
+	produced := block.NewBlock(c.lastHash, epoch-1, epoch, key.PublicKey(), validator)
+	produced.PublishedAt = publishedAt
+	rejected := make([]Rejection, 0)
+	for _, instruction := range pending {
+		if err := produced.TryIncorporate(instruction.Instruction); err != nil {
+			rejected = append(rejected, Rejection{HashInstruction: instruction, Err: err})
+		}
+	}
+	produced.Sign(key)
+	data := produced.Serialize()
+	if err := c.persist(data); err != nil {
+		return nil, rejected, err
+	}
+	c.commit(produced, data)
+	next := block.NewBlock(c.lastHash, epoch, epoch+1, key.PublicKey(), &block.MutatingState{State: c.State})
+	for n := range rejected {
+		rejected[n].Retry = next.TryIncorporate(rejected[n].Instruction) == nil
+	}
+	return data, rejected, nil
+}
+
+// AddBlock validates a block published by another node, persists it and
+// commits it to the state.
+func (c *Chain) AddBlock(data []byte) (*block.Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	validated, err := c.validate(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.persist(data); err != nil {
+		return nil, err
+	}
+	c.commit(validated, data)
+	return validated, nil
+}
+
+// validate rebuilds the block from its instructions on top of the current
+// state. It returns the rebuilt block ready to be committed.
+func (c *Chain) validate(data []byte) (*block.Block, error) {
+	parsed := block.ParseBlock(data)
+	if parsed == nil {
+		return nil, ErrInvalidBlock
+	}
+	if parsed.Epoch() != c.epoch()+1 || parsed.Parent != c.lastHash {
+		return nil, ErrOutOfSequence
+	}
+	if !c.IsValidator(parsed.Publisher) {
+		return nil, ErrNotAValidator
+	}
+	validator := &block.MutatingState{State: c.State}
+	validated := block.NewBlock(parsed.Parent, parsed.CheckPoint, parsed.Epoch(), parsed.Publisher, validator)
+	validated.PublishedAt = parsed.PublishedAt
+	for _, bytes := range parsed.Instructions {
+		if len(bytes) < 2 {
+			return nil, ErrInvalidBlock
+		}
+		instruction := instructions.ParseInstruction(bytes)
+		if instruction == nil || !validated.Incorporate(instruction) {
+			return nil, ErrInvalidBlock
+		}
+	}
+	if validated.FeesCollected != parsed.FeesCollected {
+		return nil, ErrWrongFeeBalance
+	}
+	validated.Signature = parsed.Signature
+	return validated, nil
+}
+
+func (c *Chain) persist(data []byte) error {
+	if c.store == nil {
+		return nil
+	}
+	return util.WriteFrame(c.store, data)
+}
+
+func (c *Chain) commit(validated *block.Block, data []byte) {
+	validated.Commit(c.Policy)
+	hash := crypto.Hasher(data)
+	c.blocks = append(c.blocks, data)
+	c.hashes[hash] = validated.Epoch()
+	c.lastHash = hash
+	for index, instruction := range validated.Instructions {
+		location := InstructionLocation{Epoch: validated.Epoch(), BlockHash: hash, Index: index}
+		c.locations[crypto.Hasher(instruction)] = location
+	}
+}
+
+// Block returns the serialized block of the epoch.
+func (c *Chain) Block(epoch uint64) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch == 0 || epoch > c.epoch() {
+		return nil, ErrUnknownBlock
+	}
+	return c.blocks[epoch-1], nil
+}
+
+// BlockByHash returns the serialized block with the hash.
+func (c *Chain) BlockByHash(hash crypto.Hash) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	epoch, ok := c.hashes[hash]
+	if !ok {
+		return nil, ErrUnknownBlock
+	}
+	return c.blocks[epoch-1], nil
+}
+
+// Instruction returns the serialized instruction with the hash and its
+// location on the chain.
+func (c *Chain) Instruction(hash crypto.Hash) ([]byte, *InstructionLocation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	location, ok := c.locations[hash]
+	if !ok {
+		return nil, nil, ErrUnknownInstruction
+	}
+	parsed := block.ParseBlock(c.blocks[location.Epoch-1])
+	if parsed == nil || location.Index >= len(parsed.Instructions) {
+		return nil, nil, ErrUnknownInstruction
+	}
+	return parsed.Instructions[location.Index], &location, nil
+}
+
+// Location returns the position on the chain of the instruction with the hash.
+func (c *Chain) Location(hash crypto.Hash) (*InstructionLocation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	location, ok := c.locations[hash]
+	if !ok {
+		return nil, false
+	}
+	return &location, true
+}
+
+// Balance returns the wallet balance, the bonded deposit and the value still
+// unbonding of the token.
+func (c *Chain) Balance(token crypto.Token) (uint64, uint64, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, balance := c.State.Wallets.Balance(token)
+	return balance, c.State.Staked(token), c.State.UnbondingValue(token)
+}
+
+// HasMember checks if the token is a member of the network.
+func (c *Chain) HasMember(token crypto.Token) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.State.Members.ExistsToken(token)
+}
+
+// StageKeys returns the keys of the stage, or nil if it does not exist.
+func (c *Chain) StageKeys(stage crypto.Token) *instructions.StageKeys {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.State.Stages.GetKeys(crypto.HashToken(stage))
+}
+
+// Close closes the block store and every store of the state.
+func (c *Chain) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	if c.store != nil {
+		err = c.store.Close()
+	}
+	if !c.State.Close() && err == nil {
+		err = errors.New("could not close state stores")
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+)
+
+// Config is the configuration of an aereum node. It can be read from a JSON
+// file and overridden by command line flags.
+type Config struct {
+	Genesis      string   `json:"genesis"`      // path to genesis spec file
+	DataDir      string   `json:"dataDir"`      // directory of the block store
+	Listen       string   `json:"listen"`       // address of the p2p listener
+	Peers        []string `json:"peers"`        // addresses of p2p peers to dial
+	PublisherKey string   `json:"publisherKey"` // path to hex private key file
+	API          string   `json:"api"`          // address of the local api
+	Index        bool     `json:"index"`        // maintain instruction history indexes
+}
+
+// LoadConfig reads a JSON config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ReadPrivateKey reads a hex encoded private key from a file.
+func ReadPrivateKey(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return crypto.ZeroPrivateKey, err
+	}
+	bytes, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return crypto.ZeroPrivateKey, err
+	}
+	if len(bytes) != crypto.PrivateKeySize {
+		return crypto.ZeroPrivateKey, errors.New("invalid private key size")
+	}
+	var key crypto.PrivateKey
+	copy(key[:], bytes)
+	return key, nil
+}
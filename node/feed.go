@@ -0,0 +1,170 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+// DefaultFeedCapacity is the number of committed instructions kept by the feed.
+const DefaultFeedCapacity = 1 << 16
+
+type feedEntry struct {
+	hash      crypto.Hash
+	data      []byte
+	tokens    []crypto.Token
+	published uint64 // epoch an embargoed content is released to the feed
+}
+
+// Feed keeps the most recent committed instructions in sequence so that
+// subscribers can follow the instructions touching their tokens. Sequence
+// numbers start at one and increase with every instruction appended.
+type Feed struct {
+	mu       sync.Mutex
+	entries  []feedEntry
+	embargo  []feedEntry // embargoed contents in order of commitment
+	offset   uint64      // sequence number of entries[0] minus one
+	capacity int
+	notify   chan struct{}
+}
+
+func NewFeed(capacity int) *Feed {
+	if capacity <= 0 {
+		capacity = DefaultFeedCapacity
+	}
+	return &Feed{
+		entries:  make([]feedEntry, 0),
+		embargo:  make([]feedEntry, 0),
+		capacity: capacity,
+		notify:   make(chan struct{}),
+	}
+}
+
+// Append adds serialized instructions committed at epoch to the feed and
+// wakes up every waiting subscriber. Content embargoed at epoch is held back
+// and appended at the first epoch it is published. Content hidden by a
+// takedown is no longer delivered, while the takedown is delivered to the
+// subscribers of the stage.
+func (f *Feed) Append(epoch uint64, data ...[]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.release(epoch)
+	for _, bytes := range data {
+		instruction := instructions.ParseInstruction(bytes)
+		if instruction == nil {
+			continue
+		}
+		if takedown, ok := instruction.(*instructions.Takedown); ok && takedown.Hide {
+			f.hide(takedown.Content)
+		}
+		entry := feedEntry{hash: crypto.Hasher(bytes), data: bytes, tokens: TouchedTokens(instruction)}
+		if content, ok := instruction.(*instructions.Content); ok && content.Embargoed(epoch) {
+			entry.published = content.Published
+			f.embargo = append(f.embargo, entry)
+			continue
+		}
+		f.entries = append(f.entries, entry)
+	}
+	if excess := len(f.entries) - f.capacity; excess > 0 {
+		f.entries = f.entries[excess:]
+		f.offset += uint64(excess)
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// release appends the embargoed contents published at epoch.
+func (f *Feed) release(epoch uint64) {
+	held := make([]feedEntry, 0, len(f.embargo))
+	for _, entry := range f.embargo {
+		if entry.published <= epoch {
+			f.entries = append(f.entries, entry)
+		} else {
+			held = append(held, entry)
+		}
+	}
+	f.embargo = held
+}
+
+func (f *Feed) hide(hash crypto.Hash) {
+	for n := range f.entries {
+		if f.entries[n].hash == hash {
+			f.entries[n].tokens = nil
+		}
+	}
+	for n := range f.embargo {
+		if f.embargo[n].hash == hash {
+			f.embargo[n].tokens = nil
+		}
+	}
+}
+
+// Head returns the sequence number of the last appended instruction.
+func (f *Feed) Head() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.offset + uint64(len(f.entries))
+}
+
+// Since returns the instructions after sequence number since that touch any
+// of the tokens, the sequence number to ask next, and a channel closed when
+// new instructions are appended.
+func (f *Feed) Since(since uint64, tokens map[crypto.Token]struct{}) ([][]byte, uint64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found := make([][]byte, 0)
+	start := 0
+	if since > f.offset {
+		start = int(since - f.offset)
+	}
+	for n := start; n < len(f.entries); n++ {
+		for _, token := range f.entries[n].tokens {
+			if _, ok := tokens[token]; ok {
+				found = append(found, f.entries[n].data)
+				break
+			}
+		}
+	}
+	return found, f.offset + uint64(len(f.entries)), f.notify
+}
+
+// TouchedTokens returns the tokens an instruction concerns: its author and
+// attorney, the stage it is addressed to, and the wallets it pays or debits.
+func TouchedTokens(instruction instructions.Instruction) []crypto.Token {
+	tokens := make([]crypto.Token, 0)
+	switch v := instruction.(type) {
+	case *instructions.Transfer:
+		tokens = append(tokens, v.From)
+		for _, to := range v.To {
+			tokens = append(tokens, to.Token)
+		}
+	case *instructions.Deposit:
+		tokens = append(tokens, v.Token)
+	case *instructions.Withdraw:
+		tokens = append(tokens, v.Token)
+	case *instructions.Content:
+		tokens = append(tokens, v.Author, v.Stage, v.Moderator, v.Attorney, v.Wallet)
+	case *instructions.React:
+		tokens = append(tokens, v.Author, v.Attorney, v.Wallet)
+	case *instructions.CreateStage:
+		tokens = append(tokens, v.Author, v.Stage, v.Attorney, v.Wallet)
+	case *instructions.JoinStage:
+		tokens = append(tokens, v.Author, v.Stage, v.Attorney, v.Wallet)
+	case *instructions.AcceptJoinRequest:
+		tokens = append(tokens, v.Author, v.Stage, v.Member, v.Attorney, v.Wallet)
+	case *instructions.UpdateStage:
+		tokens = append(tokens, v.Author, v.Stage, v.Attorney, v.Wallet)
+	case *instructions.Takedown:
+		tokens = append(tokens, v.Moderator, v.Stage, v.Wallet)
+	default:
+		tokens = append(tokens, instruction.Authority())
+	}
+	touched := make([]crypto.Token, 0, len(tokens))
+	for _, token := range tokens {
+		if token != crypto.ZeroToken {
+			touched = append(touched, token)
+		}
+	}
+	return touched
+}
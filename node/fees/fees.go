@@ -0,0 +1,138 @@
+// Package fees implements the node-side fee market. It keeps a base fee per
+// byte of serialized instruction that adjusts every epoch in the spirit of
+// EIP-1559, and suggests fees to clients taking into account recent blocks
+// and the pressure of the mempool.
+//
+// The base fee is advisory only. Consensus enforces nothing but
+// instructions.MinimumFeePerByte, and instructions paying less than the base
+// fee remain valid. A market is local to a node, which rebuilds it from the
+// blocks of its chain when it starts.
+package fees
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+const (
+	// BaseFeeChangeDenominator bounds the change of the base fee between two
+	// consecutive epochs to 1/8 of its value.
+	BaseFeeChangeDenominator = 8
+	// DefaultTargetBlockSize is the block size in bytes the base fee steers to.
+	DefaultTargetBlockSize = 1 << 20
+	// recentBlocks is the number of blocks used to estimate the effective fee.
+	recentBlocks = 20
+)
+
+// Market estimates fees per byte of serialized instruction. It is safe for
+// concurrent use.
+type Market struct {
+	mu              sync.Mutex
+	baseFee         uint64
+	targetBlockSize uint64
+	pendingBytes    uint64
+	recent          []uint64 // effective fee per byte of recent blocks
+}
+
+// NewMarket returns a market steering blocks to targetBlockSize bytes. The base
+// fee starts at the protocol minimum.
+func NewMarket(targetBlockSize int) *Market {
+	if targetBlockSize <= 0 {
+		targetBlockSize = DefaultTargetBlockSize
+	}
+	return &Market{
+		baseFee:         instructions.MinimumFeePerByte,
+		targetBlockSize: uint64(targetBlockSize),
+		recent:          make([]uint64, 0, recentBlocks),
+	}
+}
+
+// ObserveBlock feeds the market with a new block with size bytes of
+// instructions and fees collected. It must be called once per epoch.
+func (m *Market) ObserveBlock(size int, fees uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	used := uint64(size)
+	if used > m.targetBlockSize {
+		delta := m.baseFee * (used - m.targetBlockSize) / m.targetBlockSize / BaseFeeChangeDenominator
+		if delta == 0 {
+			delta = 1
+		}
+		m.baseFee += delta
+	} else if used < m.targetBlockSize {
+		delta := m.baseFee * (m.targetBlockSize - used) / m.targetBlockSize / BaseFeeChangeDenominator
+		if delta == 0 {
+			delta = 1
+		}
+		if delta > m.baseFee || m.baseFee-delta < instructions.MinimumFeePerByte {
+			m.baseFee = instructions.MinimumFeePerByte
+		} else {
+			m.baseFee -= delta
+		}
+	}
+	if size > 0 {
+		if len(m.recent) == recentBlocks {
+			m.recent = m.recent[1:]
+		}
+		m.recent = append(m.recent, fees/used)
+	}
+}
+
+// ObserveMempool informs the market of the number of bytes of instructions
+// waiting in the mempool.
+func (m *Market) ObserveMempool(pendingBytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pendingBytes < 0 {
+		pendingBytes = 0
+	}
+	m.pendingBytes = uint64(pendingBytes)
+}
+
+// BaseFee returns the current base fee per byte.
+func (m *Market) BaseFee() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.baseFee
+}
+
+// CurrentFee returns the suggested fee per byte of serialized instruction. It
+// is the larger of the base fee and the median effective fee of recent blocks,
+// increased proportionally when the mempool holds more than a target block.
+func (m *Market) CurrentFee() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fee := m.baseFee
+	if median := m.median(); median > fee {
+		fee = median
+	}
+	if m.pendingBytes > m.targetBlockSize {
+		pressure := (m.pendingBytes - m.targetBlockSize) / m.targetBlockSize
+		if pressure > BaseFeeChangeDenominator {
+			pressure = BaseFeeChangeDenominator
+		}
+		fee += fee * pressure / BaseFeeChangeDenominator
+	}
+	if fee < instructions.MinimumFeePerByte {
+		fee = instructions.MinimumFeePerByte
+	}
+	return fee
+}
+
+// Estimate returns the suggested fee of an instruction serialized into size
+// bytes.
+func (m *Market) Estimate(size int) uint64 {
+	return m.CurrentFee() * uint64(size)
+}
+
+func (m *Market) median() uint64 {
+	if len(m.recent) == 0 {
+		return 0
+	}
+	sorted := make([]uint64, len(m.recent))
+	copy(sorted, m.recent)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,33 @@
+package fees
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+func TestBaseFeeAdjustment(t *testing.T) {
+	market := NewMarket(1000)
+	market.ObserveBlock(2000, 2000)
+	if market.BaseFee() <= instructions.MinimumFeePerByte {
+		t.Error("base fee should rise above target block size")
+	}
+	for n := 0; n < 100; n++ {
+		market.ObserveBlock(0, 0)
+	}
+	if market.BaseFee() != instructions.MinimumFeePerByte {
+		t.Errorf("base fee should fall back to the protocol minimum, got %v", market.BaseFee())
+	}
+}
+
+func TestMempoolPressure(t *testing.T) {
+	market := NewMarket(1000)
+	idle := market.CurrentFee()
+	market.ObserveMempool(10000)
+	if market.CurrentFee() <= idle {
+		t.Error("current fee should rise with mempool pressure")
+	}
+	if market.Estimate(100) != 100*market.CurrentFee() {
+		t.Error("estimate is not proportional to instruction size")
+	}
+}
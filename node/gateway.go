@@ -0,0 +1,111 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/block"
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/node/fees"
+)
+
+// LocalGateway implements edge.Gateway over a chain in the same process.
+// Published instructions wait until Produce builds the next block, which
+// makes it handy to drive edge clients in tests without a network.
+type LocalGateway struct {
+	mu        sync.Mutex
+	Chain     *Chain
+	Fees      *fees.Market
+	Receipts  *Receipts
+	publisher crypto.PrivateKey
+	wallets   map[crypto.Token]crypto.PrivateKey
+	pending   []instructions.HashInstruction
+}
+
+// NewLocalGateway returns a gateway producing blocks on chain signed by
+// publisher. The fee market is fed with the blocks already on the chain.
+func NewLocalGateway(chain *Chain, publisher crypto.PrivateKey) *LocalGateway {
+	gateway := &LocalGateway{
+		Chain:     chain,
+		Fees:      fees.NewMarket(chain.Genesis.Parameters.TargetBlockSize),
+		Receipts:  NewReceipts(DefaultReceiptExpiry),
+		publisher: publisher,
+		wallets:   make(map[crypto.Token]crypto.PrivateKey),
+		pending:   make([]instructions.HashInstruction, 0),
+	}
+	forEachBlock(chain, func(parsed *block.Block) { observeBlock(gateway.Fees, parsed) })
+	return gateway
+}
+
+// AddWallet makes the key available to PublishOnWallet.
+func (g *LocalGateway) AddWallet(key crypto.PrivateKey) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.wallets[key.PublicKey()] = key
+}
+
+func (g *LocalGateway) Publish(instruction instructions.Instruction) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	hash := crypto.Hasher(instruction.Serialize())
+	g.pending = append(g.pending, instructions.HashInstruction{Instruction: instruction, Hash: hash})
+	g.Receipts.Pending(hash, g.Chain.Epoch())
+}
+
+// PublishOnWallet appends a fee paid by the wallet at the current fee and
+// publishes the instruction. Instructions whose wallet is unknown or that
+// cannot be paid by a wallet are dropped.
+func (g *LocalGateway) PublishOnWallet(instruction instructions.Instruction, wallet crypto.Token) {
+	g.mu.Lock()
+	key, ok := g.wallets[wallet]
+	g.mu.Unlock()
+	if !ok || !instructions.AppendWalletFee(instruction, key, g.CurrentFee()) {
+		return
+	}
+	g.Publish(instruction)
+}
+
+func (g *LocalGateway) CurrentFee() uint64 {
+	return g.Fees.CurrentFee()
+}
+
+// Produce commits a block with every instruction published since the last
+// call. It returns the serialized block and the rejected instructions. The
+// outcome of every instruction is recorded on the receipts of the gateway, and
+// rejected instructions worth a retry wait for the next call.
+func (g *LocalGateway) Produce() ([]byte, []Rejection, error) {
+	g.mu.Lock()
+	pending := g.pending
+	g.pending = make([]instructions.HashInstruction, 0)
+	g.mu.Unlock()
+	data, rejected, err := g.Chain.Produce(g.publisher, pending, time.Now())
+	if err != nil {
+		return nil, rejected, err
+	}
+	if parsed := block.ParseBlock(data); parsed != nil {
+		hash := crypto.Hasher(data)
+		locations := make(map[crypto.Hash]InstructionLocation)
+		for index, instruction := range parsed.Instructions {
+			locations[crypto.Hasher(instruction)] = InstructionLocation{Epoch: parsed.Epoch(), BlockHash: hash, Index: index}
+		}
+		observeBlock(g.Fees, parsed)
+		retry := make([]instructions.HashInstruction, 0)
+		for _, rejection := range rejected {
+			if rejection.Retry {
+				retry = append(retry, rejection.HashInstruction)
+			} else {
+				g.Receipts.Reject(rejection.Hash, parsed.Epoch(), rejection.Err)
+			}
+		}
+		g.mu.Lock()
+		g.pending = append(retry, g.pending...)
+		g.mu.Unlock()
+		g.Receipts.Include(locations)
+	}
+	return data, rejected, nil
+}
+
+func (g *LocalGateway) Close() {
+	g.Chain.Close()
+}
@@ -0,0 +1,49 @@
+package node
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/state"
+)
+
+func TestLocalGatewayRebuildsFeeMarket(t *testing.T) {
+	publisher, key := crypto.RandomAsymetricKey()
+	paying, payingKey := crypto.RandomAsymetricKey()
+	genesis := &state.GenesisSpec{
+		Network:    "test",
+		Validators: []string{hex.EncodeToString(publisher[:])},
+		Balances:   []state.GenesisBalance{{Token: hex.EncodeToString(paying[:]), Value: 1 << 30}},
+		Parameters: state.GenesisParameters{TargetBlockSize: 64},
+	}
+	dir := t.TempDir()
+	chain, err := OpenChain(genesis, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := NewLocalGateway(chain, key)
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		transfer := instructions.Transfer{EpochStamp: epoch, From: paying, To: []crypto.TokenValue{{Token: publisher, Value: epoch}}, Fee: 1000}
+		transfer.Sign(payingKey)
+		gateway.Publish(&transfer)
+		if _, rejected, err := gateway.Produce(); err != nil || len(rejected) > 0 {
+			t.Fatalf("could not produce block: %v %v", err, rejected)
+		}
+	}
+	baseFee := gateway.Fees.BaseFee()
+	if baseFee <= instructions.MinimumFeePerByte {
+		t.Fatal("base fee did not rise above the target block size")
+	}
+	gateway.Close()
+
+	if chain, err = OpenChain(genesis, dir); err != nil {
+		t.Fatal(err)
+	}
+	reopened := NewLocalGateway(chain, key)
+	defer reopened.Close()
+	if reopened.Fees.BaseFee() != baseFee {
+		t.Errorf("base fee %v after reopening the chain, expected %v", reopened.Fees.BaseFee(), baseFee)
+	}
+}
@@ -0,0 +1,428 @@
+// Package index maintains secondary indexes of committed instructions so that
+// the history of an author, a stage or a wallet can be listed. The indexes are
+// kept in memory and rebuilt from the chain store when the node starts.
+package index
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/block"
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+// MaxPageSize bounds the number of entries returned by a query.
+const MaxPageSize = 500
+
+// DefaultPageSize is used when a query does not ask for a page size.
+const DefaultPageSize = 50
+
+var (
+	ErrInvalidBlock  = errors.New("could not parse block")
+	ErrMissingBlocks = errors.New("block out of sequence for the indexer")
+)
+
+// Entry locates an indexed instruction on the chain. Content is listed from
+// its Published epoch on, which is later than Epoch for embargoed content.
+// Content taken down by a moderator of its stage is Flagged with the Reason of
+// the takedown, and is no longer listed if Hidden.
+type Entry struct {
+	Hash      crypto.Hash
+	Kind      byte
+	Epoch     uint64
+	Published uint64
+	Index     int
+	Flagged   bool
+	Hidden    bool
+	Reason    byte
+}
+
+// Embargoed checks if the entry is not yet visible at epoch.
+func (e Entry) Embargoed(epoch uint64) bool {
+	return epoch < e.Published
+}
+
+// Page is a slice of the entries of an index together with the total number
+// of entries of the index.
+type Page struct {
+	Entries []Entry
+	Total   int
+}
+
+// BlockSource gives access to the committed blocks. It is implemented by the
+// chain of a node.
+type BlockSource interface {
+	Epoch() uint64
+	Block(epoch uint64) ([]byte, error)
+}
+
+// Indexer consumes committed blocks in sequence. Every index lists positions
+// on entries in order of commitment.
+type Indexer struct {
+	mu       sync.RWMutex
+	epoch    uint64
+	entries  []Entry
+	authors  map[crypto.Token][]int
+	stages   map[crypto.Token][]int
+	wallets  map[crypto.Token][]int
+	kinds    map[byte][]int
+	contents map[crypto.Hash]int          // content hash to position on entries
+	reacts   map[crypto.Hash]map[byte]int // content hash to tally by reaction
+	reacted  map[crypto.Hash]byte         // hash of author and content to reaction
+	roots    map[crypto.Hash]crypto.Hash  // content hash to hash of thread root
+	threads  map[crypto.Hash][]int        // root hash to contents of the thread
+	replies  map[crypto.Hash][]int        // content hash to direct replies
+}
+
+func NewIndexer() *Indexer {
+	indexer := &Indexer{}
+	indexer.reset()
+	return indexer
+}
+
+func (i *Indexer) reset() {
+	i.epoch = 0
+	i.entries = make([]Entry, 0)
+	i.authors = make(map[crypto.Token][]int)
+	i.stages = make(map[crypto.Token][]int)
+	i.wallets = make(map[crypto.Token][]int)
+	i.kinds = make(map[byte][]int)
+	i.contents = make(map[crypto.Hash]int)
+	i.reacts = make(map[crypto.Hash]map[byte]int)
+	i.reacted = make(map[crypto.Hash]byte)
+	i.roots = make(map[crypto.Hash]crypto.Hash)
+	i.threads = make(map[crypto.Hash][]int)
+	i.replies = make(map[crypto.Hash][]int)
+}
+
+// Rebuild discards the indexes and indexes every block of the source.
+func (i *Indexer) Rebuild(source BlockSource) error {
+	i.mu.Lock()
+	i.reset()
+	i.mu.Unlock()
+	last := source.Epoch()
+	for epoch := uint64(1); epoch <= last; epoch++ {
+		data, err := source.Block(epoch)
+		if err != nil {
+			return err
+		}
+		if err := i.AddBlock(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Epoch returns the epoch of the last indexed block.
+func (i *Indexer) Epoch() uint64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.epoch
+}
+
+// AddBlock indexes the instructions of a committed block. Blocks already
+// indexed are ignored and blocks must be added in sequence.
+func (i *Indexer) AddBlock(data []byte) error {
+	epoch := block.GetBlockEpoch(data)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if epoch <= i.epoch {
+		return nil
+	}
+	if epoch != i.epoch+1 {
+		return ErrMissingBlocks
+	}
+	parsed := block.ParseBlock(data)
+	if parsed == nil {
+		return ErrInvalidBlock
+	}
+	for n, bytes := range parsed.Instructions {
+		if len(bytes) < 2 {
+			continue
+		}
+		instruction := instructions.ParseInstruction(bytes)
+		if instruction == nil {
+			continue
+		}
+		entry := Entry{Hash: crypto.Hasher(bytes), Kind: instruction.Kind(), Epoch: epoch, Published: epoch, Index: n}
+		if content, ok := instruction.(*instructions.Content); ok && content.Embargoed(epoch) {
+			entry.Published = content.Published
+		}
+		i.index(entry, instruction)
+	}
+	i.epoch = epoch
+	return nil
+}
+
+func appendUnique(list []crypto.Token, tokens ...crypto.Token) []crypto.Token {
+	for _, token := range tokens {
+		if token == crypto.ZeroToken {
+			continue
+		}
+		found := false
+		for _, existing := range list {
+			if existing == token {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, token)
+		}
+	}
+	return list
+}
+
+func (i *Indexer) index(entry Entry, instruction instructions.Instruction) {
+	position := len(i.entries)
+	i.entries = append(i.entries, entry)
+	i.kinds[entry.Kind] = append(i.kinds[entry.Kind], position)
+	authors := make([]crypto.Token, 0)
+	stages := make([]crypto.Token, 0)
+	wallets := make([]crypto.Token, 0)
+	switch v := instruction.(type) {
+	case *instructions.Transfer:
+		wallets = appendUnique(wallets, v.From)
+		for _, to := range v.To {
+			wallets = appendUnique(wallets, to.Token)
+		}
+	case *instructions.Deposit:
+		wallets = appendUnique(wallets, v.Token)
+	case *instructions.Withdraw:
+		wallets = appendUnique(wallets, v.Token)
+	case *instructions.Content:
+		authors = appendUnique(authors, v.Author)
+		stages = appendUnique(stages, v.Stage)
+		wallets = appendUnique(wallets, v.Wallet, v.Attorney)
+		i.contents[entry.Hash] = position
+		i.thread(entry.Hash, v, position)
+	case *instructions.React:
+		authors = appendUnique(authors, v.Author)
+		wallets = appendUnique(wallets, v.Wallet, v.Attorney)
+		if len(v.Hash) == crypto.Size {
+			i.react(v.Author, crypto.BytesToHash(v.Hash), v.Reaction)
+		}
+	case *instructions.Takedown:
+		authors = appendUnique(authors, v.Moderator)
+		stages = appendUnique(stages, v.Stage)
+		wallets = appendUnique(wallets, v.Wallet)
+		i.takedown(v)
+	case *instructions.CreateStage:
+		authors = appendUnique(authors, v.Author)
+		stages = appendUnique(stages, v.Stage)
+		wallets = appendUnique(wallets, v.Wallet, v.Attorney)
+	case *instructions.JoinStage:
+		authors = appendUnique(authors, v.Author)
+		stages = appendUnique(stages, v.Stage)
+		wallets = appendUnique(wallets, v.Wallet, v.Attorney)
+	case *instructions.AcceptJoinRequest:
+		authors = appendUnique(authors, v.Author)
+		stages = appendUnique(stages, v.Stage)
+		wallets = appendUnique(wallets, v.Wallet, v.Attorney)
+	case *instructions.UpdateStage:
+		authors = appendUnique(authors, v.Author)
+		stages = appendUnique(stages, v.Stage)
+		wallets = appendUnique(wallets, v.Wallet, v.Attorney)
+	default:
+		authors = appendUnique(authors, instruction.Authority())
+	}
+	for _, token := range authors {
+		i.authors[token] = append(i.authors[token], position)
+	}
+	for _, token := range stages {
+		i.stages[token] = append(i.stages[token], position)
+	}
+	for _, token := range wallets {
+		i.wallets[token] = append(i.wallets[token], position)
+	}
+}
+
+// react tallies the reaction of the author to the content. An author has a
+// single reaction to each content: a later one replaces the earlier one. This
+// is a convention of the index, the chain keeps every reaction.
+func (i *Indexer) react(author crypto.Token, content crypto.Hash, reaction byte) {
+	key := crypto.Hasher(append(author[:], content[:]...))
+	tally, ok := i.reacts[content]
+	if !ok {
+		tally = make(map[byte]int)
+		i.reacts[content] = tally
+	}
+	if previous, ok := i.reacted[key]; ok {
+		if tally[previous] -= 1; tally[previous] == 0 {
+			delete(tally, previous)
+		}
+	}
+	i.reacted[key] = reaction
+	tally[reaction] += 1
+}
+
+// thread appends the content to the thread of the content it replies to, or
+// starts a new thread.
+func (i *Indexer) thread(hash crypto.Hash, content *instructions.Content, position int) {
+	root := hash
+	if content.IsReply() {
+		root = content.Reply
+		if parentRoot, ok := i.roots[content.Reply]; ok {
+			root = parentRoot
+		}
+		i.replies[content.Reply] = append(i.replies[content.Reply], position)
+	}
+	i.roots[hash] = root
+	i.threads[root] = append(i.threads[root], position)
+}
+
+// takedown flags the content, and hides it if asked to. A content once hidden
+// stays hidden.
+func (i *Indexer) takedown(takedown *instructions.Takedown) {
+	position, ok := i.contents[takedown.Content]
+	if !ok {
+		return
+	}
+	entry := &i.entries[position]
+	entry.Flagged = true
+	entry.Hidden = entry.Hidden || takedown.Hide
+	entry.Reason = takedown.Reason
+}
+
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+// visible returns the positions whose entries are neither hidden nor
+// embargoed at the epoch of the last indexed block.
+func (i *Indexer) visible(positions []int) []int {
+	visible := make([]int, 0, len(positions))
+	for _, position := range positions {
+		if entry := i.entries[position]; !entry.Hidden && !entry.Embargoed(i.epoch) {
+			visible = append(visible, position)
+		}
+	}
+	return visible
+}
+
+// page returns entries of the visible positions starting at offset, newest
+// first.
+func (i *Indexer) page(positions []int, offset, limit int) Page {
+	limit = pageLimit(limit)
+	positions = i.visible(positions)
+	page := Page{Entries: make([]Entry, 0), Total: len(positions)}
+	for n := len(positions) - 1 - offset; n >= 0 && len(page.Entries) < limit; n-- {
+		page.Entries = append(page.Entries, i.entries[positions[n]])
+	}
+	return page
+}
+
+// ByAuthor lists the instructions authored by the token, newest first.
+func (i *Indexer) ByAuthor(token crypto.Token, offset, limit int) Page {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.page(i.authors[token], offset, limit)
+}
+
+// ByStage lists the instructions addressed to the stage, newest first.
+func (i *Indexer) ByStage(stage crypto.Token, offset, limit int) Page {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.page(i.stages[stage], offset, limit)
+}
+
+// ByWallet lists the instructions paying, paid by or signed as attorney by the
+// token, newest first.
+func (i *Indexer) ByWallet(token crypto.Token, offset, limit int) Page {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.page(i.wallets[token], offset, limit)
+}
+
+// ByKind lists the instructions of the kind, newest first.
+func (i *Indexer) ByKind(kind byte, offset, limit int) Page {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.page(i.kinds[kind], offset, limit)
+}
+
+// Queue lists the contents of the stage still embargoed and not hidden,
+// oldest first, for the moderators of the stage to review before they are
+// published.
+func (i *Indexer) Queue(stage crypto.Token, offset, limit int) Page {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	limit = pageLimit(limit)
+	queued := make([]int, 0)
+	for _, position := range i.stages[stage] {
+		entry := i.entries[position]
+		if entry.Kind == instructions.IContent && !entry.Hidden && entry.Embargoed(i.epoch) {
+			queued = append(queued, position)
+		}
+	}
+	page := Page{Entries: make([]Entry, 0), Total: len(queued)}
+	for n := offset; n < len(queued) && len(page.Entries) < limit; n++ {
+		page.Entries = append(page.Entries, i.entries[queued[n]])
+	}
+	return page
+}
+
+// Content returns the entry of the content instruction with the hash.
+func (i *Indexer) Content(hash crypto.Hash) (Entry, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	position, ok := i.contents[hash]
+	if !ok {
+		return Entry{}, false
+	}
+	return i.entries[position], true
+}
+
+// Reactions returns the number of authors reacting to the content with the
+// hash by reaction code.
+func (i *Indexer) Reactions(content crypto.Hash) map[byte]int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	tally := make(map[byte]int)
+	for reaction, count := range i.reacts[content] {
+		tally[reaction] = count
+	}
+	return tally
+}
+
+// Reaction returns the current reaction of the author to the content.
+func (i *Indexer) Reaction(author crypto.Token, content crypto.Hash) (byte, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	reaction, ok := i.reacted[crypto.Hasher(append(author[:], content[:]...))]
+	return reaction, ok
+}
+
+// Replies lists the direct replies to the content with the hash, newest first.
+func (i *Indexer) Replies(content crypto.Hash, offset, limit int) Page {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.page(i.replies[content], offset, limit)
+}
+
+// Thread returns the hash of the root content of the thread the content
+// belongs to and lists the contents of the thread in order of publication,
+// starting with the root. Hidden and embargoed contents are left out of the
+// thread.
+func (i *Indexer) Thread(content crypto.Hash, offset, limit int) (crypto.Hash, Page) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	root, ok := i.roots[content]
+	if !ok {
+		return crypto.Hash{}, Page{Entries: make([]Entry, 0)}
+	}
+	limit = pageLimit(limit)
+	positions := i.visible(i.threads[root])
+	page := Page{Entries: make([]Entry, 0), Total: len(positions)}
+	for n := offset; n < len(positions) && len(page.Entries) < limit; n++ {
+		page.Entries = append(page.Entries, i.entries[positions[n]])
+	}
+	return root, page
+}
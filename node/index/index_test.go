@@ -0,0 +1,219 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/block"
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+type blocks [][]byte
+
+func (b blocks) Epoch() uint64 {
+	return uint64(len(b))
+}
+
+func (b blocks) Block(epoch uint64) ([]byte, error) {
+	return b[epoch-1], nil
+}
+
+func newBlock(epoch uint64, publisher crypto.PrivateKey, data ...[]byte) []byte {
+	produced := block.NewBlock(crypto.ZeroHash, epoch-1, epoch, publisher.PublicKey(), nil)
+	produced.PublishedAt = time.Unix(int64(epoch), 0)
+	produced.Instructions = data
+	produced.Sign(publisher)
+	return produced.Serialize()
+}
+
+func TestIndexer(t *testing.T) {
+	_, publisher := crypto.RandomAsymetricKey()
+	from, fromKey := crypto.RandomAsymetricKey()
+	to, _ := crypto.RandomAsymetricKey()
+	transfers := make([][]byte, 0)
+	for n := 0; n < 3; n++ {
+		transfer := instructions.Transfer{
+			EpochStamp: uint64(n + 1),
+			From:       from,
+			To:         []crypto.TokenValue{{Token: to, Value: 10}},
+			Fee:        1000,
+		}
+		transfer.Sign(fromKey)
+		transfers = append(transfers, transfer.Serialize())
+	}
+	depositor, depositorKey := crypto.RandomAsymetricKey()
+	deposit := instructions.Deposit{EpochStamp: 2, Token: depositor, Value: 5, Fee: 1000}
+	deposit.Sign(depositorKey)
+	chain := blocks{
+		newBlock(1, publisher, transfers[0]),
+		newBlock(2, publisher, transfers[1], deposit.Serialize()),
+		newBlock(3, publisher, transfers[2]),
+	}
+
+	indexer := NewIndexer()
+	if err := indexer.Rebuild(chain); err != nil {
+		t.Fatal(err)
+	}
+	if indexer.Epoch() != 3 {
+		t.Fatalf("indexed up to epoch %v", indexer.Epoch())
+	}
+	page := indexer.ByWallet(from, 1, 1)
+	if page.Total != 3 || len(page.Entries) != 1 {
+		t.Fatalf("wrong page %+v", page)
+	}
+	if page.Entries[0].Hash != crypto.Hasher(transfers[1]) || page.Entries[0].Epoch != 2 {
+		t.Error("page not ordered newest first")
+	}
+	if kinds := indexer.ByKind(instructions.IDeposit, 0, 0); kinds.Total != 1 || kinds.Entries[0].Index != 1 {
+		t.Errorf("wrong deposit index %+v", kinds)
+	}
+	if err := indexer.AddBlock(newBlock(5, publisher)); err != ErrMissingBlocks {
+		t.Error("indexer accepted block out of sequence")
+	}
+}
+
+func TestIndexerReactions(t *testing.T) {
+	_, publisher := crypto.RandomAsymetricKey()
+	author, authorKey := crypto.RandomAsymetricKey()
+	_, otherKey := crypto.RandomAsymetricKey()
+	content := crypto.Hasher([]byte("content"))
+	react := func(key crypto.PrivateKey, reaction byte) []byte {
+		instruction := instructions.React{EpochStamp: 1, Author: key.PublicKey(), Hash: content[:], Reaction: reaction}
+		instruction.Sign(key)
+		instruction.AppendFee(key, 1000)
+		return instruction.Serialize()
+	}
+	indexer := NewIndexer()
+	indexer.AddBlock(newBlock(1, publisher, react(authorKey, 1), react(otherKey, 1)))
+	indexer.AddBlock(newBlock(2, publisher, react(authorKey, 2)))
+
+	tally := indexer.Reactions(content)
+	if len(tally) != 2 || tally[1] != 1 || tally[2] != 1 {
+		t.Errorf("later reaction did not replace earlier one: %v", tally)
+	}
+	if reaction, ok := indexer.Reaction(author, content); !ok || reaction != 2 {
+		t.Errorf("wrong reaction of author %v", reaction)
+	}
+	if kinds := indexer.ByKind(instructions.IReact, 0, 0); kinds.Total != 3 {
+		t.Errorf("reactions indexed as %v instructions of their kind", kinds.Total)
+	}
+}
+
+func newContent(author, stage crypto.PrivateKey, reply crypto.Hash) []byte {
+	content := instructions.Content{
+		EpochStamp:  1,
+		Published:   1,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		ContentType: "text",
+		Content:     []byte("post"),
+		Reply:       reply,
+	}
+	content.SubmitSign(stage)
+	content.Sign(author, crypto.ZeroToken)
+	content.AppendFee(author, 1000)
+	return content.Serialize()
+}
+
+func TestIndexerThreads(t *testing.T) {
+	_, publisher := crypto.RandomAsymetricKey()
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	root := newContent(author, stage, crypto.Hash{})
+	rootHash := crypto.Hasher(root)
+	reply := newContent(author, stage, rootHash)
+	replyHash := crypto.Hasher(reply)
+	nested := newContent(author, stage, replyHash)
+	indexer := NewIndexer()
+	indexer.AddBlock(newBlock(1, publisher, root, reply))
+	indexer.AddBlock(newBlock(2, publisher, nested))
+
+	threadRoot, thread := indexer.Thread(crypto.Hasher(nested), 0, 0)
+	if threadRoot != rootHash || thread.Total != 3 {
+		t.Fatalf("wrong thread of nested reply: %v entries", thread.Total)
+	}
+	if thread.Entries[0].Hash != rootHash || thread.Entries[2].Hash != crypto.Hasher(nested) {
+		t.Error("thread not in order of publication")
+	}
+	if replies := indexer.Replies(rootHash, 0, 0); replies.Total != 1 || replies.Entries[0].Hash != replyHash {
+		t.Error("wrong direct replies to root")
+	}
+}
+
+func TestIndexerTakedown(t *testing.T) {
+	_, publisher := crypto.RandomAsymetricKey()
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	_, moderator := crypto.RandomAsymetricKey()
+	flagged := newContent(author, stage, crypto.Hash{})
+	hidden := newContent(author, stage, crypto.Hasher(flagged))
+	takedown := func(content []byte, hide bool) []byte {
+		instruction := instructions.Takedown{
+			EpochStamp: 2,
+			Stage:      stage.PublicKey(),
+			Content:    crypto.Hasher(content),
+			Reason:     instructions.TakedownSpam,
+			Hide:       hide,
+		}
+		instruction.Sign(moderator)
+		instruction.AppendFee(moderator, 1000)
+		return instruction.Serialize()
+	}
+	indexer := NewIndexer()
+	indexer.AddBlock(newBlock(1, publisher, flagged, hidden))
+	indexer.AddBlock(newBlock(2, publisher, takedown(flagged, false), takedown(hidden, true)))
+
+	contents := indexer.ByKind(instructions.IContent, 0, 0)
+	if contents.Total != 1 || contents.Entries[0].Hash != crypto.Hasher(flagged) {
+		t.Fatalf("hidden content still listed: %+v", contents)
+	}
+	if entry := contents.Entries[0]; !entry.Flagged || entry.Hidden || entry.Reason != instructions.TakedownSpam {
+		t.Errorf("content not flagged: %+v", entry)
+	}
+	if _, thread := indexer.Thread(crypto.Hasher(flagged), 0, 0); thread.Total != 1 {
+		t.Error("hidden reply still on thread")
+	}
+	if takedowns := indexer.ByStage(stage.PublicKey(), 0, 0); takedowns.Total != 3 {
+		t.Errorf("takedowns not listed on stage: %v", takedowns.Total)
+	}
+}
+
+func TestIndexerEmbargo(t *testing.T) {
+	_, publisher := crypto.RandomAsymetricKey()
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	_, moderator := crypto.RandomAsymetricKey()
+	content := instructions.Content{
+		EpochStamp:  1,
+		Published:   3,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		ContentType: "text",
+		Content:     []byte("scheduled"),
+		Moderator:   moderator.PublicKey(),
+	}
+	content.SubmitSign(stage)
+	content.ModerateSign(stage)
+	content.Sign(moderator, crypto.ZeroToken)
+	content.AppendFee(moderator, 1000)
+	scheduled := content.Serialize()
+	indexer := NewIndexer()
+	indexer.AddBlock(newBlock(1, publisher, scheduled, newContent(author, stage, crypto.Hash{})))
+
+	if page := indexer.ByStage(stage.PublicKey(), 0, 0); page.Total != 1 {
+		t.Errorf("embargoed content listed: %v entries", page.Total)
+	}
+	queue := indexer.Queue(stage.PublicKey(), 0, 0)
+	if queue.Total != 1 || queue.Entries[0].Hash != crypto.Hasher(scheduled) || queue.Entries[0].Published != 3 {
+		t.Fatalf("embargoed content not queued: %+v", queue)
+	}
+	indexer.AddBlock(newBlock(2, publisher))
+	indexer.AddBlock(newBlock(3, publisher))
+	if page := indexer.ByStage(stage.PublicKey(), 0, 0); page.Total != 2 {
+		t.Errorf("content not published: %v entries", page.Total)
+	}
+	if queue := indexer.Queue(stage.PublicKey(), 0, 0); queue.Total != 0 {
+		t.Error("published content still queued")
+	}
+}
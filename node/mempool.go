@@ -0,0 +1,169 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+var (
+	ErrInvalidInstruction = errors.New("invalid instruction")
+	ErrKnownInstruction   = errors.New("instruction already known")
+	ErrMempoolFull        = errors.New("mempool is full")
+)
+
+// Mempool keeps instructions waiting to be incorporated into a block in order
+// of arrival, up to a maximum number of bytes of serialized instructions.
+type Mempool struct {
+	mu      sync.Mutex
+	pending []instructions.HashInstruction
+	data    map[crypto.Hash][]byte
+	size    int
+	maxSize int
+}
+
+// NewMempool returns an empty mempool holding at most maxSize bytes of
+// serialized instructions.
+func NewMempool(maxSize int) *Mempool {
+	return &Mempool{
+		pending: make([]instructions.HashInstruction, 0),
+		data:    make(map[crypto.Hash][]byte),
+		maxSize: maxSize,
+	}
+}
+
+// Add parses data into an instruction and appends it to the mempool. It
+// returns the hash of the instruction, and ErrMempoolFull if the mempool
+// cannot hold it.
+func (m *Mempool) Add(data []byte) (crypto.Hash, error) {
+	hash := crypto.Hasher(data)
+	if len(data) < 2 {
+		return hash, ErrInvalidInstruction
+	}
+	instruction := parseInstruction(data)
+	if instruction == nil {
+		return hash, ErrInvalidInstruction
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[hash]; ok {
+		return hash, ErrKnownInstruction
+	}
+	if m.size+len(data) > m.maxSize {
+		return hash, ErrMempoolFull
+	}
+	m.data[hash] = data
+	m.size += len(data)
+	m.pending = append(m.pending, instructions.HashInstruction{Instruction: instruction, Hash: hash})
+	return hash, nil
+}
+
+// parseInstruction parses data received from peers or clients. It returns nil
+// on malformed data, including data the parsed instruction does not serialize
+// back to, so that only the canonical encoding of an instruction is relayed.
+func parseInstruction(data []byte) instructions.Instruction {
+	instruction := instructions.ParseInstruction(data)
+	if instruction == nil || !bytes.Equal(instruction.Serialize(), data) {
+		return nil
+	}
+	return instruction
+}
+
+// Take removes from the mempool and returns the oldest instructions adding up
+// to at most maxBytes of serialized instructions. Instructions that do not fit
+// in what is left of maxBytes are skipped and stay on the mempool.
+func (m *Mempool) Take(maxBytes int) []instructions.HashInstruction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	size := 0
+	taken := make([]instructions.HashInstruction, 0)
+	kept := make([]instructions.HashInstruction, 0, len(m.pending))
+	for _, pending := range m.pending {
+		length := len(m.data[pending.Hash])
+		if size+length > maxBytes {
+			kept = append(kept, pending)
+			continue
+		}
+		size += length
+		taken = append(taken, pending)
+	}
+	m.pending = kept
+	for _, instruction := range taken {
+		m.remove(instruction.Hash)
+	}
+	return taken
+}
+
+// Restore puts instructions taken from the mempool back at its front, in the
+// same order, so that they are taken first by the next block. Instructions
+// already on the mempool are ignored.
+func (m *Mempool) Restore(restored []instructions.HashInstruction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := make([]instructions.HashInstruction, 0, len(restored)+len(m.pending))
+	for _, instruction := range restored {
+		if _, ok := m.data[instruction.Hash]; ok {
+			continue
+		}
+		data := instruction.Instruction.Serialize()
+		m.data[instruction.Hash] = data
+		m.size += len(data)
+		pending = append(pending, instruction)
+	}
+	m.pending = append(pending, m.pending...)
+}
+
+// Remove drops instructions from the mempool, typically because they were
+// incorporated into a block published by another node.
+func (m *Mempool) Remove(hashes []crypto.Hash) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := make(map[crypto.Hash]struct{})
+	for _, hash := range hashes {
+		if _, ok := m.data[hash]; ok {
+			m.remove(hash)
+			removed[hash] = struct{}{}
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	pending := make([]instructions.HashInstruction, 0, len(m.pending))
+	for _, instruction := range m.pending {
+		if _, ok := removed[instruction.Hash]; !ok {
+			pending = append(pending, instruction)
+		}
+	}
+	m.pending = pending
+}
+
+func (m *Mempool) remove(hash crypto.Hash) {
+	m.size -= len(m.data[hash])
+	delete(m.data, hash)
+}
+
+// Has checks if the instruction is waiting on the mempool.
+func (m *Mempool) Has(hash crypto.Hash) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data[hash]
+	return ok
+}
+
+// Get returns the serialized instruction with the hash waiting on the mempool.
+func (m *Mempool) Get(hash crypto.Hash) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[hash]
+	return data, ok
+}
+
+// Size returns the number of bytes of serialized instructions on the mempool.
+func (m *Mempool) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
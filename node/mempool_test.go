@@ -0,0 +1,64 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+)
+
+func TestMempoolTruncatedInstructions(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	stage, _ := crypto.RandomAsymetricKey()
+	content := &instructions.Content{EpochStamp: 1, Published: 1, Author: token, Stage: stage, ContentType: "text", Content: []byte("aereum")}
+	content.Sign(key, crypto.ZeroToken)
+	join := &instructions.JoinStage{EpochStamp: 1, Author: token, Stage: stage, Presentation: "hello"}
+	join.Sign(key)
+	transfer := &instructions.Transfer{EpochStamp: 1, From: token, To: []crypto.TokenValue{{Token: stage, Value: 10}}}
+	transfer.Sign(key)
+	deposit := &instructions.Deposit{EpochStamp: 1, Token: token, Value: 10}
+	deposit.Sign(key)
+
+	mempool := NewMempool(1 << 20)
+	for _, instruction := range []instructions.Instruction{content, join, transfer, deposit} {
+		instructions.AppendWalletFee(instruction, key, 1)
+		data := instruction.Serialize()
+		for size := 0; size < len(data); size++ {
+			if _, err := mempool.Add(data[:size]); err != ErrInvalidInstruction {
+				t.Fatalf("truncated instruction of kind %v added at %v bytes: %v", instruction.Kind(), size, err)
+			}
+		}
+		if _, err := mempool.Add(data); err != nil {
+			t.Errorf("instruction of kind %v not added: %v", instruction.Kind(), err)
+		}
+	}
+	if taken := mempool.Take(1 << 20); len(taken) != 4 {
+		t.Errorf("mempool has %v instructions", len(taken))
+	}
+}
+
+func TestMempoolLimits(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	transfer := func(reason string) []byte {
+		instruction := &instructions.Transfer{EpochStamp: 1, From: token, To: []crypto.TokenValue{{Token: token, Value: 1}}, Reason: reason, Fee: 1}
+		instruction.Sign(key)
+		return instruction.Serialize()
+	}
+	large, small := transfer(string(make([]byte, 200))), transfer("small")
+	mempool := NewMempool(len(large) + len(small))
+	for _, data := range [][]byte{large, small} {
+		if _, err := mempool.Add(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := mempool.Add(transfer("other")); err != ErrMempoolFull {
+		t.Errorf("instruction added beyond the mempool size: %v", err)
+	}
+	taken := mempool.Take(len(small))
+	if len(taken) != 1 || taken[0].Hash != crypto.Hasher(small) {
+		t.Fatal("instruction behind one larger than the block not taken")
+	}
+	if mempool.Size() != len(large) || !mempool.Has(crypto.Hasher(large)) {
+		t.Error("skipped instruction not kept on the mempool")
+	}
+}
@@ -0,0 +1,136 @@
+package node
+
+import (
+	"net"
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// Message kinds exchanged between peers. Every message is a frame whose first
+// byte is the kind and the remaining bytes the payload.
+const (
+	msgInstruction byte = iota
+	msgBlock
+	msgSync // payload is the epoch of the last block known to the sender
+)
+
+// Network is a minimal gossip layer over TCP. Instructions and blocks received
+// from a peer are handed to the node which decides whether to propagate them.
+type Network struct {
+	mu       sync.Mutex
+	listener net.Listener
+	peers    map[net.Conn]struct{}
+	handler  func(peer net.Conn, kind byte, payload []byte)
+	maxFrame int
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+// Listen starts accepting peers on address. An empty address starts a network
+// that only dials out. A peer sending a message larger than maxFrame bytes is
+// dropped.
+func Listen(address string, maxFrame int, handler func(peer net.Conn, kind byte, payload []byte)) (*Network, error) {
+	network := &Network{
+		peers:    make(map[net.Conn]struct{}),
+		handler:  handler,
+		maxFrame: maxFrame,
+	}
+	if address == "" {
+		return network, nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	network.listener = listener
+	network.wg.Add(1)
+	go func() {
+		defer network.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			network.serve(conn)
+		}
+	}()
+	return network, nil
+}
+
+// Dial connects to a peer.
+func (n *Network) Dial(address string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	n.serve(conn)
+	return conn, nil
+}
+
+func (n *Network) serve(conn net.Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		conn.Close()
+		return
+	}
+	n.peers[conn] = struct{}{}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer n.drop(conn)
+		for {
+			data, err := util.ReadFrameLimit(conn, n.maxFrame)
+			if err != nil || len(data) == 0 {
+				return
+			}
+			n.handler(conn, data[0], data[1:])
+		}
+	}()
+}
+
+func (n *Network) drop(conn net.Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.peers, conn)
+	conn.Close()
+}
+
+// Send writes a message to a single peer.
+func (n *Network) Send(peer net.Conn, kind byte, payload []byte) error {
+	return util.WriteFrame(peer, append([]byte{kind}, payload...))
+}
+
+// Broadcast writes a message to every peer except the one it came from, which
+// may be nil.
+func (n *Network) Broadcast(from net.Conn, kind byte, payload []byte) {
+	n.mu.Lock()
+	peers := make([]net.Conn, 0, len(n.peers))
+	for peer := range n.peers {
+		if peer != from {
+			peers = append(peers, peer)
+		}
+	}
+	n.mu.Unlock()
+	for _, peer := range peers {
+		if err := n.Send(peer, kind, payload); err != nil {
+			n.drop(peer)
+		}
+	}
+}
+
+// Close stops accepting peers, disconnects every peer and waits for their
+// handlers to return.
+func (n *Network) Close() {
+	n.mu.Lock()
+	n.closed = true
+	if n.listener != nil {
+		n.listener.Close()
+	}
+	for peer := range n.peers {
+		peer.Close()
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
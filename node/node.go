@@ -0,0 +1,390 @@
+// Package node wires together the state, the chain, the mempool and the
+// network of an aereum node.
+package node
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/block"
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/state"
+	"github.com/lienkolabs/aereum/core/util"
+	"github.com/lienkolabs/aereum/node/blob"
+	"github.com/lienkolabs/aereum/node/fees"
+	"github.com/lienkolabs/aereum/node/index"
+)
+
+// DefaultBlockInterval is used when the genesis spec does not define one.
+const DefaultBlockInterval = time.Second
+
+// maxBlockOverhead bounds the bytes of the header and signature of a
+// serialized block. The length prefixes of its instructions, two bytes for
+// instructions of at least 64 bytes, add at most 1/32 of the instructions.
+const maxBlockOverhead = 1 << 10
+
+// mempoolBlocks is the number of blocks of instructions the mempool holds.
+const mempoolBlocks = 16
+
+// Blobs not referenced by a content on the chain are collected every
+// BlobCollectInterval, once older than BlobGracePeriod. The grace period
+// leaves time for the content referencing an uploaded blob to be included.
+const (
+	BlobCollectInterval = time.Hour
+	BlobGracePeriod     = 6 * time.Hour
+)
+
+type Node struct {
+	Config    *Config
+	Chain     *Chain
+	Mempool   *Mempool
+	Fees      *fees.Market
+	Network   *Network
+	Feed      *Feed
+	Receipts  *Receipts
+	Index     *index.Indexer // nil unless enabled by the config
+	Blobs     *blob.Store
+	server    *http.Server
+	publisher crypto.PrivateKey
+	producer  bool
+	interval  time.Duration
+	maxBlock  int
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// New opens the chain on the data directory of config and prepares the node.
+// Nothing is started until Start is called.
+func New(config *Config) (*Node, error) {
+	if config.Genesis == "" {
+		return nil, errors.New("genesis spec file is required")
+	}
+	if config.DataDir == "" {
+		return nil, errors.New("data directory is required")
+	}
+	genesis, err := state.LoadGenesisSpec(config.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{
+		Config:   config,
+		Fees:     fees.NewMarket(genesis.Parameters.TargetBlockSize),
+		Feed:     NewFeed(DefaultFeedCapacity),
+		Receipts: NewReceipts(DefaultReceiptExpiry),
+		interval: DefaultBlockInterval,
+		maxBlock: 2 * fees.DefaultTargetBlockSize,
+		stop:     make(chan struct{}),
+	}
+	if genesis.Parameters.BlockInterval > 0 {
+		node.interval = time.Duration(genesis.Parameters.BlockInterval) * time.Millisecond
+	}
+	if genesis.Parameters.TargetBlockSize > 0 {
+		node.maxBlock = 2 * genesis.Parameters.TargetBlockSize
+	}
+	node.Mempool = NewMempool(mempoolBlocks * node.maxBlock)
+	if config.PublisherKey != "" {
+		if node.publisher, err = ReadPrivateKey(config.PublisherKey); err != nil {
+			return nil, err
+		}
+		node.producer = true
+	}
+	if node.Blobs, err = blob.OpenStore(filepath.Join(config.DataDir, "blobs")); err != nil {
+		return nil, err
+	}
+	if node.Chain, err = OpenChain(genesis, config.DataDir); err != nil {
+		return nil, err
+	}
+	if node.producer && !node.Chain.IsValidator(node.publisher.PublicKey()) {
+		node.Chain.Close()
+		return nil, ErrNotAValidator
+	}
+	err = forEachBlock(node.Chain, func(parsed *block.Block) {
+		observeBlock(node.Fees, parsed)
+		node.referenceBlobs(parsed)
+	})
+	if err != nil {
+		node.Chain.Close()
+		return nil, err
+	}
+	if config.Index {
+		node.Index = index.NewIndexer()
+		if err := node.Index.Rebuild(node.Chain); err != nil {
+			node.Chain.Close()
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// Start starts the network layer, dials the configured peers and, if the node
+// is configured as a publisher, the block producer.
+func (n *Node) Start() error {
+	var err error
+	if n.Network, err = Listen(n.Config.Listen, n.maxMessage(), n.handle); err != nil {
+		return err
+	}
+	for _, address := range n.Config.Peers {
+		peer, err := n.Network.Dial(address)
+		if err != nil {
+			log.Printf("could not connect to peer %v: %v", address, err)
+			continue
+		}
+		n.requestSync(peer)
+	}
+	if n.producer {
+		n.wg.Add(1)
+		go n.produce()
+	}
+	n.wg.Add(1)
+	go n.collectBlobs()
+	if n.Config.API != "" {
+		listener, err := net.Listen("tcp", n.Config.API)
+		if err != nil {
+			return err
+		}
+		n.server = &http.Server{Handler: n.API()}
+		go n.server.Serve(listener)
+	}
+	return nil
+}
+
+// maxMessage is the size of the largest message accepted from peers, a block
+// of maxBlock bytes of instructions and its kind.
+func (n *Node) maxMessage() int {
+	return 1 + n.maxBlock + n.maxBlock/32 + maxBlockOverhead
+}
+
+// Submit adds a serialized instruction to the mempool and gossips it to the
+// peers. It returns the hash of the instruction. The outcome of the submission
+// is kept on the receipts of the node.
+func (n *Node) Submit(data []byte) (crypto.Hash, error) {
+	hash, err := n.Mempool.Add(data)
+	if err == ErrKnownInstruction {
+		return hash, err
+	}
+	if err != nil {
+		n.Receipts.Reject(hash, n.Chain.Epoch(), err)
+		return hash, err
+	}
+	n.Receipts.Pending(hash, n.Chain.Epoch())
+	n.Fees.ObserveMempool(n.Mempool.Size())
+	if n.Network != nil {
+		n.Network.Broadcast(nil, msgInstruction, data)
+	}
+	return hash, nil
+}
+
+func (n *Node) produce() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case now := <-ticker.C:
+			data, err := n.produceBlock(now)
+			if err != nil {
+				log.Printf("could not produce block: %v", err)
+				continue
+			}
+			n.Network.Broadcast(nil, msgBlock, data)
+		}
+	}
+}
+
+// produceBlock commits a block with the instructions taken from the mempool.
+// Instructions left out of the block but valid on the state after it are put
+// back on the mempool, the others are recorded as rejected on the receipts.
+func (n *Node) produceBlock(now time.Time) ([]byte, error) {
+	pending := n.Mempool.Take(n.maxBlock)
+	data, rejected, err := n.Chain.Produce(n.publisher, pending, now)
+	if err != nil {
+		n.Mempool.Restore(pending)
+		return nil, err
+	}
+	epoch := block.GetBlockEpoch(data)
+	retry := make([]instructions.HashInstruction, 0)
+	for _, rejection := range rejected {
+		if rejection.Retry {
+			retry = append(retry, rejection.HashInstruction)
+		} else {
+			n.Receipts.Reject(rejection.Hash, epoch, rejection.Err)
+		}
+	}
+	n.Mempool.Restore(retry)
+	n.committed(data)
+	return data, nil
+}
+
+// forEachBlock calls f on every block of the chain, oldest first.
+func forEachBlock(chain *Chain, f func(*block.Block)) error {
+	for epoch := uint64(1); epoch <= chain.Epoch(); epoch++ {
+		data, err := chain.Block(epoch)
+		if err != nil {
+			return err
+		}
+		parsed := block.ParseBlock(data)
+		if parsed == nil {
+			return ErrInvalidBlock
+		}
+		f(parsed)
+	}
+	return nil
+}
+
+// observeBlock feeds the fee market with the size of the instructions of a
+// block and its fees.
+func observeBlock(market *fees.Market, parsed *block.Block) {
+	size := 0
+	for _, instruction := range parsed.Instructions {
+		size += len(instruction)
+	}
+	market.ObserveBlock(size, parsed.FeesCollected)
+}
+
+// collectBlobs periodically removes the blobs not referenced on the chain.
+func (n *Node) collectBlobs() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(BlobCollectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case now := <-ticker.C:
+			if _, err := n.Blobs.Collect(now.Add(-BlobGracePeriod)); err != nil {
+				log.Printf("could not collect blobs: %v", err)
+			}
+		}
+	}
+}
+
+// referenceBlobs keeps the blobs of the contents of a block on the store.
+func (n *Node) referenceBlobs(parsed *block.Block) {
+	for _, data := range parsed.Instructions {
+		if content, ok := instructions.ParseInstruction(data).(*instructions.Content); ok && content.IsBlob() {
+			n.Blobs.Reference(crypto.BytesToHash(content.Hash))
+		}
+	}
+}
+
+// committed feeds the fee market, the blob store, the subscription feed and
+// the receipts with a newly committed block. Instructions pending on the mempool for longer than
+// the receipt expiry are dropped.
+func (n *Node) committed(data []byte) {
+	if parsed := block.ParseBlock(data); parsed != nil {
+		hash := crypto.Hasher(data)
+		locations := make(map[crypto.Hash]InstructionLocation)
+		for index, instruction := range parsed.Instructions {
+			locations[crypto.Hasher(instruction)] = InstructionLocation{Epoch: parsed.Epoch(), BlockHash: hash, Index: index}
+		}
+		observeBlock(n.Fees, parsed)
+		n.referenceBlobs(parsed)
+		n.Feed.Append(parsed.Epoch(), parsed.Instructions...)
+		n.Receipts.Include(locations)
+		if n.Index != nil {
+			if err := n.Index.AddBlock(data); err != nil {
+				log.Printf("could not index block of epoch %v: %v", parsed.Epoch(), err)
+			}
+		}
+		n.Mempool.Remove(n.Receipts.Expire(parsed.Epoch()))
+	}
+	n.Fees.ObserveMempool(n.Mempool.Size())
+}
+
+// Receipt returns the receipt of the instruction with the hash. Instructions
+// included on the chain have a receipt even after the receipts store forgot
+// them.
+func (n *Node) Receipt(hash crypto.Hash) (Receipt, bool) {
+	if receipt, ok := n.Receipts.Get(hash); ok {
+		return receipt, true
+	}
+	location, ok := n.Chain.Location(hash)
+	if !ok {
+		return Receipt{Hash: hash}, false
+	}
+	receipt := Receipt{
+		Hash:      hash,
+		Status:    ReceiptIncluded,
+		Submitted: location.Epoch,
+		Epoch:     location.Epoch,
+		BlockHash: location.BlockHash,
+		Index:     location.Index,
+	}
+	return receipt, true
+}
+
+func (n *Node) requestSync(peer net.Conn) {
+	payload := make([]byte, 0)
+	util.PutUint64(n.Chain.Epoch(), &payload)
+	n.Network.Send(peer, msgSync, payload)
+}
+
+// handle processes messages received from peers.
+func (n *Node) handle(peer net.Conn, kind byte, payload []byte) {
+	switch kind {
+	case msgInstruction:
+		if hash, err := n.Mempool.Add(payload); err == nil {
+			n.Receipts.Pending(hash, n.Chain.Epoch())
+			n.Fees.ObserveMempool(n.Mempool.Size())
+			n.Network.Broadcast(peer, msgInstruction, payload)
+		}
+	case msgBlock:
+		epoch := block.GetBlockEpoch(payload)
+		current := n.Chain.Epoch()
+		if epoch <= current {
+			return
+		}
+		if epoch > current+1 {
+			n.requestSync(peer)
+			return
+		}
+		added, err := n.Chain.AddBlock(payload)
+		if err != nil {
+			log.Printf("rejected block of epoch %v: %v", epoch, err)
+			return
+		}
+		hashes := make([]crypto.Hash, 0, len(added.Instructions))
+		for _, instruction := range added.Instructions {
+			hashes = append(hashes, crypto.Hasher(instruction))
+		}
+		n.Mempool.Remove(hashes)
+		n.committed(payload)
+		n.Network.Broadcast(peer, msgBlock, payload)
+	case msgSync:
+		epoch, _ := util.ParseUint64(payload, 0)
+		for next := epoch + 1; ; next++ {
+			data, err := n.Chain.Block(next)
+			if err != nil {
+				return
+			}
+			if n.Network.Send(peer, msgBlock, data) != nil {
+				return
+			}
+		}
+	}
+}
+
+// Shutdown stops the block producer and the network and closes the chain and
+// every store of the state.
+func (n *Node) Shutdown() error {
+	if n.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		n.server.Shutdown(ctx)
+		cancel()
+	}
+	close(n.stop)
+	n.wg.Wait()
+	if n.Network != nil {
+		n.Network.Close()
+	}
+	return n.Chain.Close()
+}
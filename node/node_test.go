@@ -0,0 +1,202 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/instructions"
+	"github.com/lienkolabs/aereum/core/state"
+	"github.com/lienkolabs/aereum/node/blob"
+	"github.com/lienkolabs/aereum/node/fees"
+	"github.com/lienkolabs/aereum/node/index"
+)
+
+// newTestNode returns a producing node on a chain in memory from the genesis,
+// with a random validator.
+func newTestNode(t *testing.T, genesis *state.GenesisSpec) *Node {
+	publisher, key := crypto.RandomAsymetricKey()
+	genesis.Network = "test"
+	genesis.Validators = []string{hex.EncodeToString(publisher[:])}
+	chain, err := OpenChain(genesis, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Node{
+		Chain:     chain,
+		Mempool:   NewMempool(1 << 20),
+		Fees:      fees.NewMarket(0),
+		Feed:      NewFeed(DefaultFeedCapacity),
+		Receipts:  NewReceipts(DefaultReceiptExpiry),
+		publisher: key,
+		producer:  true,
+		maxBlock:  1 << 20,
+	}
+}
+
+func TestNodeRejectsUnpayableInstruction(t *testing.T) {
+	paying, payingKey := crypto.RandomAsymetricKey()
+	_, brokeKey := crypto.RandomAsymetricKey()
+	node := newTestNode(t, &state.GenesisSpec{
+		Balances: []state.GenesisBalance{{Token: hex.EncodeToString(paying[:]), Value: 1 << 30}},
+	})
+	hashes := make([]crypto.Hash, 0)
+	for _, wallet := range []crypto.PrivateKey{payingKey, brokeKey} {
+		transfer := instructions.Transfer{EpochStamp: 1, From: wallet.PublicKey(), To: []crypto.TokenValue{{Token: paying, Value: 10}}, Fee: 1000}
+		transfer.Sign(wallet)
+		hash, err := node.Submit(transfer.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if _, err := node.produceBlock(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if receipt, _ := node.Receipts.Get(hashes[0]); receipt.Status != ReceiptIncluded {
+		t.Errorf("paid instruction %v: %v", receipt.Status, receipt.Reason)
+	}
+	receipt, _ := node.Receipts.Get(hashes[1])
+	if receipt.Status != ReceiptRejected || receipt.Reason == "" {
+		t.Errorf("unpayable instruction %v: %v", receipt.Status, receipt.Reason)
+	}
+}
+
+func TestNodeRetriesInstructionFundedByBlock(t *testing.T) {
+	paying, payingKey := crypto.RandomAsymetricKey()
+	funded, fundedKey := crypto.RandomAsymetricKey()
+	node := newTestNode(t, &state.GenesisSpec{
+		Balances: []state.GenesisBalance{{Token: hex.EncodeToString(paying[:]), Value: 1 << 30}},
+	})
+	spend := instructions.Transfer{EpochStamp: 1, From: funded, To: []crypto.TokenValue{{Token: paying, Value: 10}}, Fee: 1000}
+	spend.Sign(fundedKey)
+	fund := instructions.Transfer{EpochStamp: 1, From: paying, To: []crypto.TokenValue{{Token: funded, Value: 1 << 20}}, Fee: 1000}
+	fund.Sign(payingKey)
+	hashes := make([]crypto.Hash, 0)
+	for _, transfer := range []instructions.Transfer{spend, fund} {
+		hash, err := node.Submit(transfer.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if _, err := node.produceBlock(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if receipt, _ := node.Receipts.Get(hashes[0]); receipt.Status != ReceiptPending || !node.Mempool.Has(hashes[0]) {
+		t.Fatalf("instruction funded by the block not retried: %v %v", receipt.Status, receipt.Reason)
+	}
+	if _, err := node.produceBlock(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if receipt, _ := node.Receipts.Get(hashes[0]); receipt.Status != ReceiptIncluded {
+		t.Errorf("retried instruction %v: %v", receipt.Status, receipt.Reason)
+	}
+}
+
+func TestNodeQueueRequiresModerator(t *testing.T) {
+	stage, _ := crypto.RandomAsymetricKey()
+	moderate, moderateKey := crypto.RandomAsymetricKey()
+	_, otherKey := crypto.RandomAsymetricKey()
+	node := newTestNode(t, &state.GenesisSpec{
+		Stages: []state.GenesisStage{{Stage: hex.EncodeToString(stage[:]), Moderate: hex.EncodeToString(moderate[:])}},
+	})
+	node.Index = index.NewIndexer()
+	api := node.API()
+	query := func(key crypto.PrivateKey, epoch uint64) int {
+		signature := key.Sign(QueueMessage(stage, epoch))
+		url := fmt.Sprintf("/queue?stage=%x&epoch=%v&signature=%x", stage, epoch, signature)
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		return recorder.Code
+	}
+	if status := query(moderateKey, node.Chain.Epoch()); status != http.StatusOK {
+		t.Errorf("moderator request answered with %v", status)
+	}
+	if status := query(otherKey, node.Chain.Epoch()); status != http.StatusForbidden {
+		t.Errorf("request not signed by moderator answered with %v", status)
+	}
+	if status := query(moderateKey, node.Chain.Epoch()+1); status != http.StatusForbidden {
+		t.Errorf("request signed for a future epoch answered with %v", status)
+	}
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/queue?stage=%x", stage), nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("unsigned request answered with %v", recorder.Code)
+	}
+}
+
+func TestNodeBlobRequiresContent(t *testing.T) {
+	node := newTestNode(t, &state.GenesisSpec{})
+	var err error
+	if node.Blobs, err = blob.OpenStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	api := node.API()
+	payload := bytes.Repeat([]byte("aereum"), blob.ChunkSize/4)
+	root, size, err := blob.Root(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, author := crypto.RandomAsymetricKey()
+	_, stage := crypto.RandomAsymetricKey()
+	content := instructions.Content{
+		EpochStamp:  1,
+		Published:   1,
+		Author:      author.PublicKey(),
+		Stage:       stage.PublicKey(),
+		ContentType: "video",
+		Hash:        root[:],
+		BlobSize:    size,
+	}
+	content.SubmitSign(stage)
+	content.Sign(author, crypto.ZeroToken)
+	content.AppendFee(author, 1000)
+	hash, err := node.Mempool.Add(content.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(content crypto.Hash, body []byte) int {
+		recorder := httptest.NewRecorder()
+		url := fmt.Sprintf("/blob?content=%x", content)
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body)))
+		return recorder.Code
+	}
+	if status := post(crypto.Hasher(payload), payload); status != http.StatusForbidden {
+		t.Errorf("blob without content answered with %v", status)
+	}
+	if status := post(hash, append([]byte{0}, payload[1:]...)); status != http.StatusBadRequest {
+		t.Errorf("blob not matching its content answered with %v", status)
+	}
+	if status := post(hash, append(payload, 0)); status != http.StatusBadRequest {
+		t.Errorf("blob larger than its content answered with %v", status)
+	}
+	if status := post(hash, payload); status != http.StatusCreated || !node.Blobs.Has(root) {
+		t.Errorf("blob of content answered with %v", status)
+	}
+}
+
+func TestNodeBlockHash(t *testing.T) {
+	node := newTestNode(t, &state.GenesisSpec{})
+	data, err := node.produceBlock(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	node.API().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/block?epoch=1", nil))
+	var served struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if hash := crypto.Hasher(data); served.Hash != "0x"+hex.EncodeToString(hash[:]) {
+		t.Errorf("block served with hash %v, expected %x", served.Hash, hash)
+	}
+}
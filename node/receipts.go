@@ -0,0 +1,210 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/lienkolabs/aereum/core/crypto"
+	"github.com/lienkolabs/aereum/core/util"
+)
+
+// DefaultReceiptExpiry is the number of epochs an instruction may wait on the
+// mempool before it is expired, and the number of epochs a resolved receipt is
+// kept before it is forgotten.
+const DefaultReceiptExpiry = 100
+
+type ReceiptStatus byte
+
+const (
+	ReceiptUnknown ReceiptStatus = iota
+	ReceiptPending
+	ReceiptIncluded
+	ReceiptRejected
+	ReceiptExpired
+)
+
+func (s ReceiptStatus) String() string {
+	switch s {
+	case ReceiptPending:
+		return "pending"
+	case ReceiptIncluded:
+		return "included"
+	case ReceiptRejected:
+		return "rejected"
+	case ReceiptExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// Receipt is the inclusion status of an instruction. Epoch, BlockHash and
+// Index locate the instruction on the chain once included. Reason explains a
+// rejection.
+type Receipt struct {
+	Hash      crypto.Hash
+	Status    ReceiptStatus
+	Submitted uint64 // epoch the instruction arrived at the mempool
+	Epoch     uint64
+	BlockHash crypto.Hash
+	Index     int
+	Reason    string
+	Sequence  uint64 // sequence number of the last update of the receipt
+	updated   uint64
+}
+
+func (r *Receipt) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutHex("hash", r.Hash[:])
+	bulk.PutString("status", r.Status.String())
+	if r.Status == ReceiptIncluded {
+		bulk.PutUint64("epoch", r.Epoch)
+		bulk.PutHex("block", r.BlockHash[:])
+		bulk.PutUint64("index", uint64(r.Index))
+	}
+	if r.Reason != "" {
+		bulk.PutString("reason", r.Reason)
+	}
+	bulk.PutUint64("sequence", r.Sequence)
+	return bulk.ToString()
+}
+
+// Receipts keeps the inclusion status of instructions submitted to the node,
+// keyed by instruction hash. Every update gets a sequence number so that
+// clients can follow the receipts of their instructions as they resolve.
+type Receipts struct {
+	mu       sync.Mutex
+	receipts map[crypto.Hash]*Receipt
+	sequence uint64
+	expiry   uint64
+	notify   chan struct{}
+}
+
+func NewReceipts(expiry uint64) *Receipts {
+	if expiry == 0 {
+		expiry = DefaultReceiptExpiry
+	}
+	return &Receipts{
+		receipts: make(map[crypto.Hash]*Receipt),
+		expiry:   expiry,
+		notify:   make(chan struct{}),
+	}
+}
+
+// update must be called with the lock held.
+func (r *Receipts) update(receipt *Receipt, epoch uint64) {
+	r.sequence += 1
+	receipt.Sequence = r.sequence
+	receipt.updated = epoch
+	r.receipts[receipt.Hash] = receipt
+}
+
+func (r *Receipts) wake() {
+	close(r.notify)
+	r.notify = make(chan struct{})
+}
+
+// Pending records that the instruction is waiting on the mempool since epoch.
+// A receipt of an included instruction is left untouched.
+func (r *Receipts) Pending(hash crypto.Hash, epoch uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if receipt, ok := r.receipts[hash]; ok && receipt.Status == ReceiptIncluded {
+		return
+	}
+	r.update(&Receipt{Hash: hash, Status: ReceiptPending, Submitted: epoch}, epoch)
+	r.wake()
+}
+
+// Reject records that the instruction was not accepted by the mempool or was
+// left out of a block at epoch for the reason err.
+func (r *Receipts) Reject(hash crypto.Hash, epoch uint64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	receipt := &Receipt{Hash: hash, Status: ReceiptRejected, Submitted: epoch, Reason: err.Error()}
+	if old, ok := r.receipts[hash]; ok {
+		if old.Status == ReceiptIncluded {
+			return
+		}
+		receipt.Submitted = old.Submitted
+	}
+	r.update(receipt, epoch)
+	r.wake()
+}
+
+// Include records the locations of instructions committed on the chain.
+func (r *Receipts) Include(locations map[crypto.Hash]InstructionLocation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, location := range locations {
+		receipt := &Receipt{
+			Hash:      hash,
+			Status:    ReceiptIncluded,
+			Submitted: location.Epoch,
+			Epoch:     location.Epoch,
+			BlockHash: location.BlockHash,
+			Index:     location.Index,
+		}
+		if old, ok := r.receipts[hash]; ok {
+			receipt.Submitted = old.Submitted
+		}
+		r.update(receipt, location.Epoch)
+	}
+	r.wake()
+}
+
+// Expire marks as expired the instructions pending for more than the expiry
+// period at epoch and forgets receipts resolved before that period. It
+// returns the hashes of the expired instructions so that they can be dropped
+// from the mempool.
+func (r *Receipts) Expire(epoch uint64) []crypto.Hash {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := make([]crypto.Hash, 0)
+	for hash, receipt := range r.receipts {
+		if receipt.updated+r.expiry >= epoch {
+			continue
+		}
+		if receipt.Status != ReceiptPending {
+			delete(r.receipts, hash)
+			continue
+		}
+		r.update(&Receipt{Hash: hash, Status: ReceiptExpired, Submitted: receipt.Submitted}, epoch)
+		expired = append(expired, hash)
+	}
+	if len(expired) > 0 {
+		r.wake()
+	}
+	return expired
+}
+
+// Get returns the receipt of the instruction with the hash.
+func (r *Receipts) Get(hash crypto.Hash) (Receipt, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	receipt, ok := r.receipts[hash]
+	if !ok {
+		return Receipt{Hash: hash}, false
+	}
+	return *receipt, true
+}
+
+// Head returns the sequence number of the last update.
+func (r *Receipts) Head() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sequence
+}
+
+// Since returns the receipts of the hashes updated after sequence number
+// since, the sequence number to ask next, and a channel closed on the next
+// update.
+func (r *Receipts) Since(since uint64, hashes []crypto.Hash) ([]Receipt, uint64, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := make([]Receipt, 0)
+	for _, hash := range hashes {
+		if receipt, ok := r.receipts[hash]; ok && receipt.Sequence > since {
+			found = append(found, *receipt)
+		}
+	}
+	return found, r.sequence, r.notify
+}